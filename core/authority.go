@@ -0,0 +1,308 @@
+/***************************************************************
+ * Arquivo: authority.go
+ * Descrição: Prova de autoridade: conjunto de validadores e
+ *            governança on-chain.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: O conjunto inicial vem do bloco gênesis. Os blocos
+ * são produzidos em rodízio pela altura e o conjunto muda quando a
+ * maioria dos validadores vota na mesma proposta.
+ ***************************************************************/
+
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+// ValidatorProposal is a change of the validator set: adding Validator, or
+// removing it when Add is false.
+type ValidatorProposal struct {
+	Validator types.Address
+	Add       bool
+}
+
+// NewAuthorityGenesisBlock builds the genesis block of a proof-of-authority
+// chain. Besides the mints of alloc it registers the initial validators,
+// who take turns producing the blocks.
+func NewAuthorityGenesisBlock(timestamp uint64, alloc map[types.Address]uint64, validators []types.Address) (*Block, error) {
+	b, err := NewGenesisBlock(timestamp, alloc)
+	if err != nil || len(validators) == 0 {
+		return b, err
+	}
+
+	sorted := append([]types.Address{}, validators...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i][:], sorted[j][:]) < 0
+	})
+
+	state := NewState()
+	txx := b.Transactions
+	for _, tx := range txx {
+		if err := state.ApplyTransaction(&tx, 0, types.Address{}); err != nil {
+			return nil, err
+		}
+	}
+	for i, addr := range sorted {
+		if i > 0 && addr == sorted[i-1] {
+			return nil, fmt.Errorf("genesis validator %s is given twice", addr)
+		}
+		tx := Transaction{Type: TxTypeAddValidator, To: addr}
+		if err := state.ApplyTransaction(&tx, 0, types.Address{}); err != nil {
+			return nil, err
+		}
+		txx = append(txx, tx)
+	}
+
+	if b.DataHash, err = CalculateDataHash(txx); err != nil {
+		return nil, err
+	}
+	b.Transactions = txx
+	b.StateRoot = state.Root()
+	return b, nil
+}
+
+// Validators returns the validator set sorted by address, the order in
+// which they produce blocks. It is empty for a chain open to any producer.
+func (s *State) Validators() []types.Address {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.sortedValidators()
+}
+
+// IsValidator tells whether addr belongs to the validator set.
+func (s *State) IsValidator(addr types.Address) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.validators[addr]
+}
+
+// Proposer returns the validator whose turn it is to produce the block at
+// height, false when the chain has no validator set.
+func (s *State) Proposer(height uint32) (types.Address, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.proposer(height)
+}
+
+// Votes returns the validators that voted for the proposal and whose votes
+// still count.
+func (s *State) Votes(p ValidatorProposal) []types.Address {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	voters := []types.Address{}
+	for _, addr := range s.sortedValidators() {
+		if s.votes[p][addr] {
+			voters = append(voters, addr)
+		}
+	}
+	return voters
+}
+
+// the helpers below must be called with the lock held
+
+func (s *State) sortedValidators() []types.Address {
+	addrs := make([]types.Address, 0, len(s.validators))
+	for addr := range s.validators {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+	return addrs
+}
+
+// proposer picks the validators in turn, by height.
+func (s *State) proposer(height uint32) (types.Address, bool) {
+	validators := s.sortedValidators()
+	if len(validators) == 0 {
+		return types.Address{}, false
+	}
+	return validators[int(height)%len(validators)], true
+}
+
+// ProofOfAuthority is the consensus engine of proof-of-authority chains:
+// the validators take turns producing blocks, by height. Chains without
+// validators accept blocks of any producer.
+type ProofOfAuthority struct{}
+
+// Prepare checks that it is the turn of validator to produce the block.
+func (ProofOfAuthority) Prepare(chain *BlockChain, header *Header, validator types.Address) error {
+	proposer, ok := chain.state.Proposer(header.Height)
+	if ok && proposer != validator {
+		return fmt.Errorf("%w: it is the turn of %s to produce block (%d)", ErrNotProposer, proposer, header.Height)
+	}
+	return nil
+}
+
+func (ProofOfAuthority) Seal(chain *BlockChain, b *Block, key crypto.PrivateKey) error {
+	return b.Sign(key)
+}
+
+// VerifyHeader accepts any header, the producer of a block is checked by
+// VerifySeal against the validator set of the parent state.
+func (ProofOfAuthority) VerifyHeader(chain *BlockChain, header, parent *Header) error {
+	return nil
+}
+
+// VerifySeal checks that the block was produced by the validator whose turn
+// it is.
+func (ProofOfAuthority) VerifySeal(state EngineState, b *Block) error {
+	if b.Height == 0 {
+		return nil
+	}
+	proposer, ok := state.Proposer(b.Height)
+	if !ok {
+		return nil
+	}
+	if b.Validator.IsZero() {
+		return fmt.Errorf("block (%s) has no validator", b.Hash(BlockHasher{}))
+	}
+
+	addr := b.Validator.Address()
+	switch {
+	case addr == proposer:
+		return nil
+	case state.IsValidator(addr):
+		return fmt.Errorf("block (%s) at height (%d) was produced out of turn by %s, expected %s", b.Hash(BlockHasher{}), b.Height, addr, proposer)
+	default:
+		return fmt.Errorf("block (%s) was produced by %s, which is not a validator", b.Hash(BlockHasher{}), addr)
+	}
+}
+
+// Finalize changes nothing, the validators earn the fees of the
+// transactions.
+func (ProofOfAuthority) Finalize(state EngineState, b *Block) error {
+	return nil
+}
+
+// applyValidatorTx registers a genesis validator, or counts the vote of a
+// validator for a change of the set. Votes use the nonce of the voter like
+// transfers. A change happens once more than half of the validators voted
+// for it.
+func (s *State) applyValidatorTx(tx *Transaction, height uint32, journal *stateUndo) error {
+	if tx.Value != 0 {
+		return fmt.Errorf("validator transaction cannot carry value")
+	}
+	p := ValidatorProposal{Validator: tx.To, Add: tx.Type == TxTypeAddValidator}
+
+	if height == 0 {
+		if !p.Add {
+			return fmt.Errorf("genesis cannot remove validators")
+		}
+		s.setValidator(p.Validator, true, journal)
+		return nil
+	}
+
+	from, voter, err := s.sender(tx)
+	if err != nil {
+		return err
+	}
+	if !s.validators[from] {
+		return fmt.Errorf("%s is not a validator and cannot vote", from)
+	}
+	if s.validators[p.Validator] == p.Add {
+		return fmt.Errorf("proposal to change %s does not change the validator set", p.Validator)
+	}
+	if !p.Add && len(s.validators) == 1 {
+		return fmt.Errorf("cannot remove the last validator %s", p.Validator)
+	}
+	if s.votes[p][from] {
+		return fmt.Errorf("%s already voted for the proposal", from)
+	}
+
+	voter.Nonce++
+	s.set(from, voter, journal)
+
+	voters := copyVoters(s.votes[p])
+	voters[from] = true
+	count := 0
+	for addr := range voters {
+		if s.validators[addr] {
+			count++
+		}
+	}
+	if count*2 <= len(s.validators) {
+		s.setVoters(p, voters, journal)
+		return nil
+	}
+
+	s.setVoters(p, nil, journal)
+	s.setValidator(p.Validator, p.Add, journal)
+	return nil
+}
+
+func (s *State) setValidator(addr types.Address, member bool, undo *stateUndo) {
+	if undo != nil {
+		if _, ok := undo.validators[addr]; !ok {
+			undo.validators[addr] = s.validators[addr]
+		}
+	}
+
+	if member {
+		s.validators[addr] = true
+	} else {
+		delete(s.validators, addr)
+	}
+}
+
+func (s *State) setVoters(p ValidatorProposal, voters map[types.Address]bool, undo *stateUndo) {
+	if undo != nil {
+		if _, ok := undo.votes[p]; !ok {
+			undo.votes[p] = s.votes[p]
+		}
+	}
+
+	if len(voters) == 0 {
+		delete(s.votes, p)
+	} else {
+		s.votes[p] = voters
+	}
+}
+
+// authorityLeaves returns the state root leaves of the validators, the hash
+// of "validator" | address, and of the votes, the hash of "vote" | address
+// | add u8 | voter, each sorted.
+func (s *State) authorityLeaves() []types.Hash {
+	leaves := []types.Hash{}
+	for _, addr := range s.sortedValidators() {
+		leaves = append(leaves, sha256.Sum256(append([]byte("validator"), addr[:]...)))
+	}
+
+	votes := [][]byte{}
+	for p, voters := range s.votes {
+		for voter := range voters {
+			buf := append([]byte("vote"), p.Validator[:]...)
+			if p.Add {
+				buf = append(buf, 1)
+			} else {
+				buf = append(buf, 0)
+			}
+			votes = append(votes, append(buf, voter[:]...))
+		}
+	}
+	sort.Slice(votes, func(i, j int) bool {
+		return bytes.Compare(votes[i], votes[j]) < 0
+	})
+	for _, v := range votes {
+		leaves = append(leaves, sha256.Sum256(v))
+	}
+	return leaves
+}
+
+func copyVoters(voters map[types.Address]bool) map[types.Address]bool {
+	cp := make(map[types.Address]bool, len(voters))
+	for addr := range voters {
+		cp[addr] = true
+	}
+	return cp
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// authorityKeys returns n validator keys sorted by address, the order in
+// which they produce blocks.
+func authorityKeys(n int) []crypto.PrivateKey {
+	keys := make([]crypto.PrivateKey, n)
+	for i := range keys {
+		keys[i] = crypto.GeneratePrivateKey()
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i].PublicKey().Address(), keys[j].PublicKey().Address()
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+	return keys
+}
+
+func newAuthorityChain(t *testing.T, keys []crypto.PrivateKey) *BlockChain {
+	validators := make([]types.Address, len(keys))
+	for i, key := range keys {
+		validators[i] = key.PublicKey().Address()
+	}
+
+	genesis, err := NewAuthorityGenesisBlock(uint64(time.Now().UnixNano()), nil, validators)
+	assert.Nil(t, err)
+	bc, err := NewBlockChain(genesis)
+	assert.Nil(t, err)
+	return bc
+}
+
+// authorityBlock builds the next block of the chain produced by key.
+func authorityBlock(t *testing.T, bc *BlockChain, key crypto.PrivateKey, txx ...*Transaction) *Block {
+	prev, err := bc.GetHeader(bc.Height())
+	assert.Nil(t, err)
+
+	state := bc.State()
+	included := make([]Transaction, len(txx))
+	for i, tx := range txx {
+		assert.Nil(t, state.ApplyTransaction(tx, prev.Height+1, key.PublicKey().Address()))
+		included[i] = *tx
+	}
+
+	b, err := NewBlockFromHeader(prev, included)
+	assert.Nil(t, err)
+	b.StateRoot = state.Root()
+	assert.Nil(t, b.Sign(key))
+	return b
+}
+
+func validatorVote(t *testing.T, key crypto.PrivateKey, validator types.Address, add bool, nonce uint64) *Transaction {
+	tx := &Transaction{Type: TxTypeRemoveValidator, To: validator, Nonce: nonce}
+	if add {
+		tx.Type = TxTypeAddValidator
+	}
+	assert.Nil(t, tx.Sign(key))
+	return tx
+}
+
+func TestAuthorityGenesis(t *testing.T) {
+	keys := authorityKeys(3)
+	bc := newAuthorityChain(t, keys)
+
+	validators := bc.State().Validators()
+	assert.Len(t, validators, 3)
+	for height := uint32(1); height <= 6; height++ {
+		proposer, ok := bc.State().Proposer(height)
+		assert.True(t, ok)
+		assert.Equal(t, keys[int(height)%3].PublicKey().Address(), proposer)
+	}
+
+	// an open chain has no proposer
+	_, ok := NewState().Proposer(1)
+	assert.False(t, ok)
+}
+
+func TestAuthorityRejectsBlocks(t *testing.T) {
+	keys := authorityKeys(3)
+	bc := newAuthorityChain(t, keys)
+
+	assert.NotNil(t, bc.AddBlock(authorityBlock(t, bc, crypto.GeneratePrivateKey())))
+	assert.NotNil(t, bc.AddBlock(authorityBlock(t, bc, keys[2])))
+	assert.Equal(t, uint32(0), bc.Height())
+
+	for height := 1; height <= 4; height++ {
+		proposer, ok := bc.NextProposer()
+		assert.True(t, ok)
+		assert.Equal(t, keys[height%3].PublicKey().Address(), proposer)
+		assert.Nil(t, bc.AddBlock(authorityBlock(t, bc, keys[height%3])))
+	}
+	assert.Equal(t, uint32(4), bc.Height())
+}
+
+func TestValidatorGovernance(t *testing.T) {
+	keys := authorityKeys(3)
+	bc := newAuthorityChain(t, keys)
+	newcomer := crypto.GeneratePrivateKey().PublicKey().Address()
+	state := bc.State()
+
+	// outsiders cannot vote
+	assert.NotNil(t, state.ApplyTransaction(validatorVote(t, crypto.GeneratePrivateKey(), newcomer, true, 0), 1, types.Address{}))
+
+	// a single vote out of three is not enough, and counts only once
+	assert.Nil(t, state.ApplyTransaction(validatorVote(t, keys[0], newcomer, true, 0), 1, types.Address{}))
+	assert.NotNil(t, state.ApplyTransaction(validatorVote(t, keys[0], newcomer, true, 1), 1, types.Address{}))
+	assert.False(t, state.IsValidator(newcomer))
+	assert.Equal(t, []types.Address{keys[0].PublicKey().Address()}, state.Votes(ValidatorProposal{Validator: newcomer, Add: true}))
+
+	assert.Nil(t, state.ApplyTransaction(validatorVote(t, keys[1], newcomer, true, 0), 1, types.Address{}))
+	assert.True(t, state.IsValidator(newcomer))
+	assert.Len(t, state.Validators(), 4)
+	assert.Empty(t, state.Votes(ValidatorProposal{Validator: newcomer, Add: true}))
+
+	// removing needs three of the four validators now
+	removed := keys[2].PublicKey().Address()
+	for i, nonce := range []uint64{1, 1, 0} {
+		assert.True(t, state.IsValidator(removed))
+		assert.Nil(t, state.ApplyTransaction(validatorVote(t, keys[i], removed, false, nonce), 1, types.Address{}))
+	}
+	assert.False(t, state.IsValidator(removed))
+	assert.Len(t, state.Validators(), 3)
+}
+
+func TestCannotRemoveLastValidator(t *testing.T) {
+	keys := authorityKeys(1)
+	state := newAuthorityChain(t, keys).State()
+
+	assert.NotNil(t, state.ApplyTransaction(validatorVote(t, keys[0], keys[0].PublicKey().Address(), false, 0), 1, types.Address{}))
+	assert.True(t, state.IsValidator(keys[0].PublicKey().Address()))
+}
+
+func TestGovernanceInBlocks(t *testing.T) {
+	keys := authorityKeys(2)
+	bc := newAuthorityChain(t, keys)
+	newcomer := authorityKeys(1)[0]
+	root := bc.State().Root()
+
+	// with two validators both must vote
+	assert.Nil(t, bc.AddBlock(authorityBlock(t, bc, keys[1], validatorVote(t, keys[0], newcomer.PublicKey().Address(), true, 0))))
+	assert.NotEqual(t, root, bc.State().Root())
+	assert.Nil(t, bc.AddBlock(authorityBlock(t, bc, keys[0], validatorVote(t, keys[1], newcomer.PublicKey().Address(), true, 0))))
+	assert.Len(t, bc.State().Validators(), 3)
+
+	// the newcomer takes its turn
+	proposer, ok := bc.NextProposer()
+	assert.True(t, ok)
+	for _, key := range append(keys, newcomer) {
+		if key.PublicKey().Address() == proposer {
+			assert.Nil(t, bc.AddBlock(authorityBlock(t, bc, key)))
+		}
+	}
+	assert.Equal(t, uint32(3), bc.Height())
+}
+
+func TestRevertBlockRestoresValidators(t *testing.T) {
+	keys := authorityKeys(1)
+	bc := newAuthorityChain(t, keys)
+	newcomer := crypto.GeneratePrivateKey().PublicKey().Address()
+
+	state := bc.State()
+	root := state.Root()
+	b := authorityBlock(t, bc, keys[0], validatorVote(t, keys[0], newcomer, true, 0))
+
+	undo, err := state.applyBlock(b, ProofOfAuthority{})
+	assert.Nil(t, err)
+	assert.True(t, state.IsValidator(newcomer))
+
+	state.revertBlock(undo)
+	assert.False(t, state.IsValidator(newcomer))
+	assert.Equal(t, root, state.Root())
+}
@@ -12,15 +12,24 @@ package core
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"encoding/gob"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/JoaoRafa19/crypto-go/crypto"
 	"github.com/JoaoRafa19/crypto-go/types"
 )
 
+const (
+	// HeaderVersionMerkle headers commit to the Merkle root of the
+	// transaction hashes, so a single transaction can be proven. It is the
+	// only version accepted.
+	HeaderVersionMerkle uint32 = 2
+
+	// HeaderVersion is the version of the headers built by this node.
+	HeaderVersion = HeaderVersionMerkle
+)
+
 // To save space we just hash the header
 type Header struct {
 	Version       uint32
@@ -28,14 +37,18 @@ type Header struct {
 	Timestamp     uint64
 	Height        uint32
 	DataHash      types.Hash
+	// StateRoot is the root of the account state after the block
+	StateRoot types.Hash
+	// Difficulty and Nonce are the proof of work of the block, both zero
+	// when the chain does not use it
+	Difficulty uint64
+	Nonce      uint64
 }
 
+// Bytes returns the canonical encoding of the header, which is what gets
+// hashed and signed.
 func (h *Header) Bytes() []byte {
-	buf := &bytes.Buffer{}
-
-	enc := gob.NewEncoder(buf)
-	enc.Encode(h)
-	return buf.Bytes()
+	return MarshalHeader(h)
 }
 
 // Hold the transactions and the header information
@@ -44,8 +57,10 @@ type Block struct {
 	Transactions []Transaction
 	Validator    crypto.PublicKey
 	Signature    *crypto.Signature
+	// Certificate proves the block was committed by the validators of a
+	// BFT chain. Like the signature it is not part of the hash.
+	Certificate *CommitCertificate
 
-	//nonce uint32
 	// cached version of the header hash
 	hash types.Hash
 }
@@ -64,16 +79,55 @@ func NewBlockFromHeader(prevHeader *Header, txx []Transaction) (*Block, error) {
 	}
 
 	header := &Header{
-		Version:       1,
+		Version:       HeaderVersion,
 		Height:        prevHeader.Height + 1,
 		DataHash:      dataHash,
 		PrevBlockHash: BlockHasher{}.Hash(prevHeader),
 		Timestamp:     uint64(time.Now().UnixNano()),
+		// blocks that move no value keep the state of their parent, the
+		// producer sets the new root otherwise
+		StateRoot: prevHeader.StateRoot,
 	}
 
 	return NewBlock(header, txx)
 }
 
+// NewGenesisBlock builds the first block of a chain. Every address of alloc
+// receives its balance through a mint transaction, in address order so all
+// nodes build the same block.
+func NewGenesisBlock(timestamp uint64, alloc map[types.Address]uint64) (*Block, error) {
+	addrs := make([]types.Address, 0, len(alloc))
+	for addr := range alloc {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+
+	state := NewState()
+	txx := make([]Transaction, len(addrs))
+	for i, addr := range addrs {
+		txx[i] = Transaction{Type: TxTypeMint, To: addr, Value: alloc[addr]}
+		if err := state.ApplyTransaction(&txx[i], 0, types.Address{}); err != nil {
+			return nil, err
+		}
+	}
+
+	dataHash, err := CalculateDataHash(txx)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &Header{
+		Version:   HeaderVersion,
+		DataHash:  dataHash,
+		Timestamp: timestamp,
+		Height:    0,
+		StateRoot: state.Root(),
+	}
+	return NewBlock(header, txx)
+}
+
 func (b *Block) AddTransaction(tx *Transaction) {
 	b.Transactions = append(b.Transactions, *tx)
 }
@@ -83,7 +137,7 @@ func (b *Block) Verify() error {
 		return fmt.Errorf("block has no signature")
 	}
 
-	if !b.Signature.Verify(b.Validator, b.Header.Bytes()) {
+	if !b.Signature.Verify(b.Validator, crypto.DomainBlockHeader, b.Header.Bytes()) {
 		return fmt.Errorf("block has invalid signature")
 	}
 
@@ -93,6 +147,10 @@ func (b *Block) Verify() error {
 		}
 	}
 
+	if b.Version != HeaderVersionMerkle {
+		return fmt.Errorf("block %s has unsupported header version (%d)", b.Hash(BlockHasher{}), b.Version)
+	}
+
 	hash, err := CalculateDataHash(b.Transactions)
 	if err != nil {
 		return err
@@ -106,7 +164,7 @@ func (b *Block) Verify() error {
 }
 
 func (b *Block) Sign(privKey crypto.PrivateKey) error {
-	sig, err := privKey.Sign(b.Header.Bytes())
+	sig, err := privKey.Sign(crypto.DomainBlockHeader, b.Header.Bytes())
 	if err != nil {
 		return err
 	}
@@ -131,17 +189,33 @@ func (b *Block) Hash(hasher Hasher[*Header]) types.Hash {
 	return b.hash
 }
 
-func CalculateDataHash(txx []Transaction) (hash types.Hash, err error) {
-	var (
-		buf = &bytes.Buffer{}
-	)
+// TxProof returns the Merkle inclusion proof of the transaction at index,
+// to be checked against the block DataHash with VerifyTxProof.
+func (b *Block) TxProof(index int) (*MerkleProof, error) {
+	if b.Version != HeaderVersionMerkle {
+		return nil, fmt.Errorf("block version (%d) does not support transaction proofs", b.Version)
+	}
+	return NewMerkleProof(txLeaves(b.Transactions), index)
+}
 
-	for _, tx := range txx {
-		if err = tx.Encode(NewGobEncoder(buf)); err != nil {
-			return
-		}
+// VerifyTxProof checks that the transaction with the given hash is included
+// in the block of header h.
+func VerifyTxProof(h *Header, txHash types.Hash, proof *MerkleProof) bool {
+	if h.Version != HeaderVersionMerkle {
+		return false
 	}
+	return proof.Verify(txHash, h.DataHash)
+}
 
-	hash = sha256.Sum256(buf.Bytes())
-	return
+// CalculateDataHash returns the Merkle root of the transaction hashes.
+func CalculateDataHash(txx []Transaction) (types.Hash, error) {
+	return MerkleRoot(txLeaves(txx)), nil
+}
+
+func txLeaves(txx []Transaction) []types.Hash {
+	leaves := make([]types.Hash, len(txx))
+	for i := range txx {
+		leaves[i] = txx[i].Hash(TxHasher{})
+	}
+	return leaves
 }
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"bytes"
 	"testing"
 	"time"
 
@@ -32,14 +33,113 @@ func TestVerifyBlock(t *testing.T) {
 	assert.NotNil(t, b.Verify())
 }
 
+func TestVerifyEd25519Block(t *testing.T) {
+	priv, err := crypto.GenerateKey(crypto.KeyTypeEd25519)
+	assert.Nil(t, err)
+	b := randomBlock(t, 0, types.Hash{})
+
+	assert.Nil(t, b.Sign(priv))
+	assert.Nil(t, b.Verify())
+
+	decoded, err := UnmarshalBlock(MarshalBlock(b))
+	assert.Nil(t, err)
+	assert.Equal(t, crypto.KeyTypeEd25519, decoded.Validator.Type())
+	assert.Nil(t, decoded.Verify())
+
+	b.Height = 100
+	assert.NotNil(t, b.Verify())
+}
+
+func TestVerifyRejectsLegacyBlock(t *testing.T) {
+	b := randomBlock(t, 0, types.Hash{})
+	b.Version = 1
+	assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+	assert.NotNil(t, b.Verify())
+
+	_, err := b.TxProof(0)
+	assert.NotNil(t, err)
+}
+
+func TestBlockTxProof(t *testing.T) {
+	txx := []Transaction{}
+	for i := 0; i < 5; i++ {
+		tx := NewTransaction([]byte{byte(i)})
+		assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+		txx = append(txx, *tx)
+	}
+	b := blockWithTransactions(t, 1, types.Hash{}, txx)
+	assert.Nil(t, b.Verify())
+
+	for i := range txx {
+		proof, err := b.TxProof(i)
+		assert.Nil(t, err)
+		assert.True(t, VerifyTxProof(b.Header, txx[i].Hash(TxHasher{}), proof))
+	}
+
+	proof, err := b.TxProof(0)
+	assert.Nil(t, err)
+	assert.False(t, VerifyTxProof(b.Header, txx[1].Hash(TxHasher{}), proof))
+}
+
+func TestBlockEncodeDecode(t *testing.T) {
+	codecs := map[string]func(*bytes.Buffer) (Encoder[*Block], Decoder[*Block]){
+		"gob": func(buf *bytes.Buffer) (Encoder[*Block], Decoder[*Block]) {
+			return NewGobBlockEncoder(buf), NewGobBlockDecoder(buf)
+		},
+		"binary": func(buf *bytes.Buffer) (Encoder[*Block], Decoder[*Block]) {
+			return NewBinaryBlockEncoder(buf), NewBinaryBlockDecoder(buf)
+		},
+	}
+
+	for name, codec := range codecs {
+		t.Run(name, func(t *testing.T) {
+			b := randomBlock(t, 1, types.Hash{})
+			buf := &bytes.Buffer{}
+			enc, dec := codec(buf)
+
+			assert.Nil(t, b.Encode(enc))
+
+			decoded := new(Block)
+			assert.Nil(t, decoded.Decode(dec))
+			assert.Equal(t, b.Header, decoded.Header)
+			assert.Equal(t, b.Signature, decoded.Signature)
+			assert.Equal(t, b.Validator.ToBytes(), decoded.Validator.ToBytes())
+			assert.Equal(t, b.Hash(BlockHasher{}), decoded.Hash(BlockHasher{}))
+			assert.Len(t, decoded.Transactions, len(b.Transactions))
+			assert.Nil(t, decoded.Verify())
+		})
+	}
+}
+
+func TestBinaryBlockStream(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := NewBinaryBlockEncoder(buf)
+
+	blocks := []*Block{randomBlock(t, 1, types.Hash{}), randomBlock(t, 2, types.Hash{})}
+	for _, b := range blocks {
+		assert.Nil(t, b.Encode(enc))
+	}
+
+	dec := NewBinaryBlockDecoder(buf)
+	for _, b := range blocks {
+		decoded := new(Block)
+		assert.Nil(t, decoded.Decode(dec))
+		assert.Equal(t, b.Hash(BlockHasher{}), decoded.Hash(BlockHasher{}))
+	}
+
+	assert.NotNil(t, new(Block).Decode(dec))
+}
+
 func randomBlock(t *testing.T, height uint32, prevBlockHas types.Hash) *Block {
 	privKey := crypto.GeneratePrivateKey()
 	tx := randomTxWithSignature(t)
 	header := &Header{
-		Version:       1,
+		Version:       HeaderVersion,
 		PrevBlockHash: prevBlockHas,
 		Height:        height,
 		Timestamp:     uint64(time.Now().UnixNano()),
+		// data transactions leave the state empty
+		StateRoot: NewState().Root(),
 	}
 
 	b, err := NewBlock(header, []Transaction{tx})
@@ -14,46 +14,257 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/JoaoRafa19/crypto-go/types"
 	"github.com/sirupsen/logrus"
 )
 
+// MaxReorgDepth is how far below the tip a side branch may fork from the
+// canonical chain. Side branches forking deeper are dropped, so they cannot
+// grow the block tree kept in memory without bound.
+const MaxReorgDepth = 64
+
+// MaxSideBlocks caps the number of side branch blocks kept in memory.
+const MaxSideBlocks = 1024
 
 type BlockChain struct {
-	Store     Storage
-	Lock      sync.RWMutex
-	Headers   []*Header
-	Validator Validator
+	Store      Storage
+	Lock       sync.RWMutex
+	Headers    []*Header
+	Validator  Validator
+	TxIndex    *TxIndex
+	ForkChoice ForkChoice
+	// Engine is the consensus algorithm the blocks are produced and
+	// checked with
+	Engine Engine
+	// ChainID is the network every transaction of the chain must be
+	// signed for
+	ChainID uint32
+
+	// addLock serializes the writers of the chain
+	addLock   sync.Mutex
+	tree      map[types.Hash]*blockNode
+	tip       *blockNode
+	listeners []ChainListener
+	// pruned is the height below which the side branches were dropped
+	pruned uint32
+	// state is the account state at the tip
+	state *State
 }
 
 func NewBlockChain(genesis *Block) (*BlockChain, error) {
+	return NewBlockChainWithStore(NewMemStore(), genesis)
+}
+
+// NewBlockChainWithStore creates a proof-of-authority chain backed by the
+// given storage. If the storage already holds blocks their headers are
+// loaded and the stored genesis must match the given one.
+func NewBlockChainWithStore(store Storage, genesis *Block) (*BlockChain, error) {
+	return NewBlockChainWithEngine(store, genesis, ProofOfAuthority{})
+}
+
+// NewBlockChainWithEngine creates a chain backed by the given storage whose
+// blocks follow the given consensus engine. The stored blocks are replayed
+// with it, so the engine cannot be changed later. An engine that is also a
+// ForkChoice weighs the branches.
+func NewBlockChainWithEngine(store Storage, genesis *Block, engine Engine) (*BlockChain, error) {
 	bc := &BlockChain{
-		Headers: []*Header{},
-		Store:   NewMemStore(),
+		Headers:    []*Header{},
+		Store:      store,
+		TxIndex:    NewTxIndex(),
+		ForkChoice: LongestChain{},
+		Engine:     engine,
+		tree:       make(map[types.Hash]*blockNode),
+		state:      NewState(),
 	}
 	bc.Validator = NewBlockValidator(bc)
+	if fc, ok := engine.(ForkChoice); ok {
+		bc.ForkChoice = fc
+	}
+
+	if store.Len() > 0 {
+		stored, err := store.GetByHeight(0)
+		if err != nil {
+			return nil, err
+		}
+		if stored.Hash(BlockHasher{}) != genesis.Hash(BlockHasher{}) {
+			return nil, fmt.Errorf("stored genesis (%s) does not match the given genesis (%s)", stored.Hash(BlockHasher{}), genesis.Hash(BlockHasher{}))
+		}
+
+		// the state is not stored, it is rebuilt by replaying the blocks
+		var applyErr error
+		err = store.Range(0, uint32(store.Len()-1), func(b *Block) bool {
+			undo, err := bc.applyState(b)
+			if err != nil {
+				applyErr = err
+				return false
+			}
+			bc.linkCanonical(b, undo)
+			return true
+		})
+		if err == nil {
+			err = applyErr
+		}
+		return bc, err
+	}
+
 	err := bc.addBlockWithoutValidation(genesis)
 
 	return bc, err
-
 }
 
 func (bc *BlockChain) SetValidator(v Validator) {
 	bc.Validator = v
 }
+
+func (bc *BlockChain) SetForkChoice(fc ForkChoice) {
+	bc.ForkChoice = fc
+}
+
+func (bc *BlockChain) SetChainID(id uint32) {
+	bc.ChainID = id
+}
+
+// Subscribe registers a listener for changes of the canonical chain.
+func (bc *BlockChain) Subscribe(l ChainListener) {
+	bc.addLock.Lock()
+	defer bc.addLock.Unlock()
+	bc.listeners = append(bc.listeners, l)
+}
+
+// AddBlock validates the block and inserts it in the block tree. A block on
+// top of the tip extends the chain, a block on another branch is kept and
+// triggers a reorganization once its branch outweighs the current one.
 func (bc *BlockChain) AddBlock(b *Block) error {
+	bc.addLock.Lock()
+	defer bc.addLock.Unlock()
+
 	//validate
 	err := bc.Validator.ValidateBlock(b)
 	if err != nil {
 		return err
 	}
 
-	return bc.addBlockWithoutValidation(b)
+	bc.Lock.RLock()
+	parent, ok := bc.tree[b.PrevBlockHash]
+	tip := bc.tip
+	bc.Lock.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("parent (%s) of block (%s) is unknown", b.PrevBlockHash, b.Hash(BlockHasher{}))
+	}
+
+	if parent == tip {
+		if err := bc.addBlockWithoutValidation(b); err != nil {
+			return err
+		}
+		bc.prune()
+		bc.notify(ChainEvent{Applied: []*Block{b}})
+		return nil
+	}
+
+	node := newBlockNode(b.Hash(BlockHasher{}), b.Header, parent, bc.ForkChoice.Weight(b.Header))
+	node.block = b
+
+	bc.Lock.Lock()
+	fork := parent
+	for !fork.canonical {
+		fork = fork.parent
+	}
+	if fork.header.Height+MaxReorgDepth < tip.header.Height {
+		bc.Lock.Unlock()
+		return fmt.Errorf("block (%s) forks at height (%d), more than (%d) blocks below the tip", node.hash, fork.header.Height, MaxReorgDepth)
+	}
+	if len(bc.tree)-len(bc.Headers) >= MaxSideBlocks {
+		bc.Lock.Unlock()
+		return fmt.Errorf("block (%s) exceeds the limit of (%d) side branch blocks", node.hash, MaxSideBlocks)
+	}
+	bc.insertNode(node)
+	bc.Lock.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"height": b.Height,
+		"hash":   node.hash,
+	}).Info("adding side branch block")
+
+	if node.weight.Cmp(tip.weight) > 0 {
+		if err := bc.reorganize(node); err != nil {
+			return err
+		}
+		bc.prune()
+	}
+	return nil
+}
+
+// insertNode adds the node to the block tree. The caller holds bc.Lock.
+func (bc *BlockChain) insertNode(node *blockNode) {
+	bc.tree[node.hash] = node
+	if node.parent != nil {
+		node.parent.children = append(node.parent.children, node)
+	}
+}
+
+// removeSubtree drops the node and all of its descendants from the block
+// tree. The caller holds bc.Lock.
+func (bc *BlockChain) removeSubtree(node *blockNode) {
+	if parent := node.parent; parent != nil {
+		for i, child := range parent.children {
+			if child == node {
+				parent.children = append(parent.children[:i], parent.children[i+1:]...)
+				break
+			}
+		}
+	}
+
+	stack := []*blockNode{node}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = append(stack[:len(stack)-1], n.children...)
+		delete(bc.tree, n.hash)
+	}
+}
+
+// prune drops the side branches forking more than MaxReorgDepth blocks
+// below the tip.
+func (bc *BlockChain) prune() {
+	bc.Lock.Lock()
+	defer bc.Lock.Unlock()
+
+	height := bc.tip.header.Height
+	if height <= MaxReorgDepth {
+		return
+	}
+	cutoff := height - MaxReorgDepth
+
+	node := bc.tip
+	for node != nil && node.header.Height >= cutoff {
+		node = node.parent
+	}
+	for ; node != nil && node.header.Height >= bc.pruned; node = node.parent {
+		for _, child := range append([]*blockNode{}, node.children...) {
+			if !child.canonical {
+				bc.removeSubtree(child)
+			}
+		}
+	}
+	if cutoff > bc.pruned {
+		bc.pruned = cutoff
+	}
 }
 
 func (bc *BlockChain) HasBlock(heigh uint32) bool {
 	return heigh <= bc.Height()
 }
 
+// HasBlockHash reports whether the block is known, either in the canonical
+// chain or in a side branch.
+func (bc *BlockChain) HasBlockHash(hash types.Hash) bool {
+	bc.Lock.RLock()
+	defer bc.Lock.RUnlock()
+
+	_, ok := bc.tree[hash]
+	return ok
+}
+
 // [g, 1, 2, 3] = len 4 ; heigh = 3
 func (bc *BlockChain) Height() uint32 {
 	bc.Lock.RLock()
@@ -61,17 +272,273 @@ func (bc *BlockChain) Height() uint32 {
 	return uint32(len(bc.Headers) - 1)
 }
 
+// addBlockWithoutValidation appends the block on top of the canonical chain.
+// The signatures are not checked but the state transition is, as it can only
+// be checked on top of the parent state.
 func (bc *BlockChain) addBlockWithoutValidation(b *Block) error {
-	bc.Lock.Lock()
-	bc.Headers = append(bc.Headers, b.Header)
-	bc.Lock.Unlock()
+	undo, err := bc.applyState(b)
+	if err != nil {
+		return err
+	}
+
+	// the block must be durable before it becomes part of the chain
+	if err := bc.Store.Put(b); err != nil {
+		bc.state.revertBlock(undo)
+		return err
+	}
+
+	bc.linkCanonical(b, undo)
 
 	logrus.WithFields(logrus.Fields{
 		"height": b.Height,
 		"hash":   b.Hash(BlockHasher{}),
 	}).Info("adding new block")
 
-	return bc.Store.Put(b)
+	return nil
+}
+
+// applyState applies the block to the tip state and checks the state root
+// committed in its header.
+func (bc *BlockChain) applyState(b *Block) (*stateUndo, error) {
+	// the index holds the transactions of the chain up to the parent, so
+	// a transaction found there is a replay
+	for i := range b.Transactions {
+		hash := b.Transactions[i].Hash(TxHasher{})
+		if loc, ok := bc.TxIndex.Get(hash); ok {
+			return nil, fmt.Errorf("transaction (%s) was already included in block (%s)", hash, loc.BlockHash)
+		}
+	}
+
+	undo, err := bc.state.applyBlock(b, bc.Engine)
+	if err != nil {
+		return nil, err
+	}
+
+	if root := bc.state.Root(); root != b.StateRoot {
+		bc.state.revertBlock(undo)
+		return nil, fmt.Errorf("block (%s) has state root (%s), expected (%s)", b.Hash(BlockHasher{}), b.StateRoot, root)
+	}
+	return undo, nil
+}
+
+// linkCanonical makes an already stored and applied block the new tip.
+func (bc *BlockChain) linkCanonical(b *Block, undo *stateUndo) {
+	hash := b.Hash(BlockHasher{})
+
+	bc.Lock.Lock()
+	node, ok := bc.tree[hash]
+	if !ok {
+		node = newBlockNode(hash, b.Header, bc.tip, bc.ForkChoice.Weight(b.Header))
+		bc.insertNode(node)
+	}
+	node.block = nil
+	node.undo = undo
+	node.canonical = true
+	bc.tip = node
+	bc.Headers = append(bc.Headers, b.Header)
+	bc.Lock.Unlock()
+
+	bc.TxIndex.Add(b)
+}
+
+// unlinkTip removes the tip from the canonical chain, keeping it as a side
+// branch block, and returns it.
+func (bc *BlockChain) unlinkTip() (*Block, error) {
+	bc.Lock.RLock()
+	node := bc.tip
+	bc.Lock.RUnlock()
+
+	b, err := bc.Store.GetByHeight(node.header.Height)
+	if err != nil {
+		return nil, err
+	}
+	if err := bc.Store.Rollback(node.header.Height - 1); err != nil {
+		return nil, err
+	}
+
+	bc.state.revertBlock(node.undo)
+
+	bc.Lock.Lock()
+	node.block = b
+	node.undo = nil
+	node.canonical = false
+	bc.tip = node.parent
+	bc.Headers = bc.Headers[:len(bc.Headers)-1]
+	bc.Lock.Unlock()
+
+	bc.TxIndex.Remove(b)
+	return b, nil
+}
+
+// reorganize rolls the chain back to the common ancestor of the current tip
+// and newTip and applies the branch ending at newTip. If a block of the new
+// branch cannot be applied the old branch is restored.
+func (bc *BlockChain) reorganize(newTip *blockNode) error {
+	branch := []*blockNode{}
+	ancestor := newTip
+	for !ancestor.canonical {
+		branch = append(branch, ancestor)
+		ancestor = ancestor.parent
+	}
+
+	reverted := []*Block{}
+	for bc.tip != ancestor {
+		b, err := bc.unlinkTip()
+		if err != nil {
+			return err
+		}
+		reverted = append(reverted, b)
+	}
+
+	applied := []*Block{}
+	for i := len(branch) - 1; i >= 0; i-- {
+		b := branch[i].block
+		if err := bc.addBlockWithoutValidation(b); err != nil {
+			// the failed block and all of its descendants can never join
+			// the chain
+			bc.Lock.Lock()
+			bc.removeSubtree(branch[i])
+			bc.Lock.Unlock()
+
+			if rerr := bc.restore(ancestor, reverted); rerr != nil {
+				return fmt.Errorf("reorganization failed (%s) and the old branch could not be restored: %s", err, rerr)
+			}
+			return fmt.Errorf("reorganization to block (%s) failed: %s", newTip.hash, err)
+		}
+		applied = append(applied, b)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"ancestor": ancestor.hash,
+		"reverted": len(reverted),
+		"applied":  len(applied),
+		"tip":      newTip.hash,
+	}).Info("chain reorganized")
+
+	bc.notify(ChainEvent{Reverted: reverted, Applied: applied})
+	return nil
+}
+
+// restore goes back to ancestor and re-applies the blocks of the old branch,
+// given from the old tip down.
+func (bc *BlockChain) restore(ancestor *blockNode, reverted []*Block) error {
+	for bc.tip != ancestor {
+		if _, err := bc.unlinkTip(); err != nil {
+			return err
+		}
+	}
+
+	for i := len(reverted) - 1; i >= 0; i-- {
+		if err := bc.addBlockWithoutValidation(reverted[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bc *BlockChain) notify(ev ChainEvent) {
+	for _, l := range bc.listeners {
+		l(ev)
+	}
+}
+
+func (bc *BlockChain) tipHash() types.Hash {
+	bc.Lock.RLock()
+	defer bc.Lock.RUnlock()
+	return bc.tip.hash
+}
+
+// GetAccount returns the account of addr at the tip of the chain.
+func (bc *BlockChain) GetAccount(addr types.Address) Account {
+	return bc.state.GetAccount(addr)
+}
+
+// GetMultisigPolicy returns the multisig policy registered at the tip of the
+// chain for the account at addr.
+func (bc *BlockChain) GetMultisigPolicy(addr types.Address) (*MultisigPolicy, bool) {
+	return bc.state.GetMultisigPolicy(addr)
+}
+
+// NextProposer returns the validator whose turn it is to produce the block
+// on top of the tip, false when the chain has no validator set.
+func (bc *BlockChain) NextProposer() (types.Address, bool) {
+	return bc.state.Proposer(bc.Height() + 1)
+}
+
+// State returns a copy of the state at the tip of the chain, on which the
+// transactions of the next block can be tried.
+func (bc *BlockChain) State() *State {
+	return bc.state.Copy()
+}
+
+// GetBlock returns the full block (transactions, validator and signature)
+// at the given height.
+func (bc *BlockChain) GetBlock(height uint32) (*Block, error) {
+	if height > bc.Height() {
+		return nil, fmt.Errorf("height (%+v) is too high", height)
+	}
+	return bc.Store.GetByHeight(height)
+}
+
+// GetBlockByHash returns a block of the canonical chain or of a side branch.
+func (bc *BlockChain) GetBlockByHash(hash types.Hash) (*Block, error) {
+	bc.Lock.RLock()
+	node, ok := bc.tree[hash]
+	bc.Lock.RUnlock()
+
+	if ok && node.block != nil {
+		return node.block, nil
+	}
+	return bc.Store.Get(hash)
+}
+
+// GetHeaderByHash returns the header of a known block, canonical or not.
+func (bc *BlockChain) GetHeaderByHash(hash types.Hash) (*Header, error) {
+	bc.Lock.RLock()
+	defer bc.Lock.RUnlock()
+
+	node, ok := bc.tree[hash]
+	if !ok {
+		return nil, fmt.Errorf("block (%s) not found", hash)
+	}
+	return node.header, nil
+}
+
+// GetTransaction returns an included transaction together with the block
+// and position it was included at.
+func (bc *BlockChain) GetTransaction(hash types.Hash) (*Transaction, TxLocation, error) {
+	loc, ok := bc.TxIndex.Get(hash)
+	if !ok {
+		return nil, TxLocation{}, fmt.Errorf("transaction (%s) not found", hash)
+	}
+
+	b, err := bc.Store.Get(loc.BlockHash)
+	if err != nil {
+		return nil, TxLocation{}, err
+	}
+
+	return &b.Transactions[loc.Index], loc, nil
+}
+
+// GetTransactionProof returns the Merkle proof that the transaction is
+// included in its block, along with the location of that block.
+func (bc *BlockChain) GetTransactionProof(hash types.Hash) (*MerkleProof, TxLocation, error) {
+	loc, ok := bc.TxIndex.Get(hash)
+	if !ok {
+		return nil, TxLocation{}, fmt.Errorf("transaction (%s) not found", hash)
+	}
+
+	b, err := bc.Store.Get(loc.BlockHash)
+	if err != nil {
+		return nil, TxLocation{}, err
+	}
+
+	proof, err := b.TxProof(int(loc.Index))
+	if err != nil {
+		return nil, TxLocation{}, err
+	}
+
+	return proof, loc, nil
 }
 
 func (bc *BlockChain) GetHeader(height uint32) (*Header, error) {
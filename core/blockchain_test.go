@@ -3,7 +3,9 @@ package core
 import (
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/JoaoRafa19/crypto-go/crypto"
 	"github.com/JoaoRafa19/crypto-go/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -68,3 +70,102 @@ func getPrevBlockHash(t *testing.T, bc *BlockChain, height uint32) types.Hash {
 	assert.Nil(t, err)
 	return BlockHasher{}.Hash(prevHeader)
 }
+
+func TestGetBlock(t *testing.T) {
+	bc := newBlockChainWithGenesis(t)
+
+	for i := 1; i <= 10; i++ {
+		block := randomBlock(t, uint32(i), getPrevBlockHash(t, bc, uint32(i)))
+		assert.Nil(t, bc.AddBlock(block))
+
+		fetched, err := bc.GetBlock(block.Height)
+		assert.Nil(t, err)
+		assert.Equal(t, block, fetched)
+
+		fetched, err = bc.GetBlockByHash(block.Hash(BlockHasher{}))
+		assert.Nil(t, err)
+		assert.Equal(t, block, fetched)
+	}
+
+	_, err := bc.GetBlock(11)
+	assert.NotNil(t, err)
+	_, err = bc.GetBlockByHash(types.Hash{})
+	assert.NotNil(t, err)
+}
+
+func TestGetTransaction(t *testing.T) {
+	bc := newBlockChainWithGenesis(t)
+
+	txx := []Transaction{}
+	for i := 0; i < 3; i++ {
+		tx := NewTransaction([]byte(fmt.Sprintf("tx %d", i)))
+		assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+		txx = append(txx, *tx)
+	}
+
+	block := blockWithTransactions(t, 1, getPrevBlockHash(t, bc, 1), txx)
+	assert.Nil(t, bc.AddBlock(block))
+
+	for i := range txx {
+		tx, loc, err := bc.GetTransaction(txx[i].Hash(TxHasher{}))
+		assert.Nil(t, err)
+		assert.Equal(t, txx[i].Data, tx.Data)
+		assert.Equal(t, block.Hash(BlockHasher{}), loc.BlockHash)
+		assert.Equal(t, uint32(1), loc.Height)
+		assert.Equal(t, uint32(i), loc.Index)
+	}
+
+	_, _, err := bc.GetTransaction(types.Hash{})
+	assert.NotNil(t, err)
+
+	proof, loc, err := bc.GetTransactionProof(txx[2].Hash(TxHasher{}))
+	assert.Nil(t, err)
+	header, err := bc.GetHeader(loc.Height)
+	assert.Nil(t, err)
+	assert.True(t, VerifyTxProof(header, txx[2].Hash(TxHasher{}), proof))
+}
+
+func TestBlockChainRejectsReplays(t *testing.T) {
+	bc := newBlockChainWithGenesis(t)
+	bc.SetChainID(7)
+
+	tx := &Transaction{ChainID: 7, Data: []byte("once")}
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, bc.AddBlock(blockWithTransactions(t, 1, getPrevBlockHash(t, bc, 1), []Transaction{*tx})))
+
+	// the same transaction in a later block
+	assert.NotNil(t, bc.AddBlock(blockWithTransactions(t, 2, getPrevBlockHash(t, bc, 2), []Transaction{*tx})))
+
+	// twice in the same block
+	twice := &Transaction{ChainID: 7, Data: []byte("twice")}
+	assert.Nil(t, twice.Sign(crypto.GeneratePrivateKey()))
+	assert.NotNil(t, bc.AddBlock(blockWithTransactions(t, 2, getPrevBlockHash(t, bc, 2), []Transaction{*twice, *twice})))
+
+	// signed for another chain
+	foreign := &Transaction{ChainID: 8, Data: []byte("foreign")}
+	assert.Nil(t, foreign.Sign(crypto.GeneratePrivateKey()))
+	assert.NotNil(t, bc.AddBlock(blockWithTransactions(t, 2, getPrevBlockHash(t, bc, 2), []Transaction{*foreign})))
+
+	assert.Equal(t, uint32(1), bc.Height())
+}
+
+func blockWithTransactions(t *testing.T, height uint32, prevBlockHash types.Hash, txx []Transaction) *Block {
+	header := &Header{
+		Version:       HeaderVersion,
+		PrevBlockHash: prevBlockHash,
+		Height:        height,
+		Timestamp:     uint64(time.Now().UnixNano()),
+		// data transactions leave the state empty
+		StateRoot: NewState().Root(),
+	}
+
+	b, err := NewBlock(header, txx)
+	assert.Nil(t, err)
+
+	dataHash, err := CalculateDataHash(b.Transactions)
+	assert.Nil(t, err)
+	b.Header.DataHash = dataHash
+	assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+
+	return b
+}
@@ -0,0 +1,186 @@
+/***************************************************************
+ * Arquivo: certificate.go
+ * Descrição: Votos e propostas do consenso BFT e certificados de
+ *            commit que provam a finalidade de um bloco.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: Um bloco é final quando mais de dois terços dos
+ * validadores fazem precommit dele na mesma rodada.
+ ***************************************************************/
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+type VoteType byte
+
+const (
+	VotePrevote   VoteType = 0x1
+	VotePrecommit VoteType = 0x2
+)
+
+func (t VoteType) String() string {
+	switch t {
+	case VotePrevote:
+		return "prevote"
+	case VotePrecommit:
+		return "precommit"
+	default:
+		return fmt.Sprintf("vote type (%d)", byte(t))
+	}
+}
+
+// Vote is the vote of a validator in a round of the BFT consensus, for the
+// block of BlockHash or, when it is zero, for no block.
+type Vote struct {
+	Type      VoteType
+	Height    uint32
+	Round     uint32
+	BlockHash types.Hash
+	Validator crypto.PublicKey
+	Signature *crypto.Signature
+}
+
+func (v *Vote) Sign(privKey crypto.PrivateKey) error {
+	sig, err := privKey.Sign(crypto.DomainVote, v.signingBytes())
+	if err != nil {
+		return err
+	}
+	v.Validator = privKey.PublicKey()
+	v.Signature = sig
+	return nil
+}
+
+func (v *Vote) Verify() error {
+	if v.Signature == nil {
+		return fmt.Errorf("%s has no signature", v.Type)
+	}
+	if !v.Signature.Verify(v.Validator, crypto.DomainVote, v.signingBytes()) {
+		return fmt.Errorf("%s has invalid signature", v.Type)
+	}
+	return nil
+}
+
+func (v *Vote) signingBytes() []byte {
+	w := newCodecWriter()
+	w.vote(v)
+	return w.Bytes()
+}
+
+// Proposal is the block the proposer of a round puts to the vote. POLRound
+// is the earlier round in which more than two thirds of the validators
+// prevoted the block, or -1 for a block that was not voted yet.
+type Proposal struct {
+	Round     uint32
+	POLRound  int32
+	Block     *Block
+	Validator crypto.PublicKey
+	Signature *crypto.Signature
+}
+
+func (p *Proposal) Sign(privKey crypto.PrivateKey) error {
+	sig, err := privKey.Sign(crypto.DomainProposal, p.signingBytes())
+	if err != nil {
+		return err
+	}
+	p.Validator = privKey.PublicKey()
+	p.Signature = sig
+	return nil
+}
+
+func (p *Proposal) Verify() error {
+	if p.Signature == nil {
+		return fmt.Errorf("proposal has no signature")
+	}
+	if !p.Signature.Verify(p.Validator, crypto.DomainProposal, p.signingBytes()) {
+		return fmt.Errorf("proposal has invalid signature")
+	}
+	return nil
+}
+
+func (p *Proposal) signingBytes() []byte {
+	w := newCodecWriter()
+	w.WriteByte(CodecVersion)
+	w.uint32(p.Block.Height)
+	w.uint32(p.Round)
+	w.uint32(uint32(p.POLRound))
+	w.hash(p.Block.Hash(BlockHasher{}))
+	return w.Bytes()
+}
+
+// HasQuorum tells whether votes of more than two thirds of the validators
+// were gathered.
+func HasQuorum(votes, validators int) bool {
+	return votes*3 > validators*2
+}
+
+// CommitSignature is the precommit of a validator inside a certificate.
+type CommitSignature struct {
+	Validator crypto.PublicKey
+	Signature *crypto.Signature
+}
+
+// CommitCertificate proves that a block was committed: it holds the
+// precommits of more than two thirds of the validators for the block, all
+// cast in Round.
+type CommitCertificate struct {
+	Round      uint32
+	Precommits []CommitSignature
+}
+
+// NewCommitCertificate gathers the precommits for the block cast in round.
+func NewCommitCertificate(b *Block, round uint32, precommits []*Vote) *CommitCertificate {
+	hash := b.Hash(BlockHasher{})
+	c := &CommitCertificate{Round: round}
+	for _, v := range precommits {
+		if v.Type == VotePrecommit && v.Height == b.Height && v.Round == round && v.BlockHash == hash {
+			c.Precommits = append(c.Precommits, CommitSignature{Validator: v.Validator, Signature: v.Signature})
+		}
+	}
+	return c
+}
+
+// Verify checks that the certificate commits the block with the precommits
+// of more than two thirds of validators.
+func (c *CommitCertificate) Verify(b *Block, validators []types.Address) error {
+	members := make(map[types.Address]bool, len(validators))
+	for _, addr := range validators {
+		members[addr] = true
+	}
+
+	signed := make(map[types.Address]bool, len(c.Precommits))
+	for _, p := range c.Precommits {
+		vote := Vote{
+			Type:      VotePrecommit,
+			Height:    b.Height,
+			Round:     c.Round,
+			BlockHash: b.Hash(BlockHasher{}),
+			Validator: p.Validator,
+			Signature: p.Signature,
+		}
+		if err := vote.Verify(); err != nil {
+			return err
+		}
+
+		addr := p.Validator.Address()
+		if !members[addr] {
+			return fmt.Errorf("certificate holds a precommit of %s, which is not a validator", addr)
+		}
+		if signed[addr] {
+			return fmt.Errorf("certificate holds the precommit of %s twice", addr)
+		}
+		signed[addr] = true
+	}
+
+	if !HasQuorum(len(signed), len(validators)) {
+		return fmt.Errorf("certificate of block (%s) has (%d) precommits of (%d) validators", b.Hash(BlockHasher{}), len(signed), len(validators))
+	}
+	return nil
+}
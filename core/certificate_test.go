@@ -0,0 +1,97 @@
+package core
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func precommit(t *testing.T, key crypto.PrivateKey, b *Block, round uint32) *Vote {
+	v := &Vote{Type: VotePrecommit, Height: b.Height, Round: round, BlockHash: b.Hash(BlockHasher{})}
+	assert.Nil(t, v.Sign(key))
+	return v
+}
+
+func validatorAddresses(keys []crypto.PrivateKey) []types.Address {
+	addrs := make([]types.Address, len(keys))
+	for i, key := range keys {
+		addrs[i] = key.PublicKey().Address()
+	}
+	return addrs
+}
+
+func TestVoteEncoding(t *testing.T) {
+	v := &Vote{Type: VotePrevote, Height: 3, Round: 1, BlockHash: types.Hash(sha256.Sum256([]byte("block")))}
+	assert.Nil(t, v.Sign(crypto.GeneratePrivateKey()))
+
+	decoded, err := UnmarshalVote(MarshalVote(v))
+	assert.Nil(t, err)
+	assert.Nil(t, decoded.Verify())
+	assert.Equal(t, MarshalVote(v), MarshalVote(decoded))
+
+	// the signature covers the round
+	decoded.Round++
+	assert.NotNil(t, decoded.Verify())
+}
+
+func TestProposalEncoding(t *testing.T) {
+	key := crypto.GeneratePrivateKey()
+	b := randomBlock(t, 1, types.Hash{})
+	p := &Proposal{Round: 2, POLRound: 1, Block: b}
+	assert.Nil(t, p.Sign(key))
+
+	decoded, err := UnmarshalProposal(MarshalProposal(p))
+	assert.Nil(t, err)
+	assert.Nil(t, decoded.Verify())
+	assert.Equal(t, int32(1), decoded.POLRound)
+	assert.Equal(t, b.Hash(BlockHasher{}), decoded.Block.Hash(BlockHasher{}))
+
+	// a POL round must be before the round of the proposal
+	p.POLRound = 2
+	assert.Nil(t, p.Sign(key))
+	_, err = UnmarshalProposal(MarshalProposal(p))
+	assert.NotNil(t, err)
+}
+
+func TestCommitCertificate(t *testing.T) {
+	keys := authorityKeys(4)
+	validators := validatorAddresses(keys)
+	b := randomBlock(t, 1, types.Hash{})
+
+	votes := []*Vote{precommit(t, keys[0], b, 0), precommit(t, keys[1], b, 0)}
+	cert := NewCommitCertificate(b, 0, votes)
+	assert.NotNil(t, cert.Verify(b, validators))
+
+	// votes of another round do not count
+	votes = append(votes, precommit(t, keys[2], b, 1))
+	cert = NewCommitCertificate(b, 0, votes)
+	assert.Len(t, cert.Precommits, 2)
+
+	votes = append(votes, precommit(t, keys[3], b, 0))
+	cert = NewCommitCertificate(b, 0, votes)
+	assert.Nil(t, cert.Verify(b, validators))
+
+	// the certificate travels and is stored with the block
+	b.Certificate = cert
+	decoded, err := UnmarshalBlock(MarshalBlock(b))
+	assert.Nil(t, err)
+	assert.Nil(t, decoded.Certificate.Verify(decoded, validators))
+	assert.Equal(t, b.Hash(BlockHasher{}), decoded.Hash(BlockHasher{}))
+
+	// it does not commit another block
+	other := randomBlock(t, 1, types.Hash{})
+	assert.NotNil(t, cert.Verify(other, validators))
+
+	// a precommit counts once
+	dup := &CommitCertificate{Precommits: append(cert.Precommits, cert.Precommits[0])}
+	assert.NotNil(t, dup.Verify(b, validators))
+
+	// only validators count
+	outsider := crypto.GeneratePrivateKey()
+	v := precommit(t, outsider, b, 0)
+	foreign := &CommitCertificate{Precommits: append(cert.Precommits[:2:2], CommitSignature{Validator: v.Validator, Signature: v.Signature})}
+	assert.NotNil(t, foreign.Verify(b, validators))
+}
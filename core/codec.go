@@ -0,0 +1,796 @@
+/***************************************************************
+ * Arquivo: codec.go
+ * Descrição: Codificação binária canônica de cabeçalhos,
+ *            transações e blocos.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: Todos os inteiros são big-endian e todos os campos
+ * de tamanho variável são prefixados com o tamanho (uint32).
+ ***************************************************************/
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+// CodecVersion is the first byte of every canonical encoding. It changes
+// whenever the layout of any encoded object changes.
+const CodecVersion byte = 9
+
+// multisigTag marks a multisig policy in the sender of a transaction and
+// its approvals in place of the signature. It is not a key type.
+const multisigTag byte = 0x80
+
+// maxEncodedSize bounds a single length-prefixed field or stream frame.
+const maxEncodedSize = 32 * 1024 * 1024
+
+// The canonical layouts are:
+//
+//	Header      = version | Version u32 | PrevBlockHash [32] | Timestamp u64 |
+//	              Height u32 | DataHash [32] | StateRoot [32] |
+//	              Difficulty u64 | Nonce u64
+//	Transaction = version | ChainID u32 | Type u8 | Nonce u64 | Fee u64 |
+//	              Data bytes | To [20] | Value u64 | Sender | Signature
+//	Block       = version | Header bytes | count u32 | count * Transaction bytes |
+//	              Validator bytes | Signature | Certificate
+//	Certificate = 0x00 (absent) | 0x01 Round u32 | count u32 |
+//	              count * (Validator bytes | Signature)
+//	Vote        = version | Type u8 | Height u32 | Round u32 | BlockHash [32] |
+//	              Validator bytes | Signature
+//	Proposal    = version | Round u32 | POLRound i32 | Block bytes |
+//	              Validator bytes | Signature
+//	Sender      = 0x00 (unsigned) | 0x01 Address [20] | 0x02 Ed25519 key [32] |
+//	              0x80 Policy
+//	Signature   = 0x00 (absent) | 0x01 R [32] S [32] V u8 | 0x02 Ed25519 [64] |
+//	              0x80 Approvals
+//	Policy      = Threshold u8 | count u8 | count * key bytes
+//	Approvals   = count u8 | count * (key index u8 | Signature)
+//
+// where "bytes" is a u32 length followed by the data, and the tags are the
+// crypto key types, or 0x80 for a multisig account. Transactions are signed
+// and hashed over their encoding without the signature or the approvals,
+// votes are signed over their encoding without the validator and the
+// signature, and proposals over version | Height u32 | Round u32 | POLRound
+// i32 | BlockHash [32].
+//
+// A P-256 sender is only named by its address, its public key is recovered
+// from the signature when decoding. Approvals name their key by its index in
+// the policy, in increasing order. The validator and the policy keys are
+// public keys as encoded by crypto.PublicKey.ToBytes. The Data of a multisig
+// registration is a Policy.
+
+// MarshalHeader returns the canonical encoding of the header.
+func MarshalHeader(h *Header) []byte {
+	w := newCodecWriter()
+	w.header(h)
+	return w.Bytes()
+}
+
+func UnmarshalHeader(data []byte) (*Header, error) {
+	r := newCodecReader(data)
+	h := r.header()
+	return h, r.done()
+}
+
+// MarshalTransaction returns the canonical encoding of the transaction,
+// signature included.
+func MarshalTransaction(tx *Transaction) []byte {
+	w := newCodecWriter()
+	w.transaction(tx, true)
+	return w.Bytes()
+}
+
+// signingBytes is the canonical encoding of the transaction without its
+// signature or approvals. It is what the sender, or every approving key of
+// a multisig account, signs and what TxHasher hashes.
+func (tx *Transaction) signingBytes() []byte {
+	w := newCodecWriter()
+	w.transaction(tx, false)
+	return w.Bytes()
+}
+
+// UnmarshalTransaction decodes a transaction. The public key of a sender
+// named by its address is recovered from the signature and must match it.
+func UnmarshalTransaction(data []byte) (*Transaction, error) {
+	r := newCodecReader(data)
+	tx, from, recoverable := r.transaction()
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+
+	if tx.Multisig != nil {
+		if len(tx.Approvals) == 0 {
+			return nil, fmt.Errorf("multisig transaction has no approvals")
+		}
+		return tx, nil
+	}
+
+	hasSender := recoverable || !tx.From.IsZero()
+	if tx.Signature == nil {
+		if hasSender {
+			return nil, fmt.Errorf("transaction has a sender but no signature")
+		}
+		return tx, nil
+	}
+	if !hasSender {
+		return nil, fmt.Errorf("transaction has a signature but no sender")
+	}
+
+	if recoverable {
+		// the encoding is canonical, what precedes the signature is exactly
+		// what was signed
+		signed := data[:len(data)-1-tx.Signature.Type().SignatureSize()]
+		if err := tx.recoverSender(from, signed); err != nil {
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+func (tx *Transaction) recoverSender(from types.Address, signed []byte) error {
+	key, err := tx.Signature.RecoverPublicKey(crypto.DomainTransaction, signed)
+	if err != nil {
+		return fmt.Errorf("invalid transaction signature: %s", err)
+	}
+	if key.Address() != from {
+		return fmt.Errorf("transaction signature does not match the sender %s", from)
+	}
+	tx.From = key
+	return nil
+}
+
+// MarshalBlock returns the canonical encoding of the block.
+func MarshalBlock(b *Block) []byte {
+	w := newCodecWriter()
+	w.WriteByte(CodecVersion)
+	w.bytes(MarshalHeader(b.Header))
+	w.uint32(uint32(len(b.Transactions)))
+	for i := range b.Transactions {
+		w.bytes(MarshalTransaction(&b.Transactions[i]))
+	}
+	w.publicKey(b.Validator)
+	w.signature(b.Signature)
+	w.certificate(b.Certificate)
+	return w.Bytes()
+}
+
+func UnmarshalBlock(data []byte) (*Block, error) {
+	r := newCodecReader(data)
+	r.version()
+
+	h, err := UnmarshalHeader(r.bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	count := r.uint32()
+	if r.err == nil && int(count) > r.Len() {
+		return nil, fmt.Errorf("block declares %d transactions in %d bytes", count, r.Len())
+	}
+
+	txx := make([]Transaction, 0, count)
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tx, err := UnmarshalTransaction(r.bytes())
+		if err != nil {
+			return nil, err
+		}
+		txx = append(txx, *tx)
+	}
+
+	b := &Block{
+		Header:       h,
+		Transactions: txx,
+		Validator:    r.publicKey(),
+		Signature:    r.signature(),
+		Certificate:  r.certificate(),
+	}
+	return b, r.done()
+}
+
+// MarshalMultisigPolicy returns the encoding of the policy, as carried by a
+// multisig registration.
+func MarshalMultisigPolicy(p *MultisigPolicy) []byte {
+	w := newCodecWriter()
+	w.multisig(p)
+	return w.Bytes()
+}
+
+func UnmarshalMultisigPolicy(data []byte) (*MultisigPolicy, error) {
+	r := newCodecReader(data)
+	p := r.multisig()
+	return p, r.done()
+}
+
+// MarshalVote returns the canonical encoding of the vote.
+func MarshalVote(v *Vote) []byte {
+	w := newCodecWriter()
+	w.vote(v)
+	w.publicKey(v.Validator)
+	w.signature(v.Signature)
+	return w.Bytes()
+}
+
+func UnmarshalVote(data []byte) (*Vote, error) {
+	r := newCodecReader(data)
+	r.version()
+	v := &Vote{Type: VoteType(r.byte())}
+	if r.err == nil && v.Type != VotePrevote && v.Type != VotePrecommit {
+		return nil, fmt.Errorf("unknown vote type (%d)", v.Type)
+	}
+	v.Height = r.uint32()
+	v.Round = r.uint32()
+	v.BlockHash = r.hash()
+	v.Validator = r.publicKey()
+	v.Signature = r.signature()
+	return v, r.done()
+}
+
+// MarshalProposal returns the canonical encoding of the proposal.
+func MarshalProposal(p *Proposal) []byte {
+	w := newCodecWriter()
+	w.WriteByte(CodecVersion)
+	w.uint32(p.Round)
+	w.uint32(uint32(p.POLRound))
+	w.bytes(MarshalBlock(p.Block))
+	w.publicKey(p.Validator)
+	w.signature(p.Signature)
+	return w.Bytes()
+}
+
+func UnmarshalProposal(data []byte) (*Proposal, error) {
+	r := newCodecReader(data)
+	r.version()
+	p := &Proposal{
+		Round:    r.uint32(),
+		POLRound: int32(r.uint32()),
+	}
+	if r.err == nil && (p.POLRound < -1 || p.POLRound >= int32(p.Round)) {
+		return nil, fmt.Errorf("proposal of round (%d) has invalid POL round (%d)", p.Round, p.POLRound)
+	}
+
+	b, err := UnmarshalBlock(r.bytes())
+	if err != nil {
+		return nil, err
+	}
+	p.Block = b
+	p.Validator = r.publicKey()
+	p.Signature = r.signature()
+	return p, r.done()
+}
+
+// BinaryTxEncoder writes transactions in the canonical format, each one
+// prefixed with its length so several can share a stream.
+type BinaryTxEncoder struct {
+	W io.Writer
+}
+
+func NewBinaryTxEncoder(w io.Writer) *BinaryTxEncoder {
+	return &BinaryTxEncoder{W: w}
+}
+
+func (e *BinaryTxEncoder) Encode(tx *Transaction) error {
+	return writeFrame(e.W, MarshalTransaction(tx))
+}
+
+type BinaryTxDecoder struct {
+	R io.Reader
+}
+
+func NewBinaryTxDecoder(r io.Reader) *BinaryTxDecoder {
+	return &BinaryTxDecoder{R: r}
+}
+
+func (d *BinaryTxDecoder) Decode(tx *Transaction) error {
+	data, err := readFrame(d.R)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := UnmarshalTransaction(data)
+	if err != nil {
+		return err
+	}
+	*tx = *decoded
+	return nil
+}
+
+// BinaryBlockEncoder writes blocks in the canonical format, each one
+// prefixed with its length.
+type BinaryBlockEncoder struct {
+	W io.Writer
+}
+
+func NewBinaryBlockEncoder(w io.Writer) *BinaryBlockEncoder {
+	return &BinaryBlockEncoder{W: w}
+}
+
+func (e *BinaryBlockEncoder) Encode(b *Block) error {
+	return writeFrame(e.W, MarshalBlock(b))
+}
+
+type BinaryBlockDecoder struct {
+	R io.Reader
+}
+
+func NewBinaryBlockDecoder(r io.Reader) *BinaryBlockDecoder {
+	return &BinaryBlockDecoder{R: r}
+}
+
+func (d *BinaryBlockDecoder) Decode(b *Block) error {
+	data, err := readFrame(d.R)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := UnmarshalBlock(data)
+	if err != nil {
+		return err
+	}
+	*b = *decoded
+	return nil
+}
+
+func writeFrame(w io.Writer, data []byte) error {
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err := w.Write(frame)
+	return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(r, size); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(size)
+	if n > maxEncodedSize {
+		return nil, fmt.Errorf("frame size (%d) is too large", n)
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+type codecWriter struct {
+	bytes.Buffer
+}
+
+func newCodecWriter() *codecWriter {
+	return &codecWriter{}
+}
+
+func (w *codecWriter) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	w.Write(b[:])
+}
+
+func (w *codecWriter) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	w.Write(b[:])
+}
+
+func (w *codecWriter) hash(h types.Hash) {
+	w.Write(h[:])
+}
+
+func (w *codecWriter) bytes(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.Write(b)
+}
+
+func (w *codecWriter) header(h *Header) {
+	w.WriteByte(CodecVersion)
+	w.uint32(h.Version)
+	w.hash(h.PrevBlockHash)
+	w.uint64(h.Timestamp)
+	w.uint32(h.Height)
+	w.hash(h.DataHash)
+	w.hash(h.StateRoot)
+	w.uint64(h.Difficulty)
+	w.uint64(h.Nonce)
+}
+
+// vote writes the signed part of a vote.
+func (w *codecWriter) vote(v *Vote) {
+	w.WriteByte(CodecVersion)
+	w.WriteByte(byte(v.Type))
+	w.uint32(v.Height)
+	w.uint32(v.Round)
+	w.hash(v.BlockHash)
+}
+
+func (w *codecWriter) certificate(c *CommitCertificate) {
+	if c == nil {
+		w.WriteByte(0)
+		return
+	}
+
+	w.WriteByte(1)
+	w.uint32(c.Round)
+	w.uint32(uint32(len(c.Precommits)))
+	for _, p := range c.Precommits {
+		w.publicKey(p.Validator)
+		w.signature(p.Signature)
+	}
+}
+
+func (w *codecWriter) transaction(tx *Transaction, withSignature bool) {
+	w.WriteByte(CodecVersion)
+	w.uint32(tx.ChainID)
+	w.WriteByte(byte(tx.Type))
+	w.uint64(tx.Nonce)
+	w.uint64(tx.Fee)
+	w.bytes(tx.Data)
+	w.Write(tx.To[:])
+	w.uint64(tx.Value)
+	if tx.Multisig != nil {
+		w.WriteByte(multisigTag)
+		w.multisig(tx.Multisig)
+	} else {
+		w.sender(tx.From)
+	}
+
+	if !withSignature {
+		return
+	}
+	if tx.Multisig != nil {
+		w.approvals(tx.Multisig, tx.Approvals)
+	} else {
+		w.signature(tx.Signature)
+	}
+}
+
+func (w *codecWriter) multisig(p *MultisigPolicy) {
+	w.WriteByte(p.Threshold)
+	w.WriteByte(byte(len(p.Keys)))
+	for _, k := range p.Keys {
+		w.publicKey(k)
+	}
+}
+
+// approvals writes the approvals of a multisig transaction in place of its
+// signature, nothing but the absent tag when there are none.
+func (w *codecWriter) approvals(p *MultisigPolicy, approvals []Approval) {
+	if len(approvals) == 0 {
+		w.WriteByte(0)
+		return
+	}
+
+	w.WriteByte(multisigTag)
+	w.WriteByte(byte(len(approvals)))
+	for _, a := range approvals {
+		w.WriteByte(byte(p.indexOf(a.Key)))
+		w.signature(a.Signature)
+	}
+}
+
+// sender writes the address of a sender whose public key can be recovered
+// from the signature, and the key itself otherwise.
+func (w *codecWriter) sender(k crypto.PublicKey) {
+	switch k.Type() {
+	case 0:
+		w.WriteByte(0)
+	case crypto.KeyTypeP256:
+		addr := k.Address()
+		w.WriteByte(byte(crypto.KeyTypeP256))
+		w.Write(addr[:])
+	default:
+		w.Write(k.ToBytes())
+	}
+}
+
+func (w *codecWriter) publicKey(k crypto.PublicKey) {
+	if k.IsZero() {
+		w.bytes(nil)
+		return
+	}
+	w.bytes(k.ToBytes())
+}
+
+func (w *codecWriter) signature(sig *crypto.Signature) {
+	if sig == nil {
+		w.WriteByte(0)
+		return
+	}
+
+	// signatures always take the full size of their scheme
+	t := sig.Type()
+	b := make([]byte, t.SignatureSize())
+	copy(b, sig.ToBytes())
+	w.WriteByte(byte(t))
+	w.Write(b)
+}
+
+// codecReader decodes canonical data. The first error is kept and every
+// later read becomes a no-op, so callers only check it once.
+type codecReader struct {
+	*bytes.Reader
+	err error
+}
+
+func newCodecReader(data []byte) *codecReader {
+	return &codecReader{Reader: bytes.NewReader(data)}
+}
+
+func (r *codecReader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > r.Len() {
+		r.err = fmt.Errorf("unexpected end of data, need %d bytes, have %d", n, r.Len())
+		return nil
+	}
+
+	b := make([]byte, n)
+	r.Read(b)
+	return b
+}
+
+func (r *codecReader) byte() byte {
+	b := r.read(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *codecReader) version() {
+	if v := r.byte(); r.err == nil && v != CodecVersion {
+		r.err = fmt.Errorf("unsupported codec version (%d)", v)
+	}
+}
+
+func (r *codecReader) uint32() uint32 {
+	b := r.read(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *codecReader) uint64() uint64 {
+	b := r.read(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *codecReader) hash() types.Hash {
+	b := r.read(32)
+	if b == nil {
+		return types.Hash{}
+	}
+	return types.HashFromBytes(b)
+}
+
+func (r *codecReader) address() types.Address {
+	b := r.read(20)
+	if b == nil {
+		return types.Address{}
+	}
+	return types.AddressFromBytes(b)
+}
+
+func (r *codecReader) bytes() []byte {
+	n := r.uint32()
+	if r.err == nil && n > maxEncodedSize {
+		r.err = fmt.Errorf("field size (%d) is too large", n)
+	}
+	return r.read(int(n))
+}
+
+func (r *codecReader) header() *Header {
+	r.version()
+	return &Header{
+		Version:       r.uint32(),
+		PrevBlockHash: r.hash(),
+		Timestamp:     r.uint64(),
+		Height:        r.uint32(),
+		DataHash:      r.hash(),
+		StateRoot:     r.hash(),
+		Difficulty:    r.uint64(),
+		Nonce:         r.uint64(),
+	}
+}
+
+// transaction decodes a transaction. When the sender is only named by its
+// address, the address is returned and recoverable is set.
+func (r *codecReader) transaction() (tx *Transaction, from types.Address, recoverable bool) {
+	r.version()
+	tx = &Transaction{}
+	tx.ChainID = r.uint32()
+	tx.Type = TxType(r.byte())
+	if r.err == nil && tx.Type > TxTypeRegisterMultisig {
+		r.err = fmt.Errorf("unknown transaction type (%d)", tx.Type)
+	}
+	tx.Nonce = r.uint64()
+	tx.Fee = r.uint64()
+	if data := r.bytes(); len(data) > 0 {
+		tx.Data = data
+	}
+	tx.To = r.address()
+	tx.Value = r.uint64()
+
+	if tag := r.byte(); tag == multisigTag {
+		tx.Multisig = r.multisig()
+	} else {
+		tx.From, from, recoverable = r.sender(crypto.KeyType(tag))
+	}
+
+	tag := r.byte()
+	switch {
+	case tag != multisigTag:
+		tx.Signature = r.signatureOf(crypto.KeyType(tag))
+		if r.err == nil && tx.Multisig != nil && tx.Signature != nil {
+			r.err = fmt.Errorf("multisig transaction cannot carry a signature")
+		}
+	case tx.Multisig == nil:
+		if r.err == nil {
+			r.err = fmt.Errorf("transaction has approvals but no multisig policy")
+		}
+	default:
+		tx.Approvals = r.approvals(tx.Multisig)
+	}
+	return tx, from, recoverable
+}
+
+func (r *codecReader) certificate() *CommitCertificate {
+	switch tag := r.byte(); {
+	case r.err != nil || tag == 0:
+		return nil
+	case tag != 1:
+		r.err = fmt.Errorf("invalid certificate tag (%d)", tag)
+		return nil
+	}
+
+	c := &CommitCertificate{Round: r.uint32()}
+	count := r.uint32()
+	if r.err == nil && int(count) > r.Len() {
+		r.err = fmt.Errorf("certificate declares %d precommits in %d bytes", count, r.Len())
+		return nil
+	}
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		p := CommitSignature{Validator: r.publicKey(), Signature: r.signature()}
+		if r.err == nil && p.Signature == nil {
+			r.err = fmt.Errorf("certificate precommit has no signature")
+		}
+		c.Precommits = append(c.Precommits, p)
+	}
+	if r.err != nil {
+		return nil
+	}
+	return c
+}
+
+func (r *codecReader) multisig() *MultisigPolicy {
+	p := &MultisigPolicy{Threshold: r.byte()}
+	count := int(r.byte())
+	for i := 0; i < count && r.err == nil; i++ {
+		p.Keys = append(p.Keys, r.publicKey())
+	}
+	if r.err != nil {
+		return nil
+	}
+
+	if err := p.Validate(); err != nil {
+		r.err = err
+		return nil
+	}
+	return p
+}
+
+func (r *codecReader) approvals(p *MultisigPolicy) []Approval {
+	count := int(r.byte())
+	if r.err == nil && count == 0 {
+		r.err = fmt.Errorf("multisig approvals are empty")
+	}
+
+	approvals := make([]Approval, 0, count)
+	last := -1
+	for i := 0; i < count && r.err == nil; i++ {
+		index := int(r.byte())
+		sig := r.signature()
+		if r.err != nil {
+			return nil
+		}
+		if index <= last || index >= len(p.Keys) {
+			r.err = fmt.Errorf("invalid multisig approval key index (%d)", index)
+			return nil
+		}
+		if sig == nil {
+			r.err = fmt.Errorf("multisig approval has no signature")
+			return nil
+		}
+		last = index
+		approvals = append(approvals, Approval{Key: p.Keys[index], Signature: sig})
+	}
+	return approvals
+}
+
+func (r *codecReader) sender(t crypto.KeyType) (crypto.PublicKey, types.Address, bool) {
+	switch {
+	case r.err != nil || t == 0:
+		return crypto.PublicKey{}, types.Address{}, false
+	case t == crypto.KeyTypeP256:
+		return crypto.PublicKey{}, r.address(), true
+	case t.PublicKeySize() == 0:
+		r.err = fmt.Errorf("unsupported sender key type %s", t)
+		return crypto.PublicKey{}, types.Address{}, false
+	}
+
+	data := r.read(t.PublicKeySize())
+	if data == nil {
+		return crypto.PublicKey{}, types.Address{}, false
+	}
+	k, err := crypto.PublicKeyFromRaw(t, data)
+	if err != nil {
+		r.err = err
+	}
+	return k, types.Address{}, false
+}
+
+func (r *codecReader) publicKey() crypto.PublicKey {
+	data := r.bytes()
+	if r.err != nil || len(data) == 0 {
+		return crypto.PublicKey{}
+	}
+
+	k, err := crypto.PublicKeyFromBytes(data)
+	if err != nil {
+		r.err = err
+	}
+	return k
+}
+
+func (r *codecReader) signature() *crypto.Signature {
+	return r.signatureOf(crypto.KeyType(r.byte()))
+}
+
+// signatureOf reads a signature whose tag t was already read.
+func (r *codecReader) signatureOf(t crypto.KeyType) *crypto.Signature {
+	switch {
+	case r.err != nil || t == 0:
+		return nil
+	case t.SignatureSize() == 0:
+		r.err = fmt.Errorf("invalid signature type (%d)", byte(t))
+		return nil
+	}
+
+	data := r.read(t.SignatureSize())
+	if data == nil {
+		return nil
+	}
+	sig, err := crypto.SignatureFromBytes(t, data)
+	if err != nil {
+		r.err = err
+	}
+	return sig
+}
+
+// done reports the first decoding error, or an error if data is left over.
+func (r *codecReader) done() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%d unexpected trailing bytes", r.Len())
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// The golden vectors pin the canonical encoding. Any implementation of the
+// codec must reproduce these bytes, and therefore these hashes, exactly.
+const (
+	goldenHeaderHex = "09" + "00000002" +
+		"84fd9bac333ad79154348296204fa7f8c537a96e08983e5f73b3f5aca8e8edf7" +
+		"17a6101701650000" + "00000007" +
+		"3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7" +
+		"4ba69735ca53765ed6a709edb56c6ea236b7193a3b29a6b390c346f0f4340e4e" +
+		"0000000000001000" + "000000000000002a"
+	goldenHeaderHash = "277734b7a2e947b5b52a8cf917357db54d9abccbb071ddfb0dc765a2eab4db8d"
+
+	goldenPublicKeyHex = "01" + "020217e617f0b6443928278f96999e69a23a4f2c152bdf6d6cdf66e5b80282d4ed"
+	goldenSignatureHex = "01" + "ecd7bb11ad7f24d028ca53e23681b96ffb53303334ebc497b4ecd9ef6e35f194" +
+		"44ba0a0a9f8ae3eda830a42a831c117c75d3124236c0c935cc55aded6d25b852" + "00"
+
+	goldenTxHex = "09" + "00000007" + "01" + "0000000000000005" + "0000000000000003" +
+		"00000006" + "676f6c64656e" +
+		"4444444444444444444444444444444444444444" + "00000000000003e8" +
+		"01" + "6fa155643041ca76d94bc56dc12603ab88d95714" + goldenSignatureHex
+	goldenTxHash = "9ea7fc0aff103d0e8ee955e489c9872a85528f39230ef98f7df038b98f6c1245"
+)
+
+func goldenHeader() *Header {
+	return &Header{
+		Version:       HeaderVersionMerkle,
+		PrevBlockHash: types.Hash(sha256.Sum256([]byte("prev"))),
+		Timestamp:     1704067200000000000,
+		Height:        7,
+		DataHash:      types.Hash(sha256.Sum256([]byte("data"))),
+		StateRoot:     types.Hash(sha256.Sum256([]byte("state"))),
+		Difficulty:    4096,
+		Nonce:         42,
+	}
+}
+
+func goldenTransaction(t *testing.T) *Transaction {
+	key, err := crypto.PrivateKeyFromBytes(append([]byte{byte(crypto.KeyTypeP256)}, bytes.Repeat([]byte{0x11}, 32)...))
+	assert.Nil(t, err)
+
+	tx := &Transaction{
+		ChainID: 7,
+		Type:    TxTypeTransfer,
+		Nonce:   5,
+		Fee:     3,
+		Data:    []byte("golden"),
+		To:      types.AddressFromBytes(bytes.Repeat([]byte{0x44}, 20)),
+		Value:   1000,
+	}
+	// signatures are deterministic, so they are pinned as well
+	assert.Nil(t, tx.Sign(key))
+	return tx
+}
+
+func TestGoldenHeader(t *testing.T) {
+	h := goldenHeader()
+
+	assert.Equal(t, goldenHeaderHex, hex.EncodeToString(MarshalHeader(h)))
+	assert.Equal(t, goldenHeaderHash, BlockHasher{}.Hash(h).String())
+
+	decoded, err := UnmarshalHeader(MarshalHeader(h))
+	assert.Nil(t, err)
+	assert.Equal(t, h, decoded)
+}
+
+func TestGoldenTransaction(t *testing.T) {
+	tx := goldenTransaction(t)
+
+	assert.Equal(t, goldenTxHex, hex.EncodeToString(MarshalTransaction(tx)))
+	assert.Equal(t, goldenTxHash, tx.Hash(TxHasher{}).String())
+
+	decoded, err := UnmarshalTransaction(MarshalTransaction(tx))
+	assert.Nil(t, err)
+	assert.Equal(t, MarshalTransaction(tx), MarshalTransaction(decoded))
+	// the sender key is recovered from the signature
+	assert.Equal(t, goldenPublicKeyHex, hex.EncodeToString(decoded.From.ToBytes()))
+	assert.Nil(t, decoded.Verify())
+}
+
+func TestUnmarshalTransactionChecksSender(t *testing.T) {
+	data := MarshalTransaction(goldenTransaction(t))
+	fromAt := len(data) - 1 - crypto.RecoverableSignatureSize - 20
+
+	// a sender that did not sign the transaction
+	forged := append([]byte{}, data...)
+	forged[fromAt] ^= 0xff
+	_, err := UnmarshalTransaction(forged)
+	assert.NotNil(t, err)
+
+	// a sender without a signature
+	unsigned := goldenTransaction(t)
+	unsigned.Signature = nil
+	_, err = UnmarshalTransaction(MarshalTransaction(unsigned))
+	assert.NotNil(t, err)
+
+	// an unsigned transaction has no sender
+	mint := &Transaction{Type: TxTypeMint, Value: 1}
+	decoded, err := UnmarshalTransaction(MarshalTransaction(mint))
+	assert.Nil(t, err)
+	assert.True(t, decoded.From.IsZero())
+}
+
+func TestGoldenBlock(t *testing.T) {
+	tx := goldenTransaction(t)
+	b := &Block{
+		Header:       goldenHeader(),
+		Transactions: []Transaction{*tx},
+		Validator:    tx.From,
+		Signature:    tx.Signature,
+	}
+
+	want := "09" + "00000081" + goldenHeaderHex +
+		"00000001" + "00000093" + goldenTxHex +
+		"00000022" + goldenPublicKeyHex + goldenSignatureHex + "00"
+	assert.Equal(t, want, hex.EncodeToString(MarshalBlock(b)))
+
+	decoded, err := UnmarshalBlock(MarshalBlock(b))
+	assert.Nil(t, err)
+	assert.Equal(t, MarshalBlock(b), MarshalBlock(decoded))
+}
+
+func TestTxHashIgnoresSignature(t *testing.T) {
+	tx := randomTxWithSignature(t)
+	hash := tx.Hash(TxHasher{})
+
+	tx.Signature = nil
+	assert.Equal(t, hash, tx.Hash(TxHasher{}))
+
+	tx.Data = []byte("other")
+	assert.NotEqual(t, hash, tx.Hash(TxHasher{}))
+}
+
+func TestUnmarshalRejectsMalformedData(t *testing.T) {
+	data := MarshalTransaction(goldenTransaction(t))
+
+	for i := 0; i < len(data); i++ {
+		_, err := UnmarshalTransaction(data[:i])
+		assert.NotNil(t, err, "truncated at %d", i)
+	}
+
+	_, err := UnmarshalTransaction(append(data, 0x00))
+	assert.NotNil(t, err)
+
+	wrongVersion := append([]byte{}, data...)
+	wrongVersion[0] = CodecVersion + 1
+	_, err = UnmarshalTransaction(wrongVersion)
+	assert.NotNil(t, err)
+
+	_, err = UnmarshalBlock([]byte{CodecVersion, 0xff, 0xff, 0xff, 0xff})
+	assert.NotNil(t, err)
+}
+
+func TestBinaryTxEncodeDecode(t *testing.T) {
+	buf := &bytes.Buffer{}
+	txx := []Transaction{randomTxWithSignature(t), randomTxWithSignature(t)}
+
+	for i := range txx {
+		assert.Nil(t, txx[i].Encode(NewBinaryTxEncoder(buf)))
+	}
+
+	dec := NewBinaryTxDecoder(buf)
+	for i := range txx {
+		tx := new(Transaction)
+		assert.Nil(t, tx.Decode(dec))
+		assert.Nil(t, tx.Verify())
+		assert.Equal(t, txx[i].Hash(TxHasher{}), tx.Hash(TxHasher{}))
+	}
+}
@@ -56,3 +56,37 @@ func NewGobDecoder(r io.Reader) *GobTxDecoder {
 func (d *GobTxDecoder) Decode(tx *Transaction) error {
 	return gob.NewDecoder(d.R).Decode(tx)
 }
+
+type GobBlockEncoder struct {
+	W io.Writer
+}
+
+func NewGobBlockEncoder(w io.Writer) *GobBlockEncoder {
+	return &GobBlockEncoder{
+		W: w,
+	}
+}
+
+func (e *GobBlockEncoder) Encode(b *Block) error {
+	return gob.NewEncoder(e.W).Encode(b)
+}
+
+type GobBlockDecoder struct {
+	R io.Reader
+}
+
+func NewGobBlockDecoder(r io.Reader) *GobBlockDecoder {
+	return &GobBlockDecoder{
+		R: r,
+	}
+}
+
+func (d *GobBlockDecoder) Decode(b *Block) error {
+	// decode into a fresh block so no cached hash survives
+	decoded := new(Block)
+	if err := gob.NewDecoder(d.R).Decode(decoded); err != nil {
+		return err
+	}
+	*b = *decoded
+	return nil
+}
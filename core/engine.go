@@ -0,0 +1,91 @@
+/***************************************************************
+ * Arquivo: engine.go
+ * Descrição: Interface dos algoritmos de consenso usados para
+ *            produzir e aceitar blocos.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: A prova de autoridade é o algoritmo padrão.
+ ***************************************************************/
+
+package core
+
+import (
+	"errors"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+// ErrNotProposer is returned by Engine.Prepare when the node may not produce
+// the block yet, so producers can wait for their turn quietly.
+var ErrNotProposer = errors.New("not the proposer of the block")
+
+// Engine is the consensus algorithm of a chain. The producer of a block
+// calls Prepare, applies the transactions, calls Finalize and Seal, in this
+// order. The chain checks a received block with VerifyHeader against its
+// parent header, then with VerifySeal and Finalize while applying it to the
+// state of its parent.
+type Engine interface {
+	// Prepare sets the consensus fields of a header built on top of the
+	// tip by validator. It wraps ErrNotProposer when validator may not
+	// produce it.
+	Prepare(chain *BlockChain, header *Header, validator types.Address) error
+	// Seal signs the block, the last step before it is broadcast.
+	Seal(chain *BlockChain, b *Block, key crypto.PrivateKey) error
+	// VerifyHeader checks the consensus fields of a header against its
+	// parent.
+	VerifyHeader(chain *BlockChain, header, parent *Header) error
+	// VerifySeal checks that the producer of the block could produce it on
+	// top of the state of its parent.
+	VerifySeal(state EngineState, b *Block) error
+	// Finalize makes the consensus changes of the block, such as rewards,
+	// once its transactions are applied. They are part of the state root.
+	// The producer is already set as the validator of the block.
+	Finalize(state EngineState, b *Block) error
+}
+
+// EngineState is the state a block is applied to, as seen by the consensus
+// engine. Changes made through it are undone with the block.
+type EngineState interface {
+	GetAccount(addr types.Address) Account
+	IsValidator(addr types.Address) bool
+	Validators() []types.Address
+	Proposer(height uint32) (types.Address, bool)
+	Credit(addr types.Address, value uint64) error
+}
+
+// Finalize makes the consensus changes of the block on the state, for a
+// producer about to set the state root of the block.
+func (s *State) Finalize(e Engine, b *Block) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return e.Finalize(&blockState{state: s}, b)
+}
+
+// blockState is the EngineState of a State locked while a block is applied.
+type blockState struct {
+	state *State
+	undo  *stateUndo
+}
+
+func (bs *blockState) GetAccount(addr types.Address) Account {
+	return bs.state.accounts[addr]
+}
+
+func (bs *blockState) IsValidator(addr types.Address) bool {
+	return bs.state.validators[addr]
+}
+
+func (bs *blockState) Validators() []types.Address {
+	return bs.state.sortedValidators()
+}
+
+func (bs *blockState) Proposer(height uint32) (types.Address, bool) {
+	return bs.state.proposer(height)
+}
+
+func (bs *blockState) Credit(addr types.Address, value uint64) error {
+	return bs.state.credit(addr, value, bs.undo)
+}
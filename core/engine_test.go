@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// rewardEngine is a proof of authority that rewards the producer of every
+// block and only accepts increasing timestamps.
+type rewardEngine struct {
+	ProofOfAuthority
+	reward uint64
+}
+
+func (e rewardEngine) VerifyHeader(chain *BlockChain, header, parent *Header) error {
+	if header.Timestamp <= parent.Timestamp {
+		return fmt.Errorf("block timestamp (%d) is not after its parent (%d)", header.Timestamp, parent.Timestamp)
+	}
+	return nil
+}
+
+func (e rewardEngine) Finalize(state EngineState, b *Block) error {
+	if b.Height == 0 {
+		return nil
+	}
+	return state.Credit(b.Validator.Address(), e.reward)
+}
+
+func newEngineChain(t *testing.T, engine Engine) *BlockChain {
+	genesis, err := NewGenesisBlock(uint64(time.Now().UnixNano()), nil)
+	assert.Nil(t, err)
+	bc, err := NewBlockChainWithEngine(NewMemStore(), genesis, engine)
+	assert.Nil(t, err)
+	return bc
+}
+
+// engineBlock builds the next block of the chain the way a producer does.
+func engineBlock(t *testing.T, bc *BlockChain, key crypto.PrivateKey) *Block {
+	prev, err := bc.GetHeader(bc.Height())
+	assert.Nil(t, err)
+
+	b, err := NewBlockFromHeader(prev, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, bc.Engine.Prepare(bc, b.Header, key.PublicKey().Address()))
+
+	b.Validator = key.PublicKey()
+	state := bc.State()
+	assert.Nil(t, state.Finalize(bc.Engine, b))
+	b.StateRoot = state.Root()
+	assert.Nil(t, bc.Engine.Seal(bc, b, key))
+	return b
+}
+
+func TestEngineFinalizesBlocks(t *testing.T) {
+	bc := newEngineChain(t, rewardEngine{reward: 10})
+	key := crypto.GeneratePrivateKey()
+	addr := key.PublicKey().Address()
+
+	assert.Nil(t, bc.AddBlock(engineBlock(t, bc, key)))
+	assert.Nil(t, bc.AddBlock(engineBlock(t, bc, key)))
+	assert.Equal(t, uint64(20), bc.GetAccount(addr).Balance)
+
+	// a block that skips the reward does not match the state root
+	b := engineBlock(t, bc, key)
+	b.StateRoot = bc.State().Root()
+	assert.Nil(t, b.Sign(key))
+	assert.NotNil(t, bc.AddBlock(b))
+	assert.Equal(t, uint64(20), bc.GetAccount(addr).Balance)
+}
+
+func TestEngineRevertUndoesFinalize(t *testing.T) {
+	bc := newEngineChain(t, rewardEngine{reward: 10})
+	key := crypto.GeneratePrivateKey()
+
+	state := bc.State()
+	root := state.Root()
+	undo, err := state.applyBlock(engineBlock(t, bc, key), bc.Engine)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), state.GetAccount(key.PublicKey().Address()).Balance)
+
+	state.revertBlock(undo)
+	assert.Equal(t, root, state.Root())
+}
+
+func TestEngineVerifiesHeaders(t *testing.T) {
+	bc := newEngineChain(t, rewardEngine{reward: 10})
+	key := crypto.GeneratePrivateKey()
+
+	prev, err := bc.GetHeader(0)
+	assert.Nil(t, err)
+	b := engineBlock(t, bc, key)
+	b.Timestamp = prev.Timestamp
+	assert.Nil(t, b.Sign(key))
+	assert.NotNil(t, bc.AddBlock(b))
+	assert.Equal(t, uint32(0), bc.Height())
+}
+
+func TestProofOfAuthorityPrepare(t *testing.T) {
+	keys := authorityKeys(2)
+	bc := newAuthorityChain(t, keys)
+
+	header := &Header{Height: 1}
+	assert.Nil(t, bc.Engine.Prepare(bc, header, keys[1].PublicKey().Address()))
+
+	err := bc.Engine.Prepare(bc, header, keys[0].PublicKey().Address())
+	assert.ErrorIs(t, err, ErrNotProposer)
+
+	// chains without validators are open to any producer
+	open := newEngineChain(t, ProofOfAuthority{})
+	assert.Nil(t, open.Engine.Prepare(open, header, types.Address{}))
+}
@@ -0,0 +1,440 @@
+/***************************************************************
+ * Arquivo: file_storage.go
+ * Descrição: Implementação do armazenamento de blocos em disco.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações:
+ ***************************************************************/
+
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+const (
+	indexFileName        = "index"
+	segmentFileFormat    = "segment-%06d"
+	defaultSegmentSize   = 64 * 1024 * 1024
+	recordHeaderSize     = 8
+	indexEntrySize       = 48
+	maxRecordPayloadSize = 1 << 30
+)
+
+// indexEntry locates one block inside the segment files. Entry i of the
+// index always holds the block at height i.
+type indexEntry struct {
+	Hash    types.Hash
+	Segment uint32
+	Offset  uint64
+	Size    uint32
+}
+
+func (e indexEntry) bytes() []byte {
+	buf := make([]byte, indexEntrySize)
+	copy(buf[:32], e.Hash[:])
+	binary.BigEndian.PutUint32(buf[32:36], e.Segment)
+	binary.BigEndian.PutUint64(buf[36:44], e.Offset)
+	binary.BigEndian.PutUint32(buf[44:48], e.Size)
+	return buf
+}
+
+func indexEntryFromBytes(b []byte) indexEntry {
+	return indexEntry{
+		Hash:    types.HashFromBytes(b[:32]),
+		Segment: binary.BigEndian.Uint32(b[32:36]),
+		Offset:  binary.BigEndian.Uint64(b[36:44]),
+		Size:    binary.BigEndian.Uint32(b[44:48]),
+	}
+}
+
+// FileStore is an append-only block store. Blocks are written in their
+// canonical encoding as length-prefixed, checksummed records into segment
+// files and an index file maps every height to its record. Both files are
+// fsynced on every Put, data first and index second, so after a crash the
+// index never points to data that did not reach the disk.
+type FileStore struct {
+	dir         string
+	segmentSize int64
+
+	lock    sync.RWMutex
+	index   []indexEntry
+	heights map[types.Hash]uint32
+	idxFile *os.File
+	segment *os.File
+	segID   uint32
+	segLen  int64
+}
+
+// NewFileStore opens (or creates) a block store in dir, repairing any torn
+// write left behind by a previous crash.
+func NewFileStore(dir string) (*FileStore, error) {
+	return newFileStore(dir, defaultSegmentSize)
+}
+
+func newFileStore(dir string, segmentSize int64) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	idxFile, err := os.OpenFile(filepath.Join(dir, indexFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &FileStore{
+		dir:         dir,
+		segmentSize: segmentSize,
+		idxFile:     idxFile,
+		heights:     make(map[types.Hash]uint32),
+	}
+
+	if err := fs.recover(); err != nil {
+		fs.Close()
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+func (fs *FileStore) Put(b *Block) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	if b.Height != uint32(len(fs.index)) {
+		return fmt.Errorf("file store expected block at height (%d), got (%d)", len(fs.index), b.Height)
+	}
+
+	payload := MarshalBlock(b)
+	record := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeaderSize:], payload)
+
+	if fs.segLen > 0 && fs.segLen+int64(len(record)) > fs.segmentSize {
+		if err := fs.openSegment(fs.segID + 1); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fs.segment.WriteAt(record, fs.segLen); err != nil {
+		return err
+	}
+	if err := fs.segment.Sync(); err != nil {
+		return err
+	}
+
+	entry := indexEntry{
+		Hash:    b.Hash(BlockHasher{}),
+		Segment: fs.segID,
+		Offset:  uint64(fs.segLen),
+		Size:    uint32(len(record)),
+	}
+	if _, err := fs.idxFile.WriteAt(entry.bytes(), int64(len(fs.index))*indexEntrySize); err != nil {
+		return err
+	}
+	if err := fs.idxFile.Sync(); err != nil {
+		return err
+	}
+
+	fs.segLen += int64(len(record))
+	fs.index = append(fs.index, entry)
+	fs.heights[entry.Hash] = b.Height
+	return nil
+}
+
+func (fs *FileStore) Get(hash types.Hash) (*Block, error) {
+	fs.lock.RLock()
+	height, ok := fs.heights[hash]
+	fs.lock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("block (%s) not found", hash)
+	}
+	return fs.GetByHeight(height)
+}
+
+func (fs *FileStore) GetByHeight(height uint32) (*Block, error) {
+	fs.lock.RLock()
+	if height >= uint32(len(fs.index)) {
+		fs.lock.RUnlock()
+		return nil, fmt.Errorf("block at height (%d) not found", height)
+	}
+	entry := fs.index[height]
+	fs.lock.RUnlock()
+
+	return fs.readBlock(entry)
+}
+
+func (fs *FileStore) Has(hash types.Hash) bool {
+	fs.lock.RLock()
+	defer fs.lock.RUnlock()
+
+	_, ok := fs.heights[hash]
+	return ok
+}
+
+func (fs *FileStore) Range(from, to uint32, fn func(*Block) bool) error {
+	fs.lock.RLock()
+	entries := fs.index
+	fs.lock.RUnlock()
+
+	for h := int(from); h <= int(to) && h < len(entries); h++ {
+		b, err := fs.readBlock(entries[h])
+		if err != nil {
+			return err
+		}
+		if !fn(b) {
+			break
+		}
+	}
+	return nil
+}
+
+func (fs *FileStore) Len() int {
+	fs.lock.RLock()
+	defer fs.lock.RUnlock()
+	return len(fs.index)
+}
+
+// Rollback drops every block above height. The segments are cut before the
+// index, so after a crash in between recovery finds index entries pointing
+// past the data and drops them as well.
+func (fs *FileStore) Rollback(height uint32) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	if height >= uint32(len(fs.index)) {
+		return fmt.Errorf("cannot roll back to height (%d), store has %d blocks", height, len(fs.index))
+	}
+
+	last := fs.index[height]
+	for id := fs.segID; id > last.Segment; id-- {
+		if err := os.Remove(fs.segmentPath(id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := fs.openSegment(last.Segment); err != nil {
+		return err
+	}
+
+	end := int64(last.Offset) + int64(last.Size)
+	if err := fs.segment.Truncate(end); err != nil {
+		return err
+	}
+	if err := fs.segment.Sync(); err != nil {
+		return err
+	}
+	fs.segLen = end
+
+	if err := fs.idxFile.Truncate(int64(height+1) * indexEntrySize); err != nil {
+		return err
+	}
+	for _, entry := range fs.index[height+1:] {
+		delete(fs.heights, entry.Hash)
+	}
+	fs.index = fs.index[:height+1]
+
+	return fs.idxFile.Sync()
+}
+
+func (fs *FileStore) Close() error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	var err error
+	if fs.segment != nil {
+		err = fs.segment.Close()
+		fs.segment = nil
+	}
+	if fs.idxFile != nil {
+		if cerr := fs.idxFile.Close(); err == nil {
+			err = cerr
+		}
+		fs.idxFile = nil
+	}
+	return err
+}
+
+func (fs *FileStore) readBlock(entry indexEntry) (*Block, error) {
+	f, err := os.Open(fs.segmentPath(entry.Segment))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	payload, err := readRecord(f, int64(entry.Offset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block (%s): %s", entry.Hash, err)
+	}
+	return UnmarshalBlock(payload)
+}
+
+// recover loads the index and brings the files back to a consistent state:
+// a partially written index entry is discarded, complete records that made
+// it to the segment but not to the index are re-indexed, and anything after
+// the last valid record is truncated.
+func (fs *FileStore) recover() error {
+	raw, err := io.ReadAll(fs.idxFile)
+	if err != nil {
+		return err
+	}
+
+	valid := len(raw) - len(raw)%indexEntrySize
+	for i := 0; i < valid; i += indexEntrySize {
+		fs.index = append(fs.index, indexEntryFromBytes(raw[i:i+indexEntrySize]))
+	}
+
+	// drop trailing entries whose record is missing or corrupted
+	for len(fs.index) > 0 {
+		last := fs.index[len(fs.index)-1]
+		if _, err := fs.readBlock(last); err == nil {
+			break
+		}
+		fs.index = fs.index[:len(fs.index)-1]
+	}
+
+	if err := fs.idxFile.Truncate(int64(len(fs.index)) * indexEntrySize); err != nil {
+		return err
+	}
+
+	var (
+		segID  uint32
+		offset int64
+	)
+	if len(fs.index) > 0 {
+		last := fs.index[len(fs.index)-1]
+		segID = last.Segment
+		offset = int64(last.Offset) + int64(last.Size)
+	}
+
+	if err := fs.openSegment(segID); err != nil {
+		return err
+	}
+	if err := fs.reindexTail(offset); err != nil {
+		return err
+	}
+
+	// segments created after the last record are leftovers of a rotation
+	// that never received data
+	for id := fs.segID + 1; ; id++ {
+		path := fs.segmentPath(id)
+		if _, err := os.Stat(path); err != nil {
+			break
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	for height, entry := range fs.index {
+		fs.heights[entry.Hash] = uint32(height)
+	}
+
+	return fs.idxFile.Sync()
+}
+
+// reindexTail scans the current segment from offset, indexing every complete
+// record, and truncates the segment at the first torn or corrupted one.
+func (fs *FileStore) reindexTail(offset int64) error {
+	for {
+		payload, err := readRecord(fs.segment, offset)
+		if err != nil {
+			break
+		}
+
+		b, err := UnmarshalBlock(payload)
+		if err != nil || b.Height != uint32(len(fs.index)) {
+			break
+		}
+
+		entry := indexEntry{
+			Hash:    b.Hash(BlockHasher{}),
+			Segment: fs.segID,
+			Offset:  uint64(offset),
+			Size:    uint32(recordHeaderSize + len(payload)),
+		}
+		if _, err := fs.idxFile.WriteAt(entry.bytes(), int64(len(fs.index))*indexEntrySize); err != nil {
+			return err
+		}
+		fs.index = append(fs.index, entry)
+		offset += int64(entry.Size)
+	}
+
+	if err := fs.segment.Truncate(offset); err != nil {
+		return err
+	}
+	fs.segLen = offset
+	return fs.segment.Sync()
+}
+
+func (fs *FileStore) openSegment(id uint32) error {
+	f, err := os.OpenFile(fs.segmentPath(id), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := syncDir(fs.dir); err != nil {
+		f.Close()
+		return err
+	}
+
+	if fs.segment != nil {
+		fs.segment.Close()
+	}
+	fs.segment = f
+	fs.segID = id
+	fs.segLen = info.Size()
+	return nil
+}
+
+func (fs *FileStore) segmentPath(id uint32) string {
+	return filepath.Join(fs.dir, fmt.Sprintf(segmentFileFormat, id))
+}
+
+func readRecord(r io.ReaderAt, offset int64) ([]byte, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := r.ReadAt(header, offset); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecordPayloadSize {
+		return nil, fmt.Errorf("record size (%d) is too large", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := r.ReadAt(payload, offset+recordHeaderSize); err != nil {
+		return nil, err
+	}
+
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("record checksum mismatch")
+	}
+	return payload, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,199 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStorePutAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	genesis := randomBlock(t, 0, BlockHasher{}.Hash(&Header{}))
+
+	store, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	bc, err := NewBlockChainWithStore(store, genesis)
+	assert.Nil(t, err)
+
+	for i := 1; i <= 10; i++ {
+		assert.Nil(t, bc.AddBlock(randomBlock(t, uint32(i), getPrevBlockHash(t, bc, uint32(i)))))
+	}
+	assert.Nil(t, store.Close())
+
+	store, err = NewFileStore(dir)
+	assert.Nil(t, err)
+	defer store.Close()
+
+	reopened, err := NewBlockChainWithStore(store, genesis)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(10), reopened.Height())
+
+	for i := uint32(0); i <= 10; i++ {
+		want, _ := bc.GetHeader(i)
+		got, err := reopened.GetHeader(i)
+		assert.Nil(t, err)
+		assert.Equal(t, BlockHasher{}.Hash(want), BlockHasher{}.Hash(got))
+	}
+
+	assert.Nil(t, reopened.AddBlock(randomBlock(t, 11, getPrevBlockHash(t, reopened, 11))))
+}
+
+func TestFileStoreTxIndexSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	genesis := randomBlock(t, 0, BlockHasher{}.Hash(&Header{}))
+
+	store, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	bc, err := NewBlockChainWithStore(store, genesis)
+	assert.Nil(t, err)
+
+	tx := NewTransaction([]byte("indexed"))
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+	block := blockWithTransactions(t, 1, getPrevBlockHash(t, bc, 1), []Transaction{*tx})
+	assert.Nil(t, bc.AddBlock(block))
+	assert.Nil(t, store.Close())
+
+	store, err = NewFileStore(dir)
+	assert.Nil(t, err)
+	defer store.Close()
+
+	reopened, err := NewBlockChainWithStore(store, genesis)
+	assert.Nil(t, err)
+
+	got, loc, err := reopened.GetTransaction(tx.Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, tx.Data, got.Data)
+	assert.Equal(t, TxLocation{BlockHash: block.Hash(BlockHasher{}), Height: 1, Index: 0}, loc)
+}
+
+func TestFileStoreGenesisMismatch(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	_, err = NewBlockChainWithStore(store, randomBlock(t, 0, BlockHasher{}.Hash(&Header{})))
+	assert.Nil(t, err)
+	assert.Nil(t, store.Close())
+
+	store, err = NewFileStore(dir)
+	assert.Nil(t, err)
+	defer store.Close()
+
+	_, err = NewBlockChainWithStore(store, randomBlock(t, 0, BlockHasher{}.Hash(&Header{})))
+	assert.NotNil(t, err)
+}
+
+func TestFileStoreRejectsOutOfOrderBlock(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+	defer store.Close()
+
+	assert.NotNil(t, store.Put(randomBlock(t, 3, BlockHasher{}.Hash(&Header{}))))
+}
+
+func TestFileStoreRecoversTornWrites(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, store.Put(randomBlock(t, uint32(i), BlockHasher{}.Hash(&Header{}))))
+	}
+	assert.Nil(t, store.Close())
+
+	// a half written index entry and a half written record
+	appendBytes(t, filepath.Join(dir, indexFileName), make([]byte, indexEntrySize/2))
+	appendBytes(t, filepath.Join(dir, "segment-000000"), []byte{0, 0, 1, 0, 1, 2, 3})
+
+	store, err = NewFileStore(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, store.Len())
+	assert.Nil(t, store.Put(randomBlock(t, 3, BlockHasher{}.Hash(&Header{}))))
+	assert.Nil(t, store.Close())
+
+	store, err = NewFileStore(dir)
+	assert.Nil(t, err)
+	defer store.Close()
+	assert.Equal(t, 4, store.Len())
+}
+
+func TestFileStoreReindexesUnindexedRecords(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, store.Put(randomBlock(t, uint32(i), BlockHasher{}.Hash(&Header{}))))
+	}
+	assert.Nil(t, store.Close())
+
+	// the records reached the segment but the crash happened before the
+	// last index entry was written
+	idx := filepath.Join(dir, indexFileName)
+	assert.Nil(t, os.Truncate(idx, indexEntrySize))
+
+	store, err = NewFileStore(dir)
+	assert.Nil(t, err)
+	defer store.Close()
+
+	assert.Equal(t, 3, store.Len())
+	b, err := store.GetByHeight(2)
+	assert.Nil(t, err)
+	assert.True(t, store.Has(b.Hash(BlockHasher{})))
+}
+
+func TestFileStoreRotatesSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := newFileStore(dir, 1024)
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, store.Put(randomBlock(t, uint32(i), BlockHasher{}.Hash(&Header{}))))
+	}
+	assert.Nil(t, store.Close())
+
+	segments, err := filepath.Glob(filepath.Join(dir, "segment-*"))
+	assert.Nil(t, err)
+	assert.Greater(t, len(segments), 1)
+
+	store, err = newFileStore(dir, 1024)
+	assert.Nil(t, err)
+	defer store.Close()
+
+	count := 0
+	assert.Nil(t, store.Range(0, 10, func(b *Block) bool {
+		assert.Equal(t, uint32(count), b.Height)
+		count++
+		return true
+	}))
+	assert.Equal(t, 5, count)
+}
+
+func TestFileStoreGet(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+	defer store.Close()
+
+	b := randomBlock(t, 0, BlockHasher{}.Hash(&Header{}))
+	assert.Nil(t, store.Put(b))
+
+	got, err := store.Get(b.Hash(BlockHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, MarshalBlock(b), MarshalBlock(got))
+
+	_, err = store.Get(BlockHasher{}.Hash(&Header{}))
+	assert.NotNil(t, err)
+	_, err = store.GetByHeight(1)
+	assert.NotNil(t, err)
+}
+
+func appendBytes(t *testing.T, path string, data []byte) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.Nil(t, err)
+	_, err = f.Write(data)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
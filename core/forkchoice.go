@@ -0,0 +1,72 @@
+/***************************************************************
+ * Arquivo: forkchoice.go
+ * Descrição: Regras de escolha entre ramos concorrentes da cadeia.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações:
+ ***************************************************************/
+
+package core
+
+import (
+	"math/big"
+
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+// ForkChoice decides which branch of the block tree is the canonical chain.
+// Every block adds its Weight to the weight of its branch and the chain
+// follows the heaviest branch. On a tie the current branch is kept.
+type ForkChoice interface {
+	Weight(*Header) *big.Int
+}
+
+// LongestChain gives every block the same weight, so the highest branch
+// wins.
+type LongestChain struct{}
+
+func (LongestChain) Weight(*Header) *big.Int {
+	return big.NewInt(1)
+}
+
+// ChainEvent describes a change of the canonical chain. Reverted holds the
+// blocks that left the chain, from the old tip down, and Applied the blocks
+// that joined it, in height order. A plain extension only has Applied.
+type ChainEvent struct {
+	Reverted []*Block
+	Applied  []*Block
+}
+
+// ChainListener is notified after every change of the canonical chain. It
+// runs while the chain is still locked for writing and must not add blocks.
+type ChainListener func(ChainEvent)
+
+// blockNode is an entry of the block tree. Blocks of the canonical chain
+// live in the storage, so only side branch nodes keep the full block.
+type blockNode struct {
+	hash      types.Hash
+	header    *Header
+	parent    *blockNode
+	weight    *big.Int
+	canonical bool
+	block     *Block
+	children  []*blockNode
+	// undo reverts the state changes of a canonical block
+	undo *stateUndo
+}
+
+func newBlockNode(hash types.Hash, h *Header, parent *blockNode, weight *big.Int) *blockNode {
+	total := new(big.Int).Set(weight)
+	if parent != nil {
+		total.Add(total, parent.weight)
+	}
+
+	return &blockNode{
+		hash:   hash,
+		header: h,
+		parent: parent,
+		weight: total,
+	}
+}
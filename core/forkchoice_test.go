@@ -0,0 +1,210 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSideBranchDoesNotReorgOnTie(t *testing.T) {
+	bc := newBlockChainWithGenesis(t)
+	genesis, _ := bc.GetHeader(0)
+
+	a1 := randomBlock(t, 1, BlockHasher{}.Hash(genesis))
+	b1 := randomBlock(t, 1, BlockHasher{}.Hash(genesis))
+
+	assert.Nil(t, bc.AddBlock(a1))
+	assert.Nil(t, bc.AddBlock(b1))
+
+	tip, _ := bc.GetHeader(1)
+	assert.Equal(t, a1.Header, tip)
+	assert.True(t, bc.HasBlockHash(b1.Hash(BlockHasher{})))
+
+	side, err := bc.GetBlockByHash(b1.Hash(BlockHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, b1, side)
+
+	assert.NotNil(t, bc.AddBlock(b1))
+}
+
+func TestReorgToLongerBranch(t *testing.T) {
+	bc := newBlockChainWithGenesis(t)
+	genesis, _ := bc.GetHeader(0)
+
+	events := []ChainEvent{}
+	bc.Subscribe(func(ev ChainEvent) { events = append(events, ev) })
+
+	a1 := blockWithTransactions(t, 1, BlockHasher{}.Hash(genesis), []Transaction{signedTx(t, "a1")})
+	a2 := blockWithTransactions(t, 2, a1.Hash(BlockHasher{}), []Transaction{signedTx(t, "a2")})
+	assert.Nil(t, bc.AddBlock(a1))
+	assert.Nil(t, bc.AddBlock(a2))
+
+	b1 := blockWithTransactions(t, 1, BlockHasher{}.Hash(genesis), []Transaction{signedTx(t, "b1")})
+	b2 := blockWithTransactions(t, 2, b1.Hash(BlockHasher{}), []Transaction{signedTx(t, "b2")})
+	b3 := blockWithTransactions(t, 3, b2.Hash(BlockHasher{}), []Transaction{signedTx(t, "b3")})
+	assert.Nil(t, bc.AddBlock(b1))
+	assert.Nil(t, bc.AddBlock(b2))
+	assert.Equal(t, uint32(2), bc.Height())
+	assert.Len(t, events, 2)
+
+	assert.Nil(t, bc.AddBlock(b3))
+	assert.Equal(t, uint32(3), bc.Height())
+
+	for i, b := range []*Block{b1, b2, b3} {
+		stored, err := bc.GetBlock(uint32(i + 1))
+		assert.Nil(t, err)
+		assert.Equal(t, b.Hash(BlockHasher{}), stored.Hash(BlockHasher{}))
+	}
+
+	assert.Len(t, events, 3)
+	reorg := events[2]
+	assert.Equal(t, []*Block{a2, a1}, reorg.Reverted)
+	assert.Equal(t, []*Block{b1, b2, b3}, reorg.Applied)
+
+	_, _, err := bc.GetTransaction(a1.Transactions[0].Hash(TxHasher{}))
+	assert.NotNil(t, err)
+	_, loc, err := bc.GetTransaction(b2.Transactions[0].Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, b2.Hash(BlockHasher{}), loc.BlockHash)
+
+	// the old branch is kept and can win back
+	a3 := randomBlock(t, 3, a2.Hash(BlockHasher{}))
+	a4 := randomBlock(t, 4, a3.Hash(BlockHasher{}))
+	assert.Nil(t, bc.AddBlock(a3))
+	assert.Nil(t, bc.AddBlock(a4))
+	tip, _ := bc.GetHeader(4)
+	assert.Equal(t, a4.Header, tip)
+}
+
+func TestReorgWithFileStore(t *testing.T) {
+	dir := t.TempDir()
+	genesis := randomBlock(t, 0, BlockHasher{}.Hash(&Header{}))
+
+	store, err := newFileStore(dir, 2048)
+	assert.Nil(t, err)
+	bc, err := NewBlockChainWithStore(store, genesis)
+	assert.Nil(t, err)
+
+	prev := genesis.Hash(BlockHasher{})
+	for i := 1; i <= 4; i++ {
+		b := randomBlock(t, uint32(i), prev)
+		assert.Nil(t, bc.AddBlock(b))
+		prev = b.Hash(BlockHasher{})
+	}
+
+	first, _ := bc.GetHeader(1)
+	prev = BlockHasher{}.Hash(first)
+	for i := 2; i <= 5; i++ {
+		b := randomBlock(t, uint32(i), prev)
+		assert.Nil(t, bc.AddBlock(b))
+		prev = b.Hash(BlockHasher{})
+	}
+	assert.Equal(t, uint32(5), bc.Height())
+	assert.Nil(t, store.Close())
+
+	store, err = newFileStore(dir, 2048)
+	assert.Nil(t, err)
+	defer store.Close()
+
+	reopened, err := NewBlockChainWithStore(store, genesis)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(5), reopened.Height())
+	tip, _ := reopened.GetHeader(5)
+	assert.Equal(t, prev, BlockHasher{}.Hash(tip))
+}
+
+func TestInvalidSideBranchIsDropped(t *testing.T) {
+	bc := newBlockChainWithGenesis(t)
+	genesis, _ := bc.GetHeader(0)
+
+	a1 := randomBlock(t, 1, BlockHasher{}.Hash(genesis))
+	a2 := randomBlock(t, 2, a1.Hash(BlockHasher{}))
+	assert.Nil(t, bc.AddBlock(a1))
+	assert.Nil(t, bc.AddBlock(a2))
+
+	// b1 commits a wrong state root, which is only found when its branch
+	// is applied
+	b1 := randomBlock(t, 1, BlockHasher{}.Hash(genesis))
+	b1.StateRoot = types.Hash{1}
+	assert.Nil(t, b1.Sign(crypto.GeneratePrivateKey()))
+	b2 := randomBlock(t, 2, b1.Hash(BlockHasher{}))
+	c2 := randomBlock(t, 2, b1.Hash(BlockHasher{}))
+	c3 := randomBlock(t, 3, c2.Hash(BlockHasher{}))
+	b3 := randomBlock(t, 3, b2.Hash(BlockHasher{}))
+	for _, b := range []*Block{b1, b2, c2} {
+		assert.Nil(t, bc.AddBlock(b))
+	}
+	// c3 outweighs the chain, the reorganization fails at b1 and drops
+	// every descendant of it, b2 included
+	assert.NotNil(t, bc.AddBlock(c3))
+	assert.Equal(t, uint32(2), bc.Height())
+
+	for _, b := range []*Block{b1, b2, c2, c3} {
+		assert.False(t, bc.HasBlockHash(b.Hash(BlockHasher{})))
+	}
+	assert.NotNil(t, bc.AddBlock(b3))
+	assert.False(t, bc.HasBlockHash(b3.Hash(BlockHasher{})))
+}
+
+func TestDeepSideBranchesArePruned(t *testing.T) {
+	bc := newBlockChainWithGenesis(t)
+	genesis, _ := bc.GetHeader(0)
+
+	a1 := randomBlock(t, 1, BlockHasher{}.Hash(genesis))
+	b1 := randomBlock(t, 1, BlockHasher{}.Hash(genesis))
+	assert.Nil(t, bc.AddBlock(a1))
+	assert.Nil(t, bc.AddBlock(b1))
+
+	prev := a1.Hash(BlockHasher{})
+	for i := uint32(2); i <= MaxReorgDepth; i++ {
+		b := randomBlock(t, i, prev)
+		assert.Nil(t, bc.AddBlock(b))
+		prev = b.Hash(BlockHasher{})
+	}
+	assert.True(t, bc.HasBlockHash(b1.Hash(BlockHasher{})))
+
+	b := randomBlock(t, MaxReorgDepth+1, prev)
+	assert.Nil(t, bc.AddBlock(b))
+	assert.False(t, bc.HasBlockHash(b1.Hash(BlockHasher{})))
+
+	// no new branch can fork that deep either
+	assert.NotNil(t, bc.AddBlock(randomBlock(t, 1, BlockHasher{}.Hash(genesis))))
+}
+
+type heavyBlocks struct {
+	heavy *Block
+}
+
+func (h heavyBlocks) Weight(header *Header) *big.Int {
+	if h.heavy != nil && header == h.heavy.Header {
+		return big.NewInt(10)
+	}
+	return big.NewInt(1)
+}
+
+func TestCustomForkChoice(t *testing.T) {
+	bc := newBlockChainWithGenesis(t)
+	genesis, _ := bc.GetHeader(0)
+
+	a1 := randomBlock(t, 1, BlockHasher{}.Hash(genesis))
+	a2 := randomBlock(t, 2, a1.Hash(BlockHasher{}))
+	b1 := randomBlock(t, 1, BlockHasher{}.Hash(genesis))
+	bc.SetForkChoice(heavyBlocks{heavy: b1})
+
+	assert.Nil(t, bc.AddBlock(a1))
+	assert.Nil(t, bc.AddBlock(a2))
+	assert.Nil(t, bc.AddBlock(b1))
+
+	assert.Equal(t, uint32(1), bc.Height())
+	tip, _ := bc.GetHeader(1)
+	assert.Equal(t, b1.Header, tip)
+}
+
+func signedTx(t *testing.T, data string) Transaction {
+	tx := NewTransaction([]byte(data))
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+	return *tx
+}
@@ -32,6 +32,8 @@ type TxHasher struct {
 
 }
 
+// Hash hashes the canonical encoding of the transaction without its
+// signature, so re-signing a transaction does not change its hash.
 func (TxHasher) Hash(tx*Transaction) types.Hash {
-	return types.Hash(sha256.Sum256(tx.Data)) 
+	return types.Hash(sha256.Sum256(tx.signingBytes()))
 }
\ No newline at end of file
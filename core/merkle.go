@@ -0,0 +1,128 @@
+/***************************************************************
+ * Arquivo: merkle.go
+ * Descrição: Árvore de Merkle das transações e provas de inclusão.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: Segue a construção da RFC 6962 (Certificate
+ * Transparency), com prefixos distintos para folhas e nós.
+ ***************************************************************/
+
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+const (
+	merkleLeafPrefix byte = 0x00
+	merkleNodePrefix byte = 0x01
+)
+
+// MerkleProof is the audit path that links one leaf to the root of a tree
+// with Total leaves.
+type MerkleProof struct {
+	Index uint32
+	Total uint32
+	Path  []types.Hash
+}
+
+// MerkleRoot returns the root of the tree built over the given leaves. The
+// root of an empty tree is the hash of the empty string.
+func MerkleRoot(leaves []types.Hash) types.Hash {
+	if len(leaves) == 0 {
+		return types.Hash(sha256.Sum256(nil))
+	}
+	return merkleSubtree(leaves)
+}
+
+// NewMerkleProof builds the inclusion proof of the leaf at index.
+func NewMerkleProof(leaves []types.Hash, index int) (*MerkleProof, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf index (%d) out of range, tree has %d leaves", index, len(leaves))
+	}
+
+	return &MerkleProof{
+		Index: uint32(index),
+		Total: uint32(len(leaves)),
+		Path:  merklePath(index, leaves),
+	}, nil
+}
+
+// Verify checks that leaf is at position p.Index of the tree with the given
+// root.
+func (p *MerkleProof) Verify(leaf types.Hash, root types.Hash) bool {
+	if p.Index >= p.Total {
+		return false
+	}
+
+	fn, sn := p.Index, p.Total-1
+	r := merkleLeafHash(leaf)
+
+	for _, sibling := range p.Path {
+		if sn == 0 {
+			return false
+		}
+
+		if fn&1 == 1 || fn == sn {
+			r = merkleNodeHash(sibling, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNodeHash(r, sibling)
+		}
+
+		fn >>= 1
+		sn >>= 1
+	}
+
+	return sn == 0 && r == root
+}
+
+func merkleSubtree(leaves []types.Hash) types.Hash {
+	if len(leaves) == 1 {
+		return merkleLeafHash(leaves[0])
+	}
+
+	k := merkleSplit(len(leaves))
+	return merkleNodeHash(merkleSubtree(leaves[:k]), merkleSubtree(leaves[k:]))
+}
+
+func merklePath(index int, leaves []types.Hash) []types.Hash {
+	if len(leaves) == 1 {
+		return []types.Hash{}
+	}
+
+	k := merkleSplit(len(leaves))
+	if index < k {
+		return append(merklePath(index, leaves[:k]), merkleSubtree(leaves[k:]))
+	}
+	return append(merklePath(index-k, leaves[k:]), merkleSubtree(leaves[:k]))
+}
+
+// merkleSplit returns the largest power of two smaller than n.
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+func merkleLeafHash(leaf types.Hash) types.Hash {
+	return types.Hash(sha256.Sum256(append([]byte{merkleLeafPrefix}, leaf[:]...)))
+}
+
+func merkleNodeHash(left, right types.Hash) types.Hash {
+	buf := make([]byte, 0, 1+2*len(left))
+	buf = append(buf, merkleNodePrefix)
+	buf = append(buf, left[:]...)
+	buf = append(buf, right[:]...)
+	return types.Hash(sha256.Sum256(buf))
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerkleRootSmallTrees(t *testing.T) {
+	a, b, c := leafN(1), leafN(2), leafN(3)
+
+	assert.Equal(t, types.Hash(sha256.Sum256(nil)), MerkleRoot(nil))
+	assert.Equal(t, merkleLeafHash(a), MerkleRoot([]types.Hash{a}))
+
+	ab := merkleNodeHash(merkleLeafHash(a), merkleLeafHash(b))
+	assert.Equal(t, ab, MerkleRoot([]types.Hash{a, b}))
+
+	// the odd leaf is promoted, not duplicated
+	assert.Equal(t, merkleNodeHash(ab, merkleLeafHash(c)), MerkleRoot([]types.Hash{a, b, c}))
+}
+
+func TestMerkleProofAllSizes(t *testing.T) {
+	for n := 1; n <= 33; n++ {
+		leaves := make([]types.Hash, n)
+		for i := range leaves {
+			leaves[i] = leafN(i)
+		}
+		root := MerkleRoot(leaves)
+
+		for i := 0; i < n; i++ {
+			proof, err := NewMerkleProof(leaves, i)
+			assert.Nil(t, err)
+			assert.True(t, proof.Verify(leaves[i], root), "n=%d i=%d", n, i)
+			assert.False(t, proof.Verify(leafN(1000), root), "n=%d i=%d", n, i)
+		}
+	}
+}
+
+func TestMerkleProofTampered(t *testing.T) {
+	leaves := []types.Hash{leafN(0), leafN(1), leafN(2), leafN(3), leafN(4)}
+	root := MerkleRoot(leaves)
+
+	proof, err := NewMerkleProof(leaves, 2)
+	assert.Nil(t, err)
+
+	wrongIndex := *proof
+	wrongIndex.Index = 3
+	assert.False(t, wrongIndex.Verify(leaves[2], root))
+
+	wrongTotal := *proof
+	wrongTotal.Total = 4
+	assert.False(t, wrongTotal.Verify(leaves[2], root))
+
+	wrongPath := *proof
+	wrongPath.Path = append([]types.Hash{}, proof.Path...)
+	wrongPath.Path[0] = leafN(99)
+	assert.False(t, wrongPath.Verify(leaves[2], root))
+
+	_, err = NewMerkleProof(leaves, 5)
+	assert.NotNil(t, err)
+}
+
+func leafN(n int) types.Hash {
+	return types.Hash(sha256.Sum256([]byte{byte(n), byte(n >> 8)}))
+}
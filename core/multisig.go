@@ -0,0 +1,295 @@
+/***************************************************************
+ * Arquivo: multisig.go
+ * Descrição: Contas com várias assinaturas (M de N).
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: O endereço da conta é o hash da sua política. A
+ * política é registrada no estado por uma transação própria e a
+ * conta só pode gastar depois de registrada.
+ ***************************************************************/
+
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+// MaxMultisigKeys bounds the number of keys of a multisig policy.
+const MaxMultisigKeys = 16
+
+// multisigAddressDomain separates the hash of a policy from every signed
+// digest.
+const multisigAddressDomain = "crypto-go/multisig-address"
+
+// MultisigPolicy lets any Threshold of its Keys send transactions for the
+// account at Address. Funds can be sent to the address at any time, but they
+// can only be spent once a registration transaction stored the policy in the
+// state, by transactions carrying the registered policy and enough
+// approvals. The keys are sorted by their encoding, so a set of keys and a
+// threshold always give the same address.
+type MultisigPolicy struct {
+	Threshold uint8
+	Keys      []crypto.PublicKey
+}
+
+// NewMultisigPolicy returns the policy requiring threshold approvals among
+// keys.
+func NewMultisigPolicy(threshold int, keys ...crypto.PublicKey) (*MultisigPolicy, error) {
+	if threshold < 1 || threshold > len(keys) {
+		return nil, fmt.Errorf("invalid multisig threshold (%d) for (%d) keys", threshold, len(keys))
+	}
+
+	sorted := append([]crypto.PublicKey{}, keys...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].ToBytes(), sorted[j].ToBytes()) < 0
+	})
+	p := &MultisigPolicy{Threshold: uint8(threshold), Keys: sorted}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate checks the threshold and that the keys are sorted and distinct.
+func (p *MultisigPolicy) Validate() error {
+	if len(p.Keys) == 0 || len(p.Keys) > MaxMultisigKeys {
+		return fmt.Errorf("multisig policy must have between 1 and %d keys, has (%d)", MaxMultisigKeys, len(p.Keys))
+	}
+	if p.Threshold < 1 || int(p.Threshold) > len(p.Keys) {
+		return fmt.Errorf("invalid multisig threshold (%d) for (%d) keys", p.Threshold, len(p.Keys))
+	}
+
+	for i, k := range p.Keys {
+		if k.IsZero() {
+			return fmt.Errorf("multisig policy key (%d) is empty", i)
+		}
+		if i > 0 && bytes.Compare(p.Keys[i-1].ToBytes(), k.ToBytes()) >= 0 {
+			return fmt.Errorf("multisig policy keys are not sorted or not distinct")
+		}
+	}
+	return nil
+}
+
+// Address is the account of the policy, the last 20 bytes of the digest of
+// its canonical encoding.
+func (p *MultisigPolicy) Address() types.Address {
+	w := newCodecWriter()
+	w.multisig(p)
+	h := crypto.Digest(multisigAddressDomain, w.Bytes())
+	return types.AddressFromBytes(h[len(h)-20:])
+}
+
+// NewRegisterMultisigTransaction creates the transaction registering the
+// policy. Any account can send it, the nonce must match the nonce of the
+// sender account.
+func NewRegisterMultisigTransaction(p *MultisigPolicy, nonce uint64) *Transaction {
+	return &Transaction{
+		Type:  TxTypeRegisterMultisig,
+		Data:  MarshalMultisigPolicy(p),
+		Nonce: nonce,
+	}
+}
+
+// GetMultisigPolicy returns the policy registered for the account at addr.
+func (s *State) GetMultisigPolicy(addr types.Address) (*MultisigPolicy, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	p, ok := s.policies[addr]
+	return p, ok
+}
+
+// the helpers below must be called with the lock held
+
+// applyRegisterMultisig stores the policy carried by a registration. A
+// policy is registered once and never changes.
+func (s *State) applyRegisterMultisig(tx *Transaction, journal *stateUndo) error {
+	if tx.To != (types.Address{}) || tx.Value != 0 {
+		return fmt.Errorf("multisig registration cannot carry a recipient or value")
+	}
+	p, err := UnmarshalMultisigPolicy(tx.Data)
+	if err != nil {
+		return fmt.Errorf("invalid multisig registration: %s", err)
+	}
+
+	from, sender, err := s.sender(tx)
+	if err != nil {
+		return err
+	}
+	addr := p.Address()
+	if _, ok := s.policies[addr]; ok {
+		return fmt.Errorf("multisig policy of %s is already registered", addr)
+	}
+
+	sender.Nonce++
+	s.set(from, sender, journal)
+	s.setPolicy(addr, p, journal)
+	return nil
+}
+
+// checkMultisig checks that the policy carried by a multisig transaction is
+// the one registered for its account.
+func (s *State) checkMultisig(p *MultisigPolicy) error {
+	addr := p.Address()
+	registered, ok := s.policies[addr]
+	if !ok {
+		return fmt.Errorf("multisig policy of %s is not registered", addr)
+	}
+	if !bytes.Equal(MarshalMultisigPolicy(registered), MarshalMultisigPolicy(p)) {
+		return fmt.Errorf("multisig policy does not match the one registered for %s", addr)
+	}
+	return nil
+}
+
+func (s *State) setPolicy(addr types.Address, p *MultisigPolicy, undo *stateUndo) {
+	if undo != nil {
+		if _, ok := undo.policies[addr]; !ok {
+			undo.policies[addr] = s.policies[addr]
+		}
+	}
+
+	if p == nil {
+		delete(s.policies, addr)
+	} else {
+		s.policies[addr] = p
+	}
+}
+
+// multisigLeaves returns the state root leaves of the registered policies,
+// the hash of "multisig" | address | Policy, sorted by address.
+func (s *State) multisigLeaves() []types.Hash {
+	addrs := make([]types.Address, 0, len(s.policies))
+	for addr := range s.policies {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+
+	leaves := make([]types.Hash, len(addrs))
+	for i, addr := range addrs {
+		buf := append([]byte("multisig"), addr[:]...)
+		leaves[i] = sha256.Sum256(append(buf, MarshalMultisigPolicy(s.policies[addr])...))
+	}
+	return leaves
+}
+
+// indexOf returns the position of k in the keys, -1 if it is not one of
+// them.
+func (p *MultisigPolicy) indexOf(k crypto.PublicKey) int {
+	if k.IsZero() {
+		return -1
+	}
+	b := k.ToBytes()
+	for i, key := range p.Keys {
+		if bytes.Equal(key.ToBytes(), b) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Approval is the signature of a multisig transaction by one of the keys of
+// its policy.
+type Approval struct {
+	Key       crypto.PublicKey
+	Signature *crypto.Signature
+}
+
+// Approve adds the signature of privKey, one of the keys of the policy, to
+// a multisig transaction.
+func (tx *Transaction) Approve(privKey crypto.PrivateKey) error {
+	if tx.Multisig == nil {
+		return fmt.Errorf("transaction is not a multisig transaction")
+	}
+
+	sig, err := privKey.Sign(crypto.DomainTransaction, tx.signingBytes())
+	if err != nil {
+		return err
+	}
+	return tx.AddApproval(Approval{Key: privKey.PublicKey(), Signature: sig})
+}
+
+// AddApproval adds an approval to a multisig transaction, keeping the
+// approvals in the order of the policy keys. An approval of a key that
+// already approved replaces the previous one. The signature is not checked
+// here, Verify does it.
+func (tx *Transaction) AddApproval(a Approval) error {
+	if tx.Multisig == nil {
+		return fmt.Errorf("transaction is not a multisig transaction")
+	}
+	if a.Signature == nil {
+		return fmt.Errorf("approval has no signature")
+	}
+	index := tx.Multisig.indexOf(a.Key)
+	if index < 0 {
+		return fmt.Errorf("key %s is not part of the multisig policy", a.Key.Address())
+	}
+
+	pos := sort.Search(len(tx.Approvals), func(i int) bool {
+		return tx.Multisig.indexOf(tx.Approvals[i].Key) >= index
+	})
+	if pos < len(tx.Approvals) && tx.Multisig.indexOf(tx.Approvals[pos].Key) == index {
+		tx.Approvals[pos] = a
+		return nil
+	}
+	tx.Approvals = append(tx.Approvals, Approval{})
+	copy(tx.Approvals[pos+1:], tx.Approvals[pos:])
+	tx.Approvals[pos] = a
+	return nil
+}
+
+// HasApproval tells whether k already approved the transaction.
+func (tx *Transaction) HasApproval(k crypto.PublicKey) bool {
+	for _, a := range tx.Approvals {
+		if bytes.Equal(a.Key.ToBytes(), k.ToBytes()) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyApprovals checks the policy of a multisig transaction and every
+// approval it carries, and returns how many approvals are still missing to
+// reach the threshold. A partially approved transaction is valid here but
+// fails Verify.
+func (tx *Transaction) VerifyApprovals() (int, error) {
+	if tx.Multisig == nil {
+		return 0, fmt.Errorf("transaction is not a multisig transaction")
+	}
+	if !tx.From.IsZero() || tx.Signature != nil {
+		return 0, fmt.Errorf("multisig transaction cannot have a single signer")
+	}
+	if err := tx.Multisig.Validate(); err != nil {
+		return 0, err
+	}
+
+	data := tx.signingBytes()
+	last := -1
+	for _, a := range tx.Approvals {
+		index := tx.Multisig.indexOf(a.Key)
+		if index < 0 {
+			return 0, fmt.Errorf("approval key %s is not part of the multisig policy", a.Key.Address())
+		}
+		if index <= last {
+			return 0, fmt.Errorf("multisig approvals are not in the order of the policy keys")
+		}
+		last = index
+
+		if a.Signature == nil || !a.Signature.Verify(a.Key, crypto.DomainTransaction, data) {
+			return 0, fmt.Errorf("invalid approval signature of %s", a.Key.Address())
+		}
+	}
+
+	if missing := int(tx.Multisig.Threshold) - len(tx.Approvals); missing > 0 {
+		return missing, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func multisigKeys(t *testing.T) []crypto.PrivateKey {
+	ed, err := crypto.GenerateKey(crypto.KeyTypeEd25519)
+	assert.Nil(t, err)
+	return []crypto.PrivateKey{crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey(), ed}
+}
+
+func twoOfThree(t *testing.T, keys []crypto.PrivateKey) *MultisigPolicy {
+	policy, err := NewMultisigPolicy(2, keys[0].PublicKey(), keys[1].PublicKey(), keys[2].PublicKey())
+	assert.Nil(t, err)
+	return policy
+}
+
+func TestMultisigPolicy(t *testing.T) {
+	keys := multisigKeys(t)
+	policy := twoOfThree(t, keys)
+
+	// the order of the keys does not change the account
+	reordered, err := NewMultisigPolicy(2, keys[2].PublicKey(), keys[0].PublicKey(), keys[1].PublicKey())
+	assert.Nil(t, err)
+	assert.Equal(t, policy.Address(), reordered.Address())
+
+	other, err := NewMultisigPolicy(3, keys[0].PublicKey(), keys[1].PublicKey(), keys[2].PublicKey())
+	assert.Nil(t, err)
+	assert.NotEqual(t, policy.Address(), other.Address())
+
+	_, err = NewMultisigPolicy(0, keys[0].PublicKey())
+	assert.NotNil(t, err)
+	_, err = NewMultisigPolicy(2, keys[0].PublicKey())
+	assert.NotNil(t, err)
+	_, err = NewMultisigPolicy(1, keys[0].PublicKey(), keys[0].PublicKey())
+	assert.NotNil(t, err)
+}
+
+func TestMultisigApprovals(t *testing.T) {
+	keys := multisigKeys(t)
+	policy := twoOfThree(t, keys)
+
+	tx := NewTransferTransaction(types.Address{0x01}, 10, 0)
+	tx.Multisig = policy
+	assert.NotNil(t, tx.Sign(keys[0]))
+
+	assert.Nil(t, tx.Approve(keys[2]))
+	missing, err := tx.VerifyApprovals()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, missing)
+	assert.NotNil(t, tx.Verify())
+
+	// approving twice does not count twice
+	assert.Nil(t, tx.Approve(keys[2]))
+	assert.NotNil(t, tx.Verify())
+
+	assert.Nil(t, tx.Approve(keys[0]))
+	assert.Nil(t, tx.Verify())
+	sender, ok := tx.Sender()
+	assert.True(t, ok)
+	assert.Equal(t, policy.Address(), sender)
+
+	// outsiders cannot approve and approvals cover the whole transaction
+	assert.NotNil(t, tx.Approve(crypto.GeneratePrivateKey()))
+	tx.Value = 11
+	assert.NotNil(t, tx.Verify())
+}
+
+func TestMultisigEncodeDecode(t *testing.T) {
+	keys := multisigKeys(t)
+
+	tx := NewTransferTransaction(types.Address{0x01}, 10, 0)
+	tx.Multisig = twoOfThree(t, keys)
+	hash := tx.Hash(TxHasher{})
+	assert.Nil(t, tx.Approve(keys[1]))
+
+	// approvals are not part of the hash, every signer signs the same bytes
+	assert.Equal(t, hash, TxHasher{}.Hash(tx))
+
+	decoded, err := UnmarshalTransaction(MarshalTransaction(tx))
+	assert.Nil(t, err)
+	assert.Equal(t, MarshalTransaction(tx), MarshalTransaction(decoded))
+	missing, err := decoded.VerifyApprovals()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, missing)
+
+	assert.Nil(t, decoded.Approve(keys[2]))
+	assert.Nil(t, decoded.Verify())
+	decoded, err = UnmarshalTransaction(MarshalTransaction(decoded))
+	assert.Nil(t, err)
+	assert.Nil(t, decoded.Verify())
+
+	// a multisig transaction without approvals is not sent around
+	tx.Approvals = nil
+	_, err = UnmarshalTransaction(MarshalTransaction(tx))
+	assert.NotNil(t, err)
+}
+
+func TestStateMultisigTransfer(t *testing.T) {
+	keys := multisigKeys(t)
+	policy := twoOfThree(t, keys)
+	bob := crypto.GeneratePrivateKey().PublicKey().Address()
+
+	state := NewState()
+	assert.Nil(t, state.ApplyTransaction(&Transaction{Type: TxTypeMint, To: policy.Address(), Value: 100}, 0, types.Address{}))
+
+	tx := NewTransferTransaction(bob, 40, 0)
+	tx.Multisig = policy
+	assert.Nil(t, tx.Approve(keys[0]))
+	assert.Nil(t, tx.Approve(keys[1]))
+	assert.Nil(t, tx.Verify())
+
+	// the account cannot spend before its policy is registered
+	assert.NotNil(t, state.ApplyTransaction(tx, 1, types.Address{}))
+	_, ok := state.GetMultisigPolicy(policy.Address())
+	assert.False(t, ok)
+
+	registrar := crypto.GeneratePrivateKey()
+	reg := NewRegisterMultisigTransaction(policy, 0)
+	assert.Nil(t, reg.Sign(registrar))
+	decoded, err := UnmarshalTransaction(MarshalTransaction(reg))
+	assert.Nil(t, err)
+	root := state.Root()
+	assert.Nil(t, state.ApplyTransaction(decoded, 1, types.Address{}))
+	assert.NotEqual(t, root, state.Root())
+	registered, ok := state.GetMultisigPolicy(policy.Address())
+	assert.True(t, ok)
+	assert.Equal(t, policy.Address(), registered.Address())
+
+	// a policy is registered once
+	again := NewRegisterMultisigTransaction(policy, 1)
+	assert.Nil(t, again.Sign(registrar))
+	assert.NotNil(t, state.ApplyTransaction(again, 1, types.Address{}))
+
+	assert.Nil(t, state.ApplyTransaction(tx, 1, types.Address{}))
+	assert.Equal(t, Account{Balance: 60, Nonce: 1}, state.GetAccount(policy.Address()))
+	assert.Equal(t, Account{Balance: 40}, state.GetAccount(bob))
+
+	// the keys of the policy own nothing themselves
+	assert.Equal(t, Account{}, state.GetAccount(keys[0].PublicKey().Address()))
+}
+
+func TestMultisigRegistrationIsReverted(t *testing.T) {
+	keys := multisigKeys(t)
+	policy := twoOfThree(t, keys)
+
+	state := NewState()
+	root := state.Root()
+
+	reg := NewRegisterMultisigTransaction(policy, 0)
+	assert.Nil(t, reg.Sign(crypto.GeneratePrivateKey()))
+	b := randomBlock(t, 1, types.Hash{})
+	b.Transactions = []Transaction{*reg}
+
+	undo, err := state.applyBlock(b, ProofOfAuthority{})
+	assert.Nil(t, err)
+	_, ok := state.GetMultisigPolicy(policy.Address())
+	assert.True(t, ok)
+
+	state.revertBlock(undo)
+	_, ok = state.GetMultisigPolicy(policy.Address())
+	assert.False(t, ok)
+	assert.Equal(t, root, state.Root())
+
+	// the registration must carry a valid policy
+	bad := &Transaction{Type: TxTypeRegisterMultisig, Data: []byte("policy")}
+	assert.Nil(t, bad.Sign(crypto.GeneratePrivateKey()))
+	assert.NotNil(t, state.ApplyTransaction(bad, 1, types.Address{}))
+}
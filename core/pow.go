@@ -0,0 +1,314 @@
+/***************************************************************
+ * Arquivo: pow.go
+ * Descrição: Prova de trabalho: mineração de blocos e ajuste de
+ *            dificuldade.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: O hash do cabeçalho deve ficar abaixo do alvo
+ * 2^256 / dificuldade. A dificuldade é reajustada a cada bloco pelo
+ * intervalo entre os blocos recentes. O horário de um bloco fica
+ * entre a mediana dos blocos recentes e pouco à frente do relógio.
+ ***************************************************************/
+
+package core
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+const (
+	defaultPowBlockTime      = 10 * time.Second
+	defaultPowMinDifficulty  = 1 << 16
+	defaultPowRetargetWindow = 16
+
+	// maxRetargetFactor bounds how much the difficulty changes from one
+	// block to the next
+	maxRetargetFactor = 4
+	// medianTimeBlocks is the number of recent blocks whose median
+	// timestamp the next block must be after
+	medianTimeBlocks = 11
+	// maxFutureBlockTimes is how many block times a timestamp may be ahead
+	// of the local clock
+	maxFutureBlockTimes = 2
+	// abortCheckInterval is the number of nonces a worker tries before
+	// checking whether the block is still worth mining
+	abortCheckInterval = 1 << 12
+)
+
+// maxTarget is 2^256, the target of a difficulty of one.
+var maxTarget = new(big.Int).Lsh(big.NewInt(1), 256)
+
+type ProofOfWorkOpts struct {
+	// BlockTime is the interval between blocks the difficulty aims at.
+	BlockTime time.Duration
+	// MinDifficulty is the difficulty of the first block, and the lowest
+	// the retargeting goes.
+	MinDifficulty uint64
+	// RetargetWindow is the number of recent blocks whose timestamps set
+	// the difficulty of the next one.
+	RetargetWindow uint32
+	// Workers is the number of goroutines searching nonces, GOMAXPROCS
+	// when zero.
+	Workers int
+}
+
+// ProofOfWork is the consensus engine of proof-of-work chains. Any node
+// may produce a block by finding a nonce for which the header hash is below
+// the target set by the difficulty, and the heaviest branch, by the sum of
+// the difficulties, is the canonical chain.
+type ProofOfWork struct {
+	ProofOfWorkOpts
+
+	// now is the local clock the timestamps are checked against
+	now func() time.Time
+}
+
+func NewProofOfWork(opts ProofOfWorkOpts) *ProofOfWork {
+	if opts.BlockTime == 0 {
+		opts.BlockTime = defaultPowBlockTime
+	}
+	if opts.MinDifficulty == 0 {
+		opts.MinDifficulty = defaultPowMinDifficulty
+	}
+	if opts.RetargetWindow == 0 {
+		opts.RetargetWindow = defaultPowRetargetWindow
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	return &ProofOfWork{ProofOfWorkOpts: opts, now: time.Now}
+}
+
+// Prepare sets the difficulty of the header and moves its timestamp after
+// the median of the recent blocks.
+func (e *ProofOfWork) Prepare(chain *BlockChain, header *Header, validator types.Address) error {
+	parent, err := chain.GetHeaderByHash(header.PrevBlockHash)
+	if err != nil {
+		return err
+	}
+	median, err := MedianTime(chain, parent)
+	if err != nil {
+		return err
+	}
+	if header.Timestamp <= median {
+		header.Timestamp = median + 1
+	}
+	header.Difficulty, err = e.NextDifficulty(chain, parent)
+	return err
+}
+
+// Seal mines the block and signs it. Mining is given up once the parent of
+// the block is no longer the tip, as another block was found first.
+func (e *ProofOfWork) Seal(chain *BlockChain, b *Block, key crypto.PrivateKey) error {
+	nonce, err := e.mine(b.Header, func() bool {
+		return chain.tipHash() != b.PrevBlockHash
+	})
+	if err != nil {
+		return err
+	}
+
+	b.Nonce = nonce
+	b.hash = types.Hash{}
+	return b.Sign(key)
+}
+
+// VerifyHeader checks the timestamp, the difficulty and the proof of work of
+// the header. The timestamp must be after the median of the recent blocks
+// and at most two block times ahead of the local clock, so post-dated blocks
+// cannot lower the difficulty.
+func (e *ProofOfWork) VerifyHeader(chain *BlockChain, header, parent *Header) error {
+	median, err := MedianTime(chain, parent)
+	if err != nil {
+		return err
+	}
+	if header.Timestamp <= median {
+		return fmt.Errorf("block (%d) timestamp (%d) is not after the median of the recent blocks (%d)", header.Height, header.Timestamp, median)
+	}
+	limit := e.now().Add(maxFutureBlockTimes * e.BlockTime).UnixNano()
+	if header.Timestamp > uint64(limit) {
+		return fmt.Errorf("block (%d) timestamp (%d) is too far in the future, limit is (%d)", header.Height, header.Timestamp, limit)
+	}
+
+	difficulty, err := e.NextDifficulty(chain, parent)
+	if err != nil {
+		return err
+	}
+	if header.Difficulty != difficulty {
+		return fmt.Errorf("block (%d) has difficulty (%d), expected (%d)", header.Height, header.Difficulty, difficulty)
+	}
+
+	if !CheckProofOfWork(header) {
+		return fmt.Errorf("block (%s) hash is above the target of difficulty (%d)", BlockHasher{}.Hash(header), header.Difficulty)
+	}
+	return nil
+}
+
+// VerifySeal accepts any producer, the work was checked with the header.
+func (e *ProofOfWork) VerifySeal(state EngineState, b *Block) error {
+	return nil
+}
+
+// Finalize changes nothing, the miners earn the fees of the transactions.
+func (e *ProofOfWork) Finalize(state EngineState, b *Block) error {
+	return nil
+}
+
+// Weight makes the branch with the most work the canonical chain.
+func (e *ProofOfWork) Weight(h *Header) *big.Int {
+	return new(big.Int).SetUint64(h.Difficulty)
+}
+
+// NextDifficulty returns the difficulty of the block on top of parent. The
+// difficulty of the parent is scaled by the ratio between the expected and
+// the actual time the last RetargetWindow blocks took, by a factor of at
+// most four either way. The genesis block is not counted, as its timestamp
+// is fixed when the chain is set up.
+func (e *ProofOfWork) NextDifficulty(chain *BlockChain, parent *Header) (uint64, error) {
+	if parent.Height == 0 || parent.Difficulty == 0 {
+		return e.MinDifficulty, nil
+	}
+
+	first := parent
+	blocks := uint64(0)
+	for blocks < uint64(e.RetargetWindow) && first.Height > 1 {
+		prev, err := chain.GetHeaderByHash(first.PrevBlockHash)
+		if err != nil {
+			return 0, err
+		}
+		first = prev
+		blocks++
+	}
+	if blocks == 0 {
+		return parent.Difficulty, nil
+	}
+
+	// timestamps only have to be after the median, a window may end
+	// before it starts
+	expected := new(big.Int).Mul(big.NewInt(int64(e.BlockTime)), new(big.Int).SetUint64(blocks))
+	actual := new(big.Int)
+	if parent.Timestamp > first.Timestamp {
+		actual.SetUint64(parent.Timestamp - first.Timestamp)
+	}
+	if lower := new(big.Int).Div(expected, big.NewInt(maxRetargetFactor)); actual.Cmp(lower) < 0 {
+		actual = lower
+	}
+	if upper := new(big.Int).Mul(expected, big.NewInt(maxRetargetFactor)); actual.Cmp(upper) > 0 {
+		actual = upper
+	}
+
+	next := new(big.Int).SetUint64(parent.Difficulty)
+	next.Mul(next, expected)
+	next.Div(next, actual)
+	switch {
+	case next.Cmp(new(big.Int).SetUint64(e.MinDifficulty)) < 0:
+		return e.MinDifficulty, nil
+	case !next.IsUint64():
+		return math.MaxUint64, nil
+	default:
+		return next.Uint64(), nil
+	}
+}
+
+// MedianTime returns the median timestamp of parent and the blocks before
+// it, up to medianTimeBlocks of them.
+func MedianTime(chain *BlockChain, parent *Header) (uint64, error) {
+	timestamps := []uint64{parent.Timestamp}
+	for h := parent; len(timestamps) < medianTimeBlocks && h.Height > 0; {
+		prev, err := chain.GetHeaderByHash(h.PrevBlockHash)
+		if err != nil {
+			return 0, err
+		}
+		timestamps = append(timestamps, prev.Timestamp)
+		h = prev
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2], nil
+}
+
+// CheckProofOfWork tells whether the hash of the header is below the target
+// of its difficulty.
+func CheckProofOfWork(h *Header) bool {
+	if h.Difficulty == 0 {
+		return false
+	}
+	hash := BlockHasher{}.Hash(h)
+	return new(big.Int).SetBytes(hash[:]).Cmp(powTarget(h.Difficulty)) < 0
+}
+
+func powTarget(difficulty uint64) *big.Int {
+	return new(big.Int).Div(maxTarget, new(big.Int).SetUint64(difficulty))
+}
+
+// mine searches a nonce that meets the difficulty of the header. The workers
+// try interleaved nonces on their own copy of the header and stop when one
+// of them finds it or abort returns true.
+func (e *ProofOfWork) mine(header *Header, abort func() bool) (uint64, error) {
+	if header.Difficulty == 0 {
+		return 0, fmt.Errorf("block (%d) has no difficulty to mine", header.Height)
+	}
+
+	var (
+		target = powTarget(header.Difficulty)
+		found  = make(chan uint64, e.Workers)
+		done   = make(chan struct{})
+		wg     sync.WaitGroup
+	)
+
+	for i := 0; i < e.Workers; i++ {
+		// the copy is taken here, the caller may change the header as soon
+		// as mine returns
+		h := *header
+		wg.Add(1)
+		go func(h Header, start uint64) {
+			defer wg.Done()
+
+			step := uint64(e.Workers)
+			for nonce, tries := start, 0; ; nonce, tries = nonce+step, tries+1 {
+				if tries%abortCheckInterval == 0 {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					if abort() {
+						return
+					}
+				}
+
+				h.Nonce = nonce
+				hash := BlockHasher{}.Hash(&h)
+				if new(big.Int).SetBytes(hash[:]).Cmp(target) < 0 {
+					found <- nonce
+					return
+				}
+				if nonce > math.MaxUint64-step {
+					return
+				}
+			}
+		}(h, uint64(i))
+	}
+
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	nonce, ok := <-found
+	close(done)
+	wg.Wait()
+	if !ok {
+		return 0, fmt.Errorf("mining of block (%d) was given up", header.Height)
+	}
+	return nonce, nil
+}
@@ -0,0 +1,216 @@
+package core
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPowEngine() *ProofOfWork {
+	return NewProofOfWork(ProofOfWorkOpts{
+		BlockTime:      time.Second,
+		MinDifficulty:  16,
+		RetargetWindow: 4,
+		Workers:        4,
+	})
+}
+
+// powBlock mines a block on top of parent, which may be on a side branch,
+// with the given timestamp.
+func powBlock(t *testing.T, bc *BlockChain, parent *Header, key crypto.PrivateKey, timestamp uint64) *Block {
+	b, err := NewBlockFromHeader(parent, nil)
+	assert.Nil(t, err)
+	b.Timestamp = timestamp
+	assert.Nil(t, bc.Engine.Prepare(bc, b.Header, key.PublicKey().Address()))
+
+	b.Nonce, err = bc.Engine.(*ProofOfWork).mine(b.Header, func() bool { return false })
+	assert.Nil(t, err)
+	assert.Nil(t, b.Sign(key))
+	return b
+}
+
+// remine searches a new nonce for the block after its header was changed.
+func remine(t *testing.T, b *Block, key crypto.PrivateKey) {
+	for b.Nonce = 0; !CheckProofOfWork(b.Header); b.Nonce++ {
+	}
+	b.hash = types.Hash{}
+	assert.Nil(t, b.Sign(key))
+}
+
+func TestProofOfWorkMinesBlocks(t *testing.T) {
+	bc := newEngineChain(t, newPowEngine())
+	key := crypto.GeneratePrivateKey()
+
+	for i := 0; i < 3; i++ {
+		// blocks built in a row retarget up from the minimum
+		b := engineBlock(t, bc, key)
+		assert.GreaterOrEqual(t, b.Difficulty, uint64(16))
+		assert.True(t, CheckProofOfWork(b.Header))
+		assert.Nil(t, bc.AddBlock(b))
+	}
+	assert.Equal(t, uint32(3), bc.Height())
+}
+
+func TestProofOfWorkRejectsInvalidWork(t *testing.T) {
+	bc := newEngineChain(t, newPowEngine())
+	key := crypto.GeneratePrivateKey()
+
+	// the work must meet the difficulty of the header
+	b := engineBlock(t, bc, key)
+	for b.Nonce++; CheckProofOfWork(b.Header); b.Nonce++ {
+	}
+	b.hash = types.Hash{}
+	assert.Nil(t, b.Sign(key))
+	assert.NotNil(t, bc.AddBlock(b))
+
+	// the difficulty must follow the retargeting rule
+	b = engineBlock(t, bc, key)
+	b.Difficulty = 1
+	remine(t, b, key)
+	assert.NotNil(t, bc.AddBlock(b))
+
+	// the timestamp must be after the parent
+	genesis, err := bc.GetHeader(0)
+	assert.Nil(t, err)
+	b = engineBlock(t, bc, key)
+	b.Timestamp = genesis.Timestamp
+	remine(t, b, key)
+	assert.NotNil(t, bc.AddBlock(b))
+
+	assert.Equal(t, uint32(0), bc.Height())
+}
+
+// setClock moves the clock of the engine the timestamps are checked
+// against, so tests can mine blocks ahead of the real time.
+func setClock(engine *ProofOfWork, ahead time.Duration) {
+	engine.now = func() time.Time { return time.Now().Add(ahead) }
+}
+
+func TestProofOfWorkTimestamps(t *testing.T) {
+	engine := newPowEngine()
+	bc := newEngineChain(t, engine)
+	key := crypto.GeneratePrivateKey()
+	second := uint64(time.Second)
+
+	genesis, err := bc.GetHeader(0)
+	assert.Nil(t, err)
+	parent := genesis
+	for i := uint64(1); i <= 3; i++ {
+		b := powBlock(t, bc, parent, key, genesis.Timestamp+i*second/10)
+		assert.Nil(t, bc.AddBlock(b))
+		parent = b.Header
+	}
+
+	// the median of the four blocks is the second one, a block may be
+	// before its parent but not before the median
+	median, err := MedianTime(bc, parent)
+	assert.Nil(t, err)
+	assert.Equal(t, genesis.Timestamp+2*second/10, median)
+
+	b := powBlock(t, bc, parent, key, median+1)
+	b.Timestamp = median
+	remine(t, b, key)
+	assert.NotNil(t, bc.AddBlock(b))
+	assert.Nil(t, bc.AddBlock(powBlock(t, bc, parent, key, median+second/20)))
+
+	// a post-dated block would lower the difficulty of the next ones
+	tip, err := bc.GetHeader(bc.Height())
+	assert.Nil(t, err)
+	future := uint64(time.Now().Add(3 * engine.BlockTime).UnixNano())
+	assert.NotNil(t, bc.AddBlock(powBlock(t, bc, tip, key, future)))
+	assert.Equal(t, uint32(4), bc.Height())
+
+	setClock(engine, 2*engine.BlockTime)
+	assert.Nil(t, bc.AddBlock(powBlock(t, bc, tip, key, future)))
+}
+
+func TestDifficultyRetarget(t *testing.T) {
+	engine := newPowEngine()
+	setClock(engine, 24*time.Hour)
+	bc := newEngineChain(t, engine)
+	key := crypto.GeneratePrivateKey()
+	second := uint64(time.Second)
+
+	tip := func() *Header {
+		h, err := bc.GetHeader(bc.Height())
+		assert.Nil(t, err)
+		return h
+	}
+	start := tip().Timestamp
+
+	// the first blocks have the minimum difficulty, there is no interval
+	// to measure yet
+	assert.Nil(t, bc.AddBlock(powBlock(t, bc, tip(), key, start+second)))
+	assert.Nil(t, bc.AddBlock(powBlock(t, bc, tip(), key, start+2*second)))
+	assert.Equal(t, uint64(16), tip().Difficulty)
+
+	// faster blocks than the block time raise the difficulty
+	assert.Nil(t, bc.AddBlock(powBlock(t, bc, tip(), key, tip().Timestamp+second/2)))
+	assert.Equal(t, uint64(16), tip().Difficulty)
+	next, err := engine.NextDifficulty(bc, tip())
+	assert.Nil(t, err)
+	// the window holds an interval of 1s and one of 0.5s
+	assert.Equal(t, uint64(16*2*second/(second+second/2)), next)
+
+	// blocks much faster than the block time change the difficulty by four
+	// at most
+	ts := tip().Timestamp
+	for i := 0; i < 4; i++ {
+		ts++
+		assert.Nil(t, bc.AddBlock(powBlock(t, bc, tip(), key, ts)))
+	}
+	prev, err := bc.GetHeader(bc.Height() - 1)
+	assert.Nil(t, err)
+	assert.Equal(t, prev.Difficulty*4, tip().Difficulty)
+
+	// slow blocks bring it back down, never under the minimum
+	for i := 0; i < 6; i++ {
+		ts += uint64(time.Hour)
+		assert.Nil(t, bc.AddBlock(powBlock(t, bc, tip(), key, ts)))
+	}
+	assert.Equal(t, uint64(16), tip().Difficulty)
+}
+
+func TestProofOfWorkFollowsMostWork(t *testing.T) {
+	engine := newPowEngine()
+	setClock(engine, time.Hour)
+	bc := newEngineChain(t, engine)
+	miner := crypto.GeneratePrivateKey()
+	genesis, err := bc.GetHeader(0)
+	assert.Nil(t, err)
+	second := uint64(time.Second)
+
+	// a longer branch of slow blocks at the minimum difficulty
+	parent := genesis
+	for i := uint64(1); i <= 4; i++ {
+		b := powBlock(t, bc, parent, miner, genesis.Timestamp+i*10*second)
+		assert.Nil(t, bc.AddBlock(b))
+		parent = b.Header
+	}
+	assert.Equal(t, uint32(4), bc.Height())
+
+	// a shorter branch of fast blocks, whose last block is four times
+	// harder, carries more work
+	parent = genesis
+	var last *Block
+	for i := uint64(1); i <= 3; i++ {
+		last = powBlock(t, bc, parent, miner, genesis.Timestamp+i)
+		assert.Nil(t, bc.AddBlock(last))
+		parent = last.Header
+	}
+	assert.Equal(t, uint64(64), last.Difficulty)
+	assert.Equal(t, uint32(3), bc.Height())
+	assert.Equal(t, last.Hash(BlockHasher{}), BlockHasher{}.Hash(bc.Headers[3]))
+}
+
+func TestMiningCanBeAborted(t *testing.T) {
+	engine := newPowEngine()
+	header := &Header{Height: 1, Difficulty: math.MaxUint64}
+
+	_, err := engine.mine(header, func() bool { return true })
+	assert.NotNil(t, err)
+}
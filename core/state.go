@@ -0,0 +1,357 @@
+/***************************************************************
+ * Arquivo: state.go
+ * Descrição: Estado das contas (saldos e nonces) da blockchain.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: Cada bloco aplicado gera um diário com os valores
+ * anteriores das contas alteradas, usado para desfazer o bloco
+ * durante uma reorganização.
+ ***************************************************************/
+
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+// Account is the state of an address. The nonce counts the transfers sent
+// by the account, the next transfer must carry it.
+type Account struct {
+	Balance uint64
+	Nonce   uint64
+}
+
+func (a Account) isEmpty() bool {
+	return a.Balance == 0 && a.Nonce == 0
+}
+
+// State holds every account with a balance or a nonce. Empty accounts are
+// not stored, so the root only depends on the meaningful ones. It also holds
+// the validator set of a proof-of-authority chain and the pending votes to
+// change it, and the registered multisig policies.
+type State struct {
+	lock       sync.RWMutex
+	accounts   map[types.Address]Account
+	validators map[types.Address]bool
+	// votes holds the voters of every pending validator proposal
+	votes    map[ValidatorProposal]map[types.Address]bool
+	policies map[types.Address]*MultisigPolicy
+}
+
+func NewState() *State {
+	return &State{
+		accounts:   make(map[types.Address]Account),
+		validators: make(map[types.Address]bool),
+		votes:      make(map[ValidatorProposal]map[types.Address]bool),
+		policies:   make(map[types.Address]*MultisigPolicy),
+	}
+}
+
+// GetAccount returns the account of addr, empty if it was never used.
+func (s *State) GetAccount(addr types.Address) Account {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.accounts[addr]
+}
+
+// Copy returns an independent copy of the state, used to try transactions
+// without touching the chain.
+func (s *State) Copy() *State {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	cp := NewState()
+	for addr, acc := range s.accounts {
+		cp.accounts[addr] = acc
+	}
+	for addr := range s.validators {
+		cp.validators[addr] = true
+	}
+	for p, voters := range s.votes {
+		cp.votes[p] = copyVoters(voters)
+	}
+	for addr, p := range s.policies {
+		cp.policies[addr] = p
+	}
+	return cp
+}
+
+// Root is the Merkle root of the accounts sorted by address, each leaf being
+// the hash of address | balance u64 | nonce u64, followed by the leaves of
+// the validators, of the votes and of the multisig policies. A chain without
+// validators or policies only has account leaves.
+func (s *State) Root() types.Hash {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	addrs := make([]types.Address, 0, len(s.accounts))
+	for addr := range s.accounts {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+
+	leaves := make([]types.Hash, len(addrs))
+	for i, addr := range addrs {
+		acc := s.accounts[addr]
+		buf := make([]byte, 20+8+8)
+		copy(buf, addr[:])
+		binary.BigEndian.PutUint64(buf[20:28], acc.Balance)
+		binary.BigEndian.PutUint64(buf[28:36], acc.Nonce)
+		leaves[i] = types.Hash(sha256.Sum256(buf))
+	}
+	leaves = append(leaves, s.authorityLeaves()...)
+	leaves = append(leaves, s.multisigLeaves()...)
+	return MerkleRoot(leaves)
+}
+
+// ApplyTransaction applies a single transaction included at the given
+// height in a block of validator, who collects the fee. An invalid
+// transaction leaves the state untouched.
+func (s *State) ApplyTransaction(tx *Transaction, height uint32, validator types.Address) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.apply(tx, height, &validator, nil)
+}
+
+// stateUndo keeps the accounts of the state as they were before a block was
+// applied. A missing account is kept as an empty one. The membership of the
+// validators and the voters of the proposals changed by the block are kept
+// too, a proposal without votes as nil, and the registered policies, a
+// missing one as nil.
+type stateUndo struct {
+	accounts   map[types.Address]Account
+	validators map[types.Address]bool
+	votes      map[ValidatorProposal]map[types.Address]bool
+	policies   map[types.Address]*MultisigPolicy
+}
+
+func newStateUndo() *stateUndo {
+	return &stateUndo{
+		accounts:   make(map[types.Address]Account),
+		validators: make(map[types.Address]bool),
+		votes:      make(map[ValidatorProposal]map[types.Address]bool),
+		policies:   make(map[types.Address]*MultisigPolicy),
+	}
+}
+
+// applyBlock applies every transaction of the block, or none of them, after
+// the engine checked its producer. The engine finalizes the block last.
+func (s *State) applyBlock(b *Block, engine Engine) (*stateUndo, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var validator *types.Address
+	if !b.Validator.IsZero() {
+		addr := b.Validator.Address()
+		validator = &addr
+	}
+
+	undo := newStateUndo()
+	bs := &blockState{state: s, undo: undo}
+	if err := engine.VerifySeal(bs, b); err != nil {
+		return nil, err
+	}
+
+	for i := range b.Transactions {
+		if err := s.apply(&b.Transactions[i], b.Height, validator, undo); err != nil {
+			s.revert(undo)
+			return nil, fmt.Errorf("transaction (%d) of block (%s): %s", i, b.Hash(BlockHasher{}), err)
+		}
+	}
+
+	if err := engine.Finalize(bs, b); err != nil {
+		s.revert(undo)
+		return nil, fmt.Errorf("block (%s) cannot be finalized: %s", b.Hash(BlockHasher{}), err)
+	}
+	return undo, nil
+}
+
+// revertBlock undoes a block applied with applyBlock.
+func (s *State) revertBlock(undo *stateUndo) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.revert(undo)
+}
+
+// the helpers below must be called with the lock held
+
+func (s *State) revert(undo *stateUndo) {
+	for addr, acc := range undo.accounts {
+		s.set(addr, acc, nil)
+	}
+	for addr, member := range undo.validators {
+		s.setValidator(addr, member, nil)
+	}
+	for p, voters := range undo.votes {
+		s.setVoters(p, voters, nil)
+	}
+	for addr, p := range undo.policies {
+		s.setPolicy(addr, p, nil)
+	}
+}
+
+// apply applies a transaction, recording the previous accounts in undo. The
+// changes of a failed transaction are reverted, so it is never half
+// applied.
+func (s *State) apply(tx *Transaction, height uint32, validator *types.Address, undo *stateUndo) error {
+	journal := newStateUndo()
+	if err := s.applyTx(tx, height, validator, journal); err != nil {
+		s.revert(journal)
+		return err
+	}
+
+	if undo != nil {
+		for addr, acc := range journal.accounts {
+			if _, ok := undo.accounts[addr]; !ok {
+				undo.accounts[addr] = acc
+			}
+		}
+		for addr, member := range journal.validators {
+			if _, ok := undo.validators[addr]; !ok {
+				undo.validators[addr] = member
+			}
+		}
+		for p, voters := range journal.votes {
+			if _, ok := undo.votes[p]; !ok {
+				undo.votes[p] = voters
+			}
+		}
+		for addr, p := range journal.policies {
+			if _, ok := undo.policies[addr]; !ok {
+				undo.policies[addr] = p
+			}
+		}
+	}
+	return nil
+}
+
+func (s *State) applyTx(tx *Transaction, height uint32, validator *types.Address, journal *stateUndo) error {
+	if tx.Fee > 0 && tx.Type == TxTypeMint {
+		return fmt.Errorf("mint transactions cannot pay a fee")
+	}
+	if tx.Multisig != nil {
+		if err := s.checkMultisig(tx.Multisig); err != nil {
+			return err
+		}
+	}
+
+	switch tx.Type {
+	case TxTypeData:
+		if tx.Value != 0 {
+			return fmt.Errorf("data transaction cannot carry value")
+		}
+
+	case TxTypeMint:
+		if height != 0 {
+			return fmt.Errorf("mint transactions are only allowed in the genesis block")
+		}
+		if err := s.credit(tx.To, tx.Value, journal); err != nil {
+			return err
+		}
+
+	case TxTypeTransfer:
+		from, sender, err := s.sender(tx)
+		if err != nil {
+			return err
+		}
+		if sender.Balance < tx.Value {
+			return fmt.Errorf("insufficient balance for %s: has (%d), needs (%d)", from, sender.Balance, tx.Value)
+		}
+
+		sender.Balance -= tx.Value
+		sender.Nonce++
+		s.set(from, sender, journal)
+		if err := s.credit(tx.To, tx.Value, journal); err != nil {
+			return err
+		}
+
+	case TxTypeAddValidator, TxTypeRemoveValidator:
+		if err := s.applyValidatorTx(tx, height, journal); err != nil {
+			return err
+		}
+
+	case TxTypeRegisterMultisig:
+		if err := s.applyRegisterMultisig(tx, journal); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown transaction type (%d)", tx.Type)
+	}
+
+	if tx.Fee == 0 {
+		return nil
+	}
+	return s.payFee(tx, validator, journal)
+}
+
+// payFee moves the fee of tx from the sender to the validator.
+func (s *State) payFee(tx *Transaction, validator *types.Address, journal *stateUndo) error {
+	if validator == nil {
+		return fmt.Errorf("transaction pays a fee but the block has no validator")
+	}
+	from, ok := tx.Sender()
+	if !ok {
+		return fmt.Errorf("transaction has no sender")
+	}
+
+	sender := s.accounts[from]
+	if sender.Balance < tx.Fee {
+		return fmt.Errorf("insufficient balance for %s to pay a fee of (%d), has (%d)", from, tx.Fee, sender.Balance)
+	}
+	sender.Balance -= tx.Fee
+	s.set(from, sender, journal)
+
+	return s.credit(*validator, tx.Fee, journal)
+}
+
+func (s *State) credit(addr types.Address, value uint64, journal *stateUndo) error {
+	acc := s.accounts[addr]
+	if acc.Balance > math.MaxUint64-value {
+		return fmt.Errorf("balance of %s overflows", addr)
+	}
+	acc.Balance += value
+	s.set(addr, acc, journal)
+	return nil
+}
+
+// sender returns the account that sent tx after checking the nonce, which
+// rejects replayed transfers and gaps.
+func (s *State) sender(tx *Transaction) (types.Address, Account, error) {
+	from, ok := tx.Sender()
+	if !ok {
+		return types.Address{}, Account{}, fmt.Errorf("transaction has no sender")
+	}
+
+	sender := s.accounts[from]
+	if tx.Nonce != sender.Nonce {
+		return from, sender, fmt.Errorf("invalid nonce (%d) for %s, expected (%d)", tx.Nonce, from, sender.Nonce)
+	}
+	return from, sender, nil
+}
+
+func (s *State) set(addr types.Address, acc Account, undo *stateUndo) {
+	if undo != nil {
+		if _, ok := undo.accounts[addr]; !ok {
+			undo.accounts[addr] = s.accounts[addr]
+		}
+	}
+
+	if acc.isEmpty() {
+		delete(s.accounts, addr)
+		return
+	}
+	s.accounts[addr] = acc
+}
@@ -0,0 +1,217 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateTransfer(t *testing.T) {
+	alice := crypto.GeneratePrivateKey()
+	bob := crypto.GeneratePrivateKey().PublicKey().Address()
+
+	state := NewState()
+	assert.Nil(t, state.ApplyTransaction(&Transaction{Type: TxTypeMint, To: alice.PublicKey().Address(), Value: 100}, 0, types.Address{}))
+
+	assert.Nil(t, state.ApplyTransaction(signedTransfer(t, alice, bob, 30, 0), 1, types.Address{}))
+	assert.Equal(t, Account{Balance: 70, Nonce: 1}, state.GetAccount(alice.PublicKey().Address()))
+	assert.Equal(t, Account{Balance: 30}, state.GetAccount(bob))
+
+	// sending to itself only moves the nonce
+	assert.Nil(t, state.ApplyTransaction(signedTransfer(t, alice, alice.PublicKey().Address(), 70, 1), 1, types.Address{}))
+	assert.Equal(t, Account{Balance: 70, Nonce: 2}, state.GetAccount(alice.PublicKey().Address()))
+}
+
+func TestStateRejectsInvalidTransfers(t *testing.T) {
+	alice := crypto.GeneratePrivateKey()
+	bob := crypto.GeneratePrivateKey().PublicKey().Address()
+
+	state := NewState()
+	assert.Nil(t, state.ApplyTransaction(&Transaction{Type: TxTypeMint, To: alice.PublicKey().Address(), Value: 100}, 0, types.Address{}))
+
+	// overdraft
+	assert.NotNil(t, state.ApplyTransaction(signedTransfer(t, alice, bob, 101, 0), 1, types.Address{}))
+	// nonce gap and replayed nonce
+	assert.NotNil(t, state.ApplyTransaction(signedTransfer(t, alice, bob, 1, 1), 1, types.Address{}))
+	assert.Nil(t, state.ApplyTransaction(signedTransfer(t, alice, bob, 1, 0), 1, types.Address{}))
+	assert.NotNil(t, state.ApplyTransaction(signedTransfer(t, alice, bob, 1, 0), 1, types.Address{}))
+	assert.Equal(t, Account{Balance: 99, Nonce: 1}, state.GetAccount(alice.PublicKey().Address()))
+	root := state.Root()
+
+	// mints after the genesis block and data with value
+	assert.NotNil(t, state.ApplyTransaction(&Transaction{Type: TxTypeMint, To: bob, Value: 1}, 1, types.Address{}))
+	assert.NotNil(t, state.ApplyTransaction(&Transaction{Type: TxTypeData, Value: 1}, 1, types.Address{}))
+
+	assert.Equal(t, root, state.Root())
+}
+
+func TestStateFees(t *testing.T) {
+	alice := crypto.GeneratePrivateKey()
+	bob := crypto.GeneratePrivateKey().PublicKey().Address()
+	validator := crypto.GeneratePrivateKey().PublicKey().Address()
+
+	state := NewState()
+	assert.Nil(t, state.ApplyTransaction(&Transaction{Type: TxTypeMint, To: alice.PublicKey().Address(), Value: 100}, 0, types.Address{}))
+
+	transfer := func(value, fee, nonce uint64) *Transaction {
+		tx := NewTransferTransaction(bob, value, nonce)
+		tx.Fee = fee
+		assert.Nil(t, tx.Sign(alice))
+		return tx
+	}
+
+	assert.Nil(t, state.ApplyTransaction(transfer(50, 5, 0), 1, validator))
+	assert.Equal(t, Account{Balance: 45, Nonce: 1}, state.GetAccount(alice.PublicKey().Address()))
+	assert.Equal(t, Account{Balance: 5}, state.GetAccount(validator))
+
+	// the balance must cover both the value and the fee
+	assert.NotNil(t, state.ApplyTransaction(transfer(45, 1, 1), 1, validator))
+	assert.Equal(t, Account{Balance: 45, Nonce: 1}, state.GetAccount(alice.PublicKey().Address()))
+
+	// data transactions pay from the balance of the signer
+	data := &Transaction{Data: []byte("foo"), Fee: 3}
+	assert.Nil(t, data.Sign(alice))
+	assert.Nil(t, state.ApplyTransaction(data, 1, validator))
+	assert.Equal(t, uint64(42), state.GetAccount(alice.PublicKey().Address()).Balance)
+
+	// mints pay no fee
+	assert.NotNil(t, state.ApplyTransaction(&Transaction{Type: TxTypeMint, To: bob, Value: 1, Fee: 1}, 0, validator))
+}
+
+func TestStateRoot(t *testing.T) {
+	a := types.AddressFromBytes(make([]byte, 20))
+	b := crypto.GeneratePrivateKey().PublicKey().Address()
+
+	s1 := NewState()
+	assert.Equal(t, MerkleRoot(nil), s1.Root())
+	assert.Nil(t, s1.ApplyTransaction(&Transaction{Type: TxTypeMint, To: a, Value: 1}, 0, types.Address{}))
+	assert.Nil(t, s1.ApplyTransaction(&Transaction{Type: TxTypeMint, To: b, Value: 2}, 0, types.Address{}))
+
+	// the root does not depend on the order accounts were created in
+	s2 := NewState()
+	assert.Nil(t, s2.ApplyTransaction(&Transaction{Type: TxTypeMint, To: b, Value: 2}, 0, types.Address{}))
+	assert.Nil(t, s2.ApplyTransaction(&Transaction{Type: TxTypeMint, To: a, Value: 1}, 0, types.Address{}))
+	assert.Equal(t, s1.Root(), s2.Root())
+
+	cp := s1.Copy()
+	assert.Nil(t, cp.ApplyTransaction(&Transaction{Type: TxTypeMint, To: a, Value: 1}, 0, types.Address{}))
+	assert.NotEqual(t, s1.Root(), cp.Root())
+	assert.Equal(t, uint64(1), s1.GetAccount(a).Balance)
+}
+
+func TestBlockChainAppliesTransfers(t *testing.T) {
+	alice := crypto.GeneratePrivateKey()
+	bob := crypto.GeneratePrivateKey().PublicKey().Address()
+	bc := newStateChain(t, map[types.Address]uint64{alice.PublicKey().Address(): 100})
+
+	assert.Nil(t, bc.AddBlock(transferBlock(t, bc, signedTransfer(t, alice, bob, 40, 0))))
+	assert.Equal(t, Account{Balance: 60, Nonce: 1}, bc.GetAccount(alice.PublicKey().Address()))
+	assert.Equal(t, Account{Balance: 40}, bc.GetAccount(bob))
+
+	// a block whose root does not match the state it produces
+	b := transferBlock(t, bc, signedTransfer(t, alice, bob, 10, 1))
+	b.StateRoot = types.Hash{}
+	assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+	assert.NotNil(t, bc.AddBlock(b))
+
+	// a block that spends more than the balance
+	prev, err := bc.GetHeader(bc.Height())
+	assert.Nil(t, err)
+	overdraft, err := NewBlockFromHeader(prev, []Transaction{*signedTransfer(t, alice, bob, 61, 1)})
+	assert.Nil(t, err)
+	assert.Nil(t, overdraft.Sign(crypto.GeneratePrivateKey()))
+	assert.NotNil(t, bc.AddBlock(overdraft))
+
+	assert.Equal(t, uint32(1), bc.Height())
+	assert.Equal(t, Account{Balance: 60, Nonce: 1}, bc.GetAccount(alice.PublicKey().Address()))
+}
+
+func TestReorgRevertsState(t *testing.T) {
+	alice := crypto.GeneratePrivateKey()
+	bob := crypto.GeneratePrivateKey().PublicKey().Address()
+	bc := newStateChain(t, map[types.Address]uint64{alice.PublicKey().Address(): 100})
+
+	genesis, err := bc.GetHeader(0)
+	assert.Nil(t, err)
+
+	assert.Nil(t, bc.AddBlock(transferBlock(t, bc, signedTransfer(t, alice, bob, 40, 0))))
+	assert.Equal(t, uint64(40), bc.GetAccount(bob).Balance)
+
+	// a longer branch where the transfer never happened
+	side, err := NewBlockFromHeader(genesis, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, side.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, bc.AddBlock(side))
+	next, err := NewBlockFromHeader(side.Header, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, next.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, bc.AddBlock(next))
+
+	assert.Equal(t, uint32(2), bc.Height())
+	assert.Equal(t, Account{Balance: 100}, bc.GetAccount(alice.PublicKey().Address()))
+	assert.Equal(t, Account{}, bc.GetAccount(bob))
+}
+
+func TestStateRebuiltOnReopen(t *testing.T) {
+	dir := t.TempDir()
+	alice := crypto.GeneratePrivateKey()
+	bob := crypto.GeneratePrivateKey().PublicKey().Address()
+
+	genesis, err := NewGenesisBlock(uint64(time.Now().UnixNano()), map[types.Address]uint64{alice.PublicKey().Address(): 100})
+	assert.Nil(t, err)
+
+	store, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	bc, err := NewBlockChainWithStore(store, genesis)
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddBlock(transferBlock(t, bc, signedTransfer(t, alice, bob, 25, 0))))
+	assert.Nil(t, store.Close())
+
+	store, err = NewFileStore(dir)
+	assert.Nil(t, err)
+	defer store.Close()
+	reopened, err := NewBlockChainWithStore(store, genesis)
+	assert.Nil(t, err)
+
+	assert.Equal(t, Account{Balance: 75, Nonce: 1}, reopened.GetAccount(alice.PublicKey().Address()))
+	assert.Equal(t, Account{Balance: 25}, reopened.GetAccount(bob))
+}
+
+func newStateChain(t *testing.T, alloc map[types.Address]uint64) *BlockChain {
+	genesis, err := NewGenesisBlock(uint64(time.Now().UnixNano()), alloc)
+	assert.Nil(t, err)
+
+	bc, err := NewBlockChain(genesis)
+	assert.Nil(t, err)
+	return bc
+}
+
+// transferBlock builds a signed block on top of the tip, committing to the
+// state the transactions lead to.
+func transferBlock(t *testing.T, bc *BlockChain, txx ...*Transaction) *Block {
+	prev, err := bc.GetHeader(bc.Height())
+	assert.Nil(t, err)
+
+	validator := crypto.GeneratePrivateKey()
+	state := bc.State()
+	included := make([]Transaction, len(txx))
+	for i, tx := range txx {
+		assert.Nil(t, state.ApplyTransaction(tx, prev.Height+1, validator.PublicKey().Address()))
+		included[i] = *tx
+	}
+
+	b, err := NewBlockFromHeader(prev, included)
+	assert.Nil(t, err)
+	b.StateRoot = state.Root()
+	assert.Nil(t, b.Sign(validator))
+	return b
+}
+
+func signedTransfer(t *testing.T, key crypto.PrivateKey, to types.Address, value uint64, nonce uint64) *Transaction {
+	tx := NewTransferTransaction(to, value, nonce)
+	assert.Nil(t, tx.Sign(key))
+	return tx
+}
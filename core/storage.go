@@ -10,16 +10,116 @@
 
 package core
 
+import (
+	"fmt"
+	"sync"
+
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+// Storage keeps the blocks of the chain ordered by height. Blocks must be
+// Put in height order starting at the genesis.
 type Storage interface {
 	Put(*Block) error
+	Get(types.Hash) (*Block, error)
+	GetByHeight(uint32) (*Block, error)
+	Has(types.Hash) bool
+	// Range calls fn for every stored block with a height in [from, to],
+	// in ascending order, until fn returns false. A to past the last
+	// stored block is clamped to it.
+	Range(from, to uint32, fn func(*Block) bool) error
+	// Len returns the number of stored blocks.
+	Len() int
+	// Rollback removes every block above height, used when the chain
+	// switches to another branch.
+	Rollback(height uint32) error
 }
 
-type MemoryStore struct{}
+type MemoryStore struct {
+	lock    sync.RWMutex
+	blocks  []*Block
+	heights map[types.Hash]uint32
+}
 
 func NewMemStore() *MemoryStore {
-	return &MemoryStore{}
+	return &MemoryStore{
+		blocks:  []*Block{},
+		heights: make(map[types.Hash]uint32),
+	}
 }
 
 func (ms *MemoryStore) Put(b *Block) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if b.Height != uint32(len(ms.blocks)) {
+		return fmt.Errorf("memory store expected block at height (%d), got (%d)", len(ms.blocks), b.Height)
+	}
+
+	ms.heights[b.Hash(BlockHasher{})] = b.Height
+	ms.blocks = append(ms.blocks, b)
+	return nil
+}
+
+func (ms *MemoryStore) Get(hash types.Hash) (*Block, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
+	height, ok := ms.heights[hash]
+	if !ok {
+		return nil, fmt.Errorf("block (%s) not found", hash)
+	}
+	return ms.blocks[height], nil
+}
+
+func (ms *MemoryStore) GetByHeight(height uint32) (*Block, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
+	if height >= uint32(len(ms.blocks)) {
+		return nil, fmt.Errorf("block at height (%d) not found", height)
+	}
+	return ms.blocks[height], nil
+}
+
+func (ms *MemoryStore) Has(hash types.Hash) bool {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
+	_, ok := ms.heights[hash]
+	return ok
+}
+
+func (ms *MemoryStore) Range(from, to uint32, fn func(*Block) bool) error {
+	ms.lock.RLock()
+	blocks := ms.blocks
+	ms.lock.RUnlock()
+
+	for h := int(from); h <= int(to) && h < len(blocks); h++ {
+		if !fn(blocks[h]) {
+			break
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStore) Len() int {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	return len(ms.blocks)
+}
+
+func (ms *MemoryStore) Rollback(height uint32) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if height >= uint32(len(ms.blocks)) {
+		return fmt.Errorf("cannot roll back to height (%d), store has %d blocks", height, len(ms.blocks))
+	}
+
+	for _, b := range ms.blocks[height+1:] {
+		delete(ms.heights, b.Hash(BlockHasher{}))
+	}
+	ms.blocks = ms.blocks[:height+1]
 	return nil
 }
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStorePutGet(t *testing.T) {
+	s := NewMemStore()
+	b := randomBlock(t, 0, types.Hash{})
+
+	assert.Nil(t, s.Put(b))
+	assert.Equal(t, 1, s.Len())
+	assert.True(t, s.Has(b.Hash(BlockHasher{})))
+
+	got, err := s.Get(b.Hash(BlockHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, b, got)
+
+	got, err = s.GetByHeight(0)
+	assert.Nil(t, err)
+	assert.Equal(t, b, got)
+
+	_, err = s.GetByHeight(1)
+	assert.NotNil(t, err)
+	assert.False(t, s.Has(types.Hash{}))
+	assert.NotNil(t, s.Put(randomBlock(t, 5, types.Hash{})))
+}
+
+func TestMemoryStoreRange(t *testing.T) {
+	s := NewMemStore()
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, s.Put(randomBlock(t, uint32(i), types.Hash{})))
+	}
+
+	heights := []uint32{}
+	assert.Nil(t, s.Range(3, 6, func(b *Block) bool {
+		heights = append(heights, b.Height)
+		return true
+	}))
+	assert.Equal(t, []uint32{3, 4, 5, 6}, heights)
+
+	heights = []uint32{}
+	assert.Nil(t, s.Range(8, 100, func(b *Block) bool {
+		heights = append(heights, b.Height)
+		return b.Height < 8
+	}))
+	assert.Equal(t, []uint32{8}, heights)
+}
@@ -17,12 +17,55 @@ import (
 	"github.com/JoaoRafa19/crypto-go/types"
 )
 
+// TxType tells how a transaction changes the state.
+type TxType byte
+
+const (
+	// TxTypeData transactions only carry data and leave the state as is.
+	TxTypeData TxType = iota
+	// TxTypeTransfer moves Value from the sender to To.
+	TxTypeTransfer
+	// TxTypeMint creates Value for To. It is only allowed in the genesis
+	// block and needs no signature.
+	TxTypeMint
+	// TxTypeAddValidator and TxTypeRemoveValidator are the votes of a
+	// validator to add To to the validator set, or remove it. In the
+	// genesis block an unsigned TxTypeAddValidator registers an initial
+	// validator.
+	TxTypeAddValidator
+	TxTypeRemoveValidator
+	// TxTypeRegisterMultisig registers the multisig policy encoded in Data,
+	// which must be registered before its account can spend.
+	TxTypeRegisterMultisig
+)
+
 type Transaction struct {
-	Data []byte
+	// ChainID ties the transaction to one network, so it cannot be
+	// replayed on another one
+	ChainID uint32
+	Type    TxType
+	Data    []byte
+
+	// Nonce makes every transaction of a sender unique. Transfers must
+	// carry the nonce of the sender account, which orders them. To and
+	// Value are used by transfers and mints.
+	Nonce uint64
+	To    types.Address
+	Value uint64
+	// Fee is paid by the sender to the validator of the block that
+	// includes the transaction
+	Fee uint64
 
 	From      crypto.PublicKey
 	Signature *crypto.Signature
 
+	// Multisig is set, in place of From and Signature, for transactions
+	// sent by a multisig account. It must match the policy registered for
+	// the account. Approvals holds the signatures of the keys of the policy,
+	// the transaction is valid once they reach its threshold.
+	Multisig  *MultisigPolicy
+	Approvals []Approval
+
 	//cached version of tx data hash
 	CacheHash types.Hash
 	// firstSeen is the tmiestamp of when this tx is first seen localy
@@ -30,12 +73,16 @@ type Transaction struct {
 }
 
 func (tx *Transaction) Sign(privKey crypto.PrivateKey) error {
-	sig, err := privKey.Sign(tx.Data)
+	if tx.Multisig != nil {
+		return fmt.Errorf("multisig transactions are signed with Approve")
+	}
+
+	tx.From = privKey.PublicKey()
+	sig, err := privKey.Sign(crypto.DomainTransaction, tx.signingBytes())
 	if err != nil {
 		return err
 	}
 
-	tx.From = privKey.PublicKey()
 	tx.Signature = sig
 	return nil
 }
@@ -46,6 +93,17 @@ func NewTransaction(data []byte) *Transaction {
 	}
 }
 
+// NewTransferTransaction creates a transfer of value to the given address.
+// The nonce must match the nonce of the sender account.
+func NewTransferTransaction(to types.Address, value uint64, nonce uint64) *Transaction {
+	return &Transaction{
+		Type:  TxTypeTransfer,
+		To:    to,
+		Value: value,
+		Nonce: nonce,
+	}
+}
+
 func (tx *Transaction) Hash(h Hasher[*Transaction]) types.Hash {
 	if tx.CacheHash.IsZero() {
 		tx.CacheHash = h.Hash(tx)
@@ -53,12 +111,60 @@ func (tx *Transaction) Hash(h Hasher[*Transaction]) types.Hash {
 	return h.Hash(tx)
 }
 
+// UsesNonce tells whether the transaction must carry the nonce of its
+// sender, which then orders the transactions of the sender.
+func (tx *Transaction) UsesNonce() bool {
+	switch tx.Type {
+	case TxTypeTransfer, TxTypeAddValidator, TxTypeRemoveValidator, TxTypeRegisterMultisig:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sender returns the address of the account that sent the transaction:
+// the multisig account for a multisig transaction, the address of From
+// otherwise. It is false for an unsigned transaction.
+func (tx *Transaction) Sender() (types.Address, bool) {
+	switch {
+	case tx.Multisig != nil:
+		return tx.Multisig.Address(), true
+	case !tx.From.IsZero():
+		return tx.From.Address(), true
+	default:
+		return types.Address{}, false
+	}
+}
+
+// Verify checks the signature of the transaction, or for a multisig
+// transaction that enough keys of the policy approved it. That the policy is
+// the one registered for the account is checked against the state when the
+// transaction is applied.
 func (tx *Transaction) Verify() error {
+	if tx.Multisig != nil {
+		missing, err := tx.VerifyApprovals()
+		if err != nil {
+			return err
+		}
+		if missing > 0 {
+			return fmt.Errorf("multisig transaction needs (%d) more approvals", missing)
+		}
+		return nil
+	}
+
+	if len(tx.Approvals) > 0 {
+		return fmt.Errorf("transaction has approvals but no multisig policy")
+	}
+
 	if tx.Signature == nil {
 		return fmt.Errorf("transaction has no signature")
 	}
 
-	if !tx.Signature.Verify(tx.From, tx.Data) {
+	if tx.From.IsZero() {
+		return fmt.Errorf("transaction has no sender")
+	}
+
+	if !tx.Signature.Verify(tx.From, crypto.DomainTransaction, tx.signingBytes()) {
 		return fmt.Errorf("invalid transaction signature")
 	}
 
@@ -45,6 +45,47 @@ func TestVerifyTransaction(t *testing.T) {
 	assert.NotNil(t, tx.Verify())
 }
 
+func TestTransactionReplayFields(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+
+	first := &Transaction{Data: []byte("foo"), Nonce: 0}
+	second := &Transaction{Data: []byte("foo"), Nonce: 1}
+	other := &Transaction{Data: []byte("foo"), ChainID: 1}
+	assert.Nil(t, first.Sign(privKey))
+	assert.Nil(t, second.Sign(privKey))
+	assert.Nil(t, other.Sign(privKey))
+
+	// identical payloads no longer collide
+	assert.NotEqual(t, first.Hash(TxHasher{}), second.Hash(TxHasher{}))
+	assert.NotEqual(t, first.Hash(TxHasher{}), other.Hash(TxHasher{}))
+
+	// the signature covers the chain ID and the nonce
+	first.ChainID = 1
+	assert.NotNil(t, first.Verify())
+	second.Nonce = 2
+	assert.NotNil(t, second.Verify())
+}
+
+func TestEd25519Transaction(t *testing.T) {
+	privKey, err := crypto.GenerateKey(crypto.KeyTypeEd25519)
+	assert.Nil(t, err)
+
+	tx := &Transaction{Data: []byte("foo bar baz")}
+	assert.Nil(t, tx.Sign(privKey))
+	assert.Nil(t, tx.Verify())
+
+	// the key cannot be recovered, so it travels with the transaction
+	decoded, err := UnmarshalTransaction(MarshalTransaction(tx))
+	assert.Nil(t, err)
+	assert.Equal(t, crypto.KeyTypeEd25519, decoded.From.Type())
+	assert.Equal(t, privKey.PublicKey().Address(), decoded.From.Address())
+	assert.Nil(t, decoded.Verify())
+
+	// a P-256 key does not verify an Ed25519 signature
+	decoded.From = crypto.GeneratePrivateKey().PublicKey()
+	assert.NotNil(t, decoded.Verify())
+}
+
 func TestTxEncodeDecode(t *testing.T) {
 	tx := randomTxWithSignature(t)
 	buf := &bytes.Buffer{}
@@ -0,0 +1,89 @@
+/***************************************************************
+ * Arquivo: txindex.go
+ * Descrição: Índice de transações incluídas na blockchain.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações:
+ ***************************************************************/
+
+package core
+
+import (
+	"sync"
+
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+// TxLocation tells in which block, and at which position of that block,
+// a transaction was included.
+type TxLocation struct {
+	BlockHash types.Hash
+	Height    uint32
+	Index     uint32
+}
+
+// TxIndex maps transaction hashes to the place they were included in the
+// chain. It is kept in memory and rebuilt from the storage when the chain is
+// opened.
+type TxIndex struct {
+	lock    sync.RWMutex
+	entries map[types.Hash]TxLocation
+}
+
+func NewTxIndex() *TxIndex {
+	return &TxIndex{
+		entries: make(map[types.Hash]TxLocation),
+	}
+}
+
+// Add indexes every transaction of the block. A transaction that is already
+// indexed keeps its first inclusion.
+func (idx *TxIndex) Add(b *Block) {
+	blockHash := b.Hash(BlockHasher{})
+
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	for i := range b.Transactions {
+		hash := b.Transactions[i].Hash(TxHasher{})
+		if _, ok := idx.entries[hash]; ok {
+			continue
+		}
+		idx.entries[hash] = TxLocation{
+			BlockHash: blockHash,
+			Height:    b.Height,
+			Index:     uint32(i),
+		}
+	}
+}
+
+// Remove drops the transactions of a block that left the canonical chain.
+func (idx *TxIndex) Remove(b *Block) {
+	blockHash := b.Hash(BlockHasher{})
+
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	for i := range b.Transactions {
+		hash := b.Transactions[i].Hash(TxHasher{})
+		if loc, ok := idx.entries[hash]; ok && loc.BlockHash == blockHash {
+			delete(idx.entries, hash)
+		}
+	}
+}
+
+func (idx *TxIndex) Get(hash types.Hash) (TxLocation, bool) {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	loc, ok := idx.entries[hash]
+	return loc, ok
+}
+
+func (idx *TxIndex) Len() int {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	return len(idx.entries)
+}
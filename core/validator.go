@@ -1,6 +1,10 @@
 package core
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/JoaoRafa19/crypto-go/types"
+)
 
 type Validator interface {
 	ValidateBlock(*Block) error
@@ -17,27 +21,42 @@ func NewBlockValidator(bc *BlockChain) *BlockValidator {
 }
 
 func (v *BlockValidator) ValidateBlock(b *Block) error {
-	if v.Bc.HasBlock(b.Height) {
+	if v.Bc.HasBlockHash(b.Hash(BlockHasher{})) {
 		return fmt.Errorf("chain alredy contains block (%d) with hash (%s)", b.Height, b.Hash(BlockHasher{}))
 	}
 
-	if b.Height != v.Bc.Height()+1 {
-		return fmt.Errorf("block (%s) too high", b.Hash(BlockHasher{}))
+	prevHeader, err := v.Bc.GetHeaderByHash(b.PrevBlockHash)
+	if err != nil {
+		return fmt.Errorf("the hash of the previous block (%s) is invalid", b.PrevBlockHash)
 	}
 
-	prevHeader, err := v.Bc.GetHeader(b.Height - 1)
-	if err != nil {
-		return err
+	if b.Height != prevHeader.Height+1 {
+		return fmt.Errorf("block (%s) height (%d) does not follow its parent height (%d)", b.Hash(BlockHasher{}), b.Height, prevHeader.Height)
 	}
 
-	hash := BlockHasher{}.Hash(prevHeader)
-	if hash != b.PrevBlockHash {
-		return fmt.Errorf("the hash of the previous block (%s) is invalid", b.PrevBlockHash)
+	if err := v.Bc.Engine.VerifyHeader(v.Bc, b.Header, prevHeader); err != nil {
+		return err
 	}
 
 	if err := b.Verify(); err != nil {
 		return err
 	}
 
+	// replays of transactions from other blocks are caught when the block
+	// is applied on top of its parent
+	seen := make(map[types.Hash]bool, len(b.Transactions))
+	for i := range b.Transactions {
+		tx := &b.Transactions[i]
+		if tx.ChainID != v.Bc.ChainID {
+			return fmt.Errorf("transaction (%s) is for chain (%d), not (%d)", tx.Hash(TxHasher{}), tx.ChainID, v.Bc.ChainID)
+		}
+
+		hash := tx.Hash(TxHasher{})
+		if seen[hash] {
+			return fmt.Errorf("block (%s) contains transaction (%s) twice", b.Hash(BlockHasher{}), hash)
+		}
+		seen[hash] = true
+	}
+
 	return nil
 }
@@ -0,0 +1,26 @@
+/***************************************************************
+ * Arquivo: ed25519.go
+ * Descrição: Chaves Ed25519.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: Ed25519 é determinístico por construção e não
+ * permite recuperar a chave pública da assinatura, então as
+ * transações assinadas com ele carregam a chave completa.
+ ***************************************************************/
+
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+)
+
+func generateEd25519Key() (PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	return PrivateKey{Ed25519: key}, nil
+}
@@ -0,0 +1,241 @@
+/***************************************************************
+ * Arquivo: hdwallet.go
+ * Descrição: Carteiras hierárquicas determinísticas.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: Segue a SLIP-0010, a extensão da BIP-32 para as
+ * curvas P-256 e Ed25519. Todas as chaves de uma carteira vêm da
+ * semente da frase mnemônica.
+ ***************************************************************/
+
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// HardenedOffset is added to an index to derive a hardened child, which
+// cannot be derived from the parent public key.
+const HardenedOffset uint32 = 0x80000000
+
+// WalletPath is the account under which wallet keys are derived, the
+// address index being appended as a hardened index. It follows BIP-44 with
+// the coin type 1 used by test networks.
+const WalletPath = "m/44'/1'/0'/0'"
+
+// ExtendedKey is a private key along with the chain code needed to derive
+// its children.
+type ExtendedKey struct {
+	keyType   KeyType
+	key       []byte
+	chainCode []byte
+	depth     uint8
+	index     uint32
+}
+
+// NewMasterKey returns the root of the tree derived from seed, usually the
+// seed of a mnemonic.
+func NewMasterKey(t KeyType, seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("invalid seed size (%d)", len(seed))
+	}
+
+	var curveKey string
+	switch t {
+	case KeyTypeP256:
+		curveKey = "Nist256p1 seed"
+	case KeyTypeEd25519:
+		curveKey = "ed25519 seed"
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", t)
+	}
+
+	i := hmacSHA512([]byte(curveKey), seed)
+	// an invalid P-256 key is hashed again until it is valid
+	for t == KeyTypeP256 && !validP256Scalar(i[:32]) {
+		i = hmacSHA512([]byte(curveKey), i)
+	}
+	return &ExtendedKey{keyType: t, key: i[:32], chainCode: i[32:]}, nil
+}
+
+// Child returns the child at index, hardened when index is at least
+// HardenedOffset. Ed25519 only allows hardened children.
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	hardened := index >= HardenedOffset
+	if k.keyType == KeyTypeEd25519 && !hardened {
+		return nil, fmt.Errorf("ed25519 keys only have hardened children")
+	}
+	if k.depth == 255 {
+		return nil, fmt.Errorf("maximum derivation depth reached")
+	}
+
+	// data = 0x00 | key | index for hardened children, the compressed
+	// public key | index otherwise
+	data := make([]byte, 0, 1+32+4)
+	if hardened {
+		data = append(data, 0x00)
+		data = append(data, k.key...)
+	} else {
+		pub, err := k.publicKeyBytes()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, pub...)
+	}
+	data = appendIndex(data, index)
+
+	child := &ExtendedKey{keyType: k.keyType, depth: k.depth + 1, index: index}
+	for {
+		i := hmacSHA512(k.chainCode, data)
+		child.chainCode = i[32:]
+		if k.keyType == KeyTypeEd25519 {
+			child.key = i[:32]
+			return child, nil
+		}
+
+		// P-256: child = IL + parent mod n, retried with
+		// 0x01 | IR | index when IL or the child is not a valid key
+		n := elliptic.P256().Params().N
+		il := new(big.Int).SetBytes(i[:32])
+		if il.Cmp(n) < 0 {
+			key := il.Add(il, new(big.Int).SetBytes(k.key))
+			key.Mod(key, n)
+			if key.Sign() != 0 {
+				child.key = key.FillBytes(make([]byte, 32))
+				return child, nil
+			}
+		}
+		data = appendIndex(append([]byte{0x01}, i[32:]...), index)
+	}
+}
+
+// Derive follows a path such as "m/44'/1'/0'/0'/3", where ' or h marks a
+// hardened index.
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := k
+	for _, index := range indexes {
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// PrivateKey returns the key itself, usable to sign.
+func (k *ExtendedKey) PrivateKey() (PrivateKey, error) {
+	switch k.keyType {
+	case KeyTypeP256:
+		return p256KeyFromScalar(k.key)
+	default:
+		return PrivateKey{Ed25519: ed25519.NewKeyFromSeed(k.key)}, nil
+	}
+}
+
+// ChainCode returns the chain code of the key.
+func (k *ExtendedKey) ChainCode() []byte {
+	return append([]byte{}, k.chainCode...)
+}
+
+// Depth returns how many derivations separate the key from the master key.
+func (k *ExtendedKey) Depth() uint8 {
+	return k.depth
+}
+
+// Index returns the index the key was derived at, 0 for the master key.
+func (k *ExtendedKey) Index() uint32 {
+	return k.index
+}
+
+// WalletKey derives the key of the given address index of the wallet of a
+// mnemonic, at WalletPath/index'. The same mnemonic and passphrase always
+// give back the same keys.
+func WalletKey(mnemonic, passphrase string, t KeyType, index uint32) (PrivateKey, error) {
+	if index >= HardenedOffset {
+		return PrivateKey{}, fmt.Errorf("invalid address index (%d)", index)
+	}
+
+	seed, err := NewSeed(mnemonic, passphrase)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	master, err := NewMasterKey(t, seed)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	account, err := master.Derive(WalletPath)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	key, err := account.Child(index + HardenedOffset)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	return key.PrivateKey()
+}
+
+// ParsePath parses a derivation path into its indexes, hardened indexes
+// having HardenedOffset added.
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("derivation path %q must start with m", path)
+	}
+
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+
+		index, err := strconv.ParseUint(part, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid index %q in derivation path %q", part, path)
+		}
+		if hardened {
+			index += uint64(HardenedOffset)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+func (k *ExtendedKey) publicKeyBytes() ([]byte, error) {
+	priv, err := k.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return marshalP256PublicKey(priv.PublicKey().Key), nil
+}
+
+func appendIndex(data []byte, index uint32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], index)
+	return append(data, b[:]...)
+}
+
+func validP256Scalar(b []byte) bool {
+	v := new(big.Int).SetBytes(b)
+	return v.Sign() != 0 && v.Cmp(elliptic.P256().Params().N) < 0
+}
+
+func hmacSHA512(key, data []byte) []byte {
+	m := hmac.New(sha512.New, key)
+	m.Write(data)
+	return m.Sum(nil)
+}
@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Vectors from SLIP-0010, test vector 1.
+var slip10Seed, _ = hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+
+func TestMasterKeyVectors(t *testing.T) {
+	vectors := []struct {
+		keyType   KeyType
+		path      string
+		chainCode string
+		key       string
+	}{
+		{KeyTypeEd25519, "m", "90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb", "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7"},
+		{KeyTypeEd25519, "m/0'", "8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69", "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3"},
+		{KeyTypeP256, "m", "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+		{KeyTypeP256, "m/0'", "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11", "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+		{KeyTypeP256, "m/0'/1", "4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c", "284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129"},
+	}
+
+	for _, v := range vectors {
+		master, err := NewMasterKey(v.keyType, slip10Seed)
+		assert.Nil(t, err)
+		key, err := master.Derive(v.path)
+		assert.Nil(t, err)
+
+		assert.Equal(t, v.chainCode, hex.EncodeToString(key.ChainCode()), v.path)
+		priv, err := key.PrivateKey()
+		assert.Nil(t, err)
+		assert.Equal(t, v.key, hex.EncodeToString(priv.ToBytes()[1:]), v.path)
+	}
+}
+
+func TestDerivePath(t *testing.T) {
+	indexes, err := ParsePath("m/44'/1h/0/7")
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{44 + HardenedOffset, 1 + HardenedOffset, 0, 7}, indexes)
+
+	for _, path := range []string{"", "44'/1'", "m/x", "m/2147483648", "m//1"} {
+		_, err := ParsePath(path)
+		assert.NotNil(t, err, path)
+	}
+
+	master, err := NewMasterKey(KeyTypeEd25519, slip10Seed)
+	assert.Nil(t, err)
+	_, err = master.Derive("m/0")
+	assert.NotNil(t, err)
+
+	master, err = NewMasterKey(KeyTypeP256, slip10Seed)
+	assert.Nil(t, err)
+	key, err := master.Derive("m/0'/1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(2), key.Depth())
+	assert.Equal(t, uint32(1), key.Index())
+}
+
+func TestWalletKeyRecovery(t *testing.T) {
+	mnemonic, err := GenerateMnemonic(128)
+	assert.Nil(t, err)
+
+	for _, keyType := range []KeyType{KeyTypeP256, KeyTypeEd25519} {
+		first, err := WalletKey(mnemonic, "", keyType, 0)
+		assert.Nil(t, err)
+		second, err := WalletKey(mnemonic, "", keyType, 1)
+		assert.Nil(t, err)
+		assert.NotEqual(t, first.PublicKey().Address(), second.PublicKey().Address())
+
+		// the phrase alone gives every address back
+		recovered, err := WalletKey(mnemonic, "", keyType, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, second.PublicKey().Address(), recovered.PublicKey().Address())
+
+		// the passphrase is part of the seed
+		other, err := WalletKey(mnemonic, "extra", keyType, 1)
+		assert.Nil(t, err)
+		assert.NotEqual(t, second.PublicKey().Address(), other.PublicKey().Address())
+	}
+}
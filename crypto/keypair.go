@@ -2,92 +2,377 @@ package crypto
 
 import (
 	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
+	"crypto/ed25519"
 	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"math/big"
 
 	"github.com/JoaoRafa19/crypto-go/types"
 )
 
-type PrivateKey struct {
-	Key *ecdsa.PrivateKey
+// KeyType identifies a signature scheme. It is the first byte of every
+// serialized key, so keys of different schemes never share an encoding or
+// an address.
+type KeyType byte
+
+const (
+	KeyTypeP256    KeyType = 0x01
+	KeyTypeEd25519 KeyType = 0x02
+)
+
+func (t KeyType) String() string {
+	switch t {
+	case KeyTypeP256:
+		return "p256"
+	case KeyTypeEd25519:
+		return "ed25519"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
 }
 
-func (k PrivateKey) Sign(data []byte) (*Signature, error) {
-	r, s, err := ecdsa.Sign(rand.Reader, k.Key, data)
-	if err != nil {
-		return nil, err
+// PublicKeySize is the size of a public key of the scheme, without the type
+// tag, or 0 for an unknown scheme.
+func (t KeyType) PublicKeySize() int {
+	switch t {
+	case KeyTypeP256:
+		return p256PublicKeySize
+	case KeyTypeEd25519:
+		return ed25519.PublicKeySize
+	default:
+		return 0
 	}
+}
 
-	return &Signature{
-		S: s,
-		R: r,
-	}, nil
+// SignatureSize is the size of a signature of the scheme as returned by
+// Signature.ToBytes, or 0 for an unknown scheme.
+func (t KeyType) SignatureSize() int {
+	switch t {
+	case KeyTypeP256:
+		return RecoverableSignatureSize
+	case KeyTypeEd25519:
+		return ed25519.SignatureSize
+	default:
+		return 0
+	}
 }
 
-func GeneratePrivateKey() PrivateKey {
+// Signing domains. Every kind of signed object hashes its bytes under its
+// own domain, so a signature over one can never pass as a signature over
+// another.
+const (
+	DomainTransaction = "crypto-go/transaction"
+	DomainBlockHeader = "crypto-go/block-header"
+	DomainVote        = "crypto-go/vote"
+	DomainProposal    = "crypto-go/proposal"
+)
 
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+// Digest is the message actually signed for data under the given domain:
+// the SHA-256 of len(domain) u32 | domain | data.
+func Digest(domain string, data []byte) types.Hash {
+	h := sha256.New()
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(domain)))
+	h.Write(size[:])
+	h.Write([]byte(domain))
+	h.Write(data)
+	return types.HashFromBytes(h.Sum(nil))
+}
+
+// PrivateKey is a signing key. Exactly one of the fields is set, depending
+// on the scheme.
+type PrivateKey struct {
+	Key     *ecdsa.PrivateKey
+	Ed25519 ed25519.PrivateKey
+}
+
+// GeneratePrivateKey returns a new P-256 key, the default scheme.
+func GeneratePrivateKey() PrivateKey {
+	key, err := GenerateKey(KeyTypeP256)
 	if err != nil {
 		panic(err)
 	}
-	return PrivateKey{
-		Key: key,
+	return key
+}
+
+// GenerateKey returns a new key of the given scheme.
+func GenerateKey(t KeyType) (PrivateKey, error) {
+	switch t {
+	case KeyTypeP256:
+		return generateP256Key()
+	case KeyTypeEd25519:
+		return generateEd25519Key()
+	default:
+		return PrivateKey{}, fmt.Errorf("unsupported key type %s", t)
 	}
 }
 
-type PublicKey struct {
-	Key *ecdsa.PublicKey
+// Type returns the scheme of the key, 0 when it is empty.
+func (k PrivateKey) Type() KeyType {
+	switch {
+	case k.Key != nil:
+		return KeyTypeP256
+	case k.Ed25519 != nil:
+		return KeyTypeEd25519
+	default:
+		return 0
+	}
+}
+
+// Sign signs the digest of data under domain.
+func (k PrivateKey) Sign(domain string, data []byte) (*Signature, error) {
+	return k.SignHash(Digest(domain, data))
+}
+
+// SignHash signs a 32 byte hash. Signatures of every scheme are
+// deterministic: the same key and hash always give the same signature.
+func (k PrivateKey) SignHash(hash types.Hash) (*Signature, error) {
+	switch k.Type() {
+	case KeyTypeP256:
+		return signP256(k.Key, hash)
+	case KeyTypeEd25519:
+		return &Signature{Ed25519: ed25519.Sign(k.Ed25519, hash[:])}, nil
+	default:
+		return nil, fmt.Errorf("private key is empty")
+	}
 }
 
 func (k PrivateKey) PublicKey() PublicKey {
-	return PublicKey{
-		Key: &k.Key.PublicKey,
+	switch k.Type() {
+	case KeyTypeP256:
+		return PublicKey{Key: &k.Key.PublicKey}
+	case KeyTypeEd25519:
+		return PublicKey{Ed25519: k.Ed25519.Public().(ed25519.PublicKey)}
+	default:
+		return PublicKey{}
 	}
 }
 
+// ToBytes returns the type tag followed by the secret: the 32 byte scalar
+// for P-256, the 32 byte seed for Ed25519.
 func (k PrivateKey) ToBytes() []byte {
-	return k.Key.D.Bytes()
+	switch k.Type() {
+	case KeyTypeP256:
+		b := make([]byte, 1+32)
+		b[0] = byte(KeyTypeP256)
+		k.Key.D.FillBytes(b[1:])
+		return b
+	case KeyTypeEd25519:
+		return append([]byte{byte(KeyTypeEd25519)}, k.Ed25519.Seed()...)
+	default:
+		return nil
+	}
 }
 
+// PrivateKeyFromBytes decodes a key encoded with ToBytes.
 func PrivateKeyFromBytes(data []byte) (PrivateKey, error) {
-	d := new(big.Int).SetBytes(data)
-	privKey := new(ecdsa.PrivateKey)
-	privKey.PublicKey.Curve = elliptic.P256()
-	privKey.D = d
-	privKey.PublicKey.X, privKey.PublicKey.Y = elliptic.P256().ScalarBaseMult(d.Bytes())
-	return PrivateKey{Key: privKey}, nil
+	if len(data) != 1+32 {
+		return PrivateKey{}, fmt.Errorf("invalid private key size (%d)", len(data))
+	}
+
+	switch t := KeyType(data[0]); t {
+	case KeyTypeP256:
+		return p256KeyFromScalar(data[1:])
+	case KeyTypeEd25519:
+		return PrivateKey{Ed25519: ed25519.NewKeyFromSeed(data[1:])}, nil
+	default:
+		return PrivateKey{}, fmt.Errorf("unsupported key type %s", t)
+	}
+}
+
+// PublicKey is a verification key. Exactly one of the fields is set,
+// depending on the scheme, or none for a missing key.
+type PublicKey struct {
+	Key     *ecdsa.PublicKey
+	Ed25519 ed25519.PublicKey
+}
+
+// Type returns the scheme of the key, 0 when it is empty.
+func (k PublicKey) Type() KeyType {
+	switch {
+	case k.Key != nil:
+		return KeyTypeP256
+	case k.Ed25519 != nil:
+		return KeyTypeEd25519
+	default:
+		return 0
+	}
 }
 
+// IsZero tells whether the key is missing.
+func (k PublicKey) IsZero() bool {
+	return k.Type() == 0
+}
+
+// ToBytes returns the type tag followed by the key: the compressed point
+// for P-256, the raw key for Ed25519.
 func (k PublicKey) ToBytes() []byte {
-	return elliptic.MarshalCompressed(k.Key, k.Key.X, k.Key.Y)
+	switch k.Type() {
+	case KeyTypeP256:
+		return append([]byte{byte(KeyTypeP256)}, marshalP256PublicKey(k.Key)...)
+	case KeyTypeEd25519:
+		return append([]byte{byte(KeyTypeEd25519)}, k.Ed25519...)
+	default:
+		return nil
+	}
 }
 
+// PublicKeyFromBytes decodes a key encoded with ToBytes.
 func PublicKeyFromBytes(data []byte) (PublicKey, error) {
-	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), data)
-	if x == nil {
+	if len(data) == 0 {
 		return PublicKey{}, fmt.Errorf("invalid public key data")
 	}
-	return PublicKey{Key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+	return PublicKeyFromRaw(KeyType(data[0]), data[1:])
 }
 
-func (k PublicKey) ToSlice() []byte {
-	return elliptic.MarshalCompressed(k.Key, k.Key.X, k.Key.Y)
+// PublicKeyFromRaw decodes a key of the given scheme without its type tag.
+func PublicKeyFromRaw(t KeyType, data []byte) (PublicKey, error) {
+	if size := t.PublicKeySize(); size == 0 {
+		return PublicKey{}, fmt.Errorf("unsupported key type %s", t)
+	} else if len(data) != size {
+		return PublicKey{}, fmt.Errorf("invalid %s public key size (%d)", t, len(data))
+	}
 
+	switch t {
+	case KeyTypeP256:
+		return unmarshalP256PublicKey(data)
+	default:
+		return PublicKey{Ed25519: append(ed25519.PublicKey{}, data...)}, nil
+	}
+}
+
+// GobEncode encodes the key with ToBytes, so gob does not need to know the
+// concrete type of the curve.
+func (k PublicKey) GobEncode() ([]byte, error) {
+	if k.IsZero() {
+		return []byte{}, nil
+	}
+	return k.ToBytes(), nil
+}
+
+func (k *PublicKey) GobDecode(data []byte) error {
+	if len(data) == 0 {
+		*k = PublicKey{}
+		return nil
+	}
+
+	key, err := PublicKeyFromBytes(data)
+	if err != nil {
+		return err
+	}
+	*k = key
+	return nil
 }
 
+func (k PublicKey) ToSlice() []byte {
+	return k.ToBytes()
+}
+
+// Address is the last 20 bytes of the SHA-256 of the tagged key, so the
+// scheme is part of the address.
 func (k PublicKey) Address() types.Address {
-	h := sha256.Sum256(k.ToSlice())
+	h := sha256.Sum256(k.ToBytes())
 
 	return types.AddressFromBytes(h[len(h)-20:])
 }
 
+// Signature is a signature of one of the schemes. R, S and V hold a P-256
+// signature, V being the recovery id used to find the public key back from
+// the signature and the message. Ed25519 holds an Ed25519 signature.
 type Signature struct {
-	S, R *big.Int
+	S, R    *big.Int
+	V       byte
+	Ed25519 []byte
+}
+
+// Type returns the scheme of the signature.
+func (sig Signature) Type() KeyType {
+	if sig.Ed25519 != nil {
+		return KeyTypeEd25519
+	}
+	return KeyTypeP256
+}
+
+// ToBytes returns the signature in the fixed size encoding of its scheme:
+// r||s||v for P-256, each of r and s on 32 bytes, and the 64 byte signature
+// for Ed25519. A P-256 signature without a recovery id is encoded as r||s.
+func (sig Signature) ToBytes() []byte {
+	if sig.Type() == KeyTypeEd25519 {
+		return append([]byte{}, sig.Ed25519...)
+	}
+	return p256SignatureBytes(sig)
+}
+
+// SignatureFromBytes decodes a signature of the given scheme encoded with
+// ToBytes. For P-256 it also accepts r||s, for a signature that can only be
+// verified against a known key.
+func SignatureFromBytes(t KeyType, data []byte) (*Signature, error) {
+	switch t {
+	case KeyTypeP256:
+		return p256SignatureFromBytes(data)
+	case KeyTypeEd25519:
+		if len(data) != ed25519.SignatureSize {
+			return nil, fmt.Errorf("invalid ed25519 signature size (%d)", len(data))
+		}
+		return &Signature{Ed25519: append([]byte{}, data...)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", t)
+	}
+}
+
+// GobEncode encodes the signature as its type followed by ToBytes, so gob
+// does not depend on the layout of big.Int.
+func (sig Signature) GobEncode() ([]byte, error) {
+	if sig.Type() == KeyTypeP256 && (sig.R == nil || sig.S == nil) {
+		return nil, fmt.Errorf("signature is empty")
+	}
+	return append([]byte{byte(sig.Type())}, sig.ToBytes()...), nil
+}
+
+func (sig *Signature) GobDecode(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("signature is empty")
+	}
+	decoded, err := SignatureFromBytes(KeyType(data[0]), data[1:])
+	if err != nil {
+		return err
+	}
+	*sig = *decoded
+	return nil
 }
 
-func (sig Signature) Verify(pubKey PublicKey, data []byte) bool {
-	return ecdsa.Verify(pubKey.Key, data, sig.R, sig.S)
+// Verify checks the signature over the digest of data under domain.
+func (sig Signature) Verify(pubKey PublicKey, domain string, data []byte) bool {
+	return sig.VerifyHash(pubKey, Digest(domain, data))
+}
+
+// VerifyHash checks the signature over a 32 byte hash with the scheme of
+// the key. A signature of another scheme never verifies.
+func (sig Signature) VerifyHash(pubKey PublicKey, hash types.Hash) bool {
+	if pubKey.IsZero() || pubKey.Type() != sig.Type() {
+		return false
+	}
+
+	switch pubKey.Type() {
+	case KeyTypeP256:
+		return verifyP256(pubKey.Key, sig, hash)
+	default:
+		return len(sig.Ed25519) == ed25519.SignatureSize && ed25519.Verify(pubKey.Ed25519, hash[:], sig.Ed25519)
+	}
+}
+
+// RecoverPublicKey returns the key that signed data under domain.
+func (sig Signature) RecoverPublicKey(domain string, data []byte) (PublicKey, error) {
+	return sig.RecoverPublicKeyFromHash(Digest(domain, data))
+}
+
+// RecoverPublicKeyFromHash returns the key that signed hash. Only P-256
+// signatures allow it. Any valid signature recovers some key, so the caller
+// must compare it, or its address, with the expected signer.
+func (sig Signature) RecoverPublicKeyFromHash(hash types.Hash) (PublicKey, error) {
+	if sig.Type() != KeyTypeP256 {
+		return PublicKey{}, fmt.Errorf("%s signatures do not allow recovering the public key", sig.Type())
+	}
+	return recoverP256(sig, hash)
 }
@@ -1,8 +1,15 @@
 package crypto
 
 import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
 	"testing"
 
+	"github.com/JoaoRafa19/crypto-go/types"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -12,10 +19,10 @@ func Test_KeyPairSignVerifySuccess(t *testing.T) {
 
 	msg := []byte("Hello World!")
 
-	sig, err := privKey.Sign(msg)
+	sig, err := privKey.Sign(DomainTransaction, msg)
 
 	assert.Nil(t, err)
-	assert.True(t, sig.Verify(pubKey, msg))
+	assert.True(t, sig.Verify(pubKey, DomainTransaction, msg))
 
 }
 func Test_KeyPairSignVerifyFail(t *testing.T) {
@@ -23,15 +30,193 @@ func Test_KeyPairSignVerifyFail(t *testing.T) {
 
 	msg := []byte("Hello World!")
 
-	sig, err := privKey.Sign(msg)
+	sig, err := privKey.Sign(DomainTransaction, msg)
 	assert.Nil(t, err) 	
 
 	otherKey := GeneratePrivateKey()
 	otherPub := otherKey.PublicKey()
 	otherMessage := []byte("xxxx")
 
-	assert.False(t, sig.Verify(otherPub, msg))
+	assert.False(t, sig.Verify(otherPub, DomainTransaction, msg))
+
+	assert.False(t, sig.Verify(otherPub, DomainTransaction, otherMessage))
+
+}
+
+// RFC 6979 A.2.5, P-256 with SHA-256 over "sample". The expected S is the
+// one of the RFC normalized to the lower half of the order (n - s).
+func TestSignHashRFC6979(t *testing.T) {
+	d, err := hex.DecodeString("C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721")
+	assert.Nil(t, err)
+	privKey, err := PrivateKeyFromBytes(append([]byte{byte(KeyTypeP256)}, d...))
+	assert.Nil(t, err)
+
+	hash := sha256.Sum256([]byte("sample"))
+	sig, err := privKey.SignHash(types.Hash(hash))
+	assert.Nil(t, err)
+
+	r, _ := new(big.Int).SetString("EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716", 16)
+	s, _ := new(big.Int).SetString("0834E36AD29A83BF2BC9385E491D6099C8FDF9D1ED67AA7EA5F51F93782857A9", 16)
+	assert.Equal(t, r, sig.R)
+	assert.Equal(t, s, sig.S)
+	assert.True(t, sig.VerifyHash(privKey.PublicKey(), types.Hash(hash)))
+}
+
+func TestSignIsDeterministic(t *testing.T) {
+	privKey := GeneratePrivateKey()
+	msg := []byte("Hello World!")
+
+	first, err := privKey.Sign(DomainTransaction, msg)
+	assert.Nil(t, err)
+	second, err := privKey.Sign(DomainTransaction, msg)
+	assert.Nil(t, err)
+	assert.Equal(t, first, second)
+
+	// the domain is part of the signed message
+	header, err := privKey.Sign(DomainBlockHeader, msg)
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, header)
+	assert.False(t, first.Verify(privKey.PublicKey(), DomainBlockHeader, msg))
+}
+
+func TestSignMatchesStdlibVerify(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		privKey := GeneratePrivateKey()
+		hash := types.Hash(sha256.Sum256([]byte(fmt.Sprintf("message %d", i))))
+
+		sig, err := signP256(privKey.Key, hash)
+		assert.Nil(t, err)
+		assert.True(t, ecdsa.Verify(&privKey.Key.PublicKey, hash[:], sig.R, sig.S))
+
+		// the blinding factor is random, the signature is not
+		again, err := signP256(privKey.Key, hash)
+		assert.Nil(t, err)
+		assert.Equal(t, sig, again)
+	}
+}
+
+func TestVerifyRejectsHighS(t *testing.T) {
+	privKey := GeneratePrivateKey()
+	msg := []byte("Hello World!")
+
+	for i := 0; i < 16; i++ {
+		sig, err := privKey.Sign(DomainTransaction, append(msg, byte(i)))
+		assert.Nil(t, err)
+
+		n := privKey.Key.Curve.Params().N
+		assert.True(t, sig.S.Cmp(new(big.Int).Rsh(n, 1)) <= 0)
+
+		// (r, n - s) is valid ECDSA but not canonical
+		flipped := Signature{R: sig.R, S: new(big.Int).Sub(n, sig.S)}
+		assert.False(t, flipped.Verify(privKey.PublicKey(), DomainTransaction, append(msg, byte(i))))
+	}
+}
+
+func TestSignatureBytes(t *testing.T) {
+	privKey := GeneratePrivateKey()
+	msg := []byte("Hello World!")
+
+	sig, err := privKey.Sign(DomainTransaction, msg)
+	assert.Nil(t, err)
+
+	data := sig.ToBytes()
+	assert.Len(t, data, RecoverableSignatureSize)
+	decoded, err := SignatureFromBytes(KeyTypeP256, data)
+	assert.Nil(t, err)
+	assert.Equal(t, sig, decoded)
+
+	// r||s is enough to verify but not to recover
+	short, err := SignatureFromBytes(KeyTypeP256, data[:SignatureSize])
+	assert.Nil(t, err)
+	assert.True(t, short.Verify(privKey.PublicKey(), DomainTransaction, msg))
+	assert.Equal(t, data[:SignatureSize], short.ToBytes())
+	_, err = short.RecoverPublicKey(DomainTransaction, msg)
+	assert.NotNil(t, err)
+
+	_, err = SignatureFromBytes(KeyTypeP256, data[:10])
+	assert.NotNil(t, err)
+	data[64] = 4
+	_, err = SignatureFromBytes(KeyTypeP256, data)
+	assert.NotNil(t, err)
+}
+
+func TestRecoverPublicKey(t *testing.T) {
+	for i := 0; i < 32; i++ {
+		privKey := GeneratePrivateKey()
+		msg := []byte{byte(i)}
+
+		sig, err := privKey.Sign(DomainTransaction, msg)
+		assert.Nil(t, err)
+
+		recovered, err := sig.RecoverPublicKey(DomainTransaction, msg)
+		assert.Nil(t, err)
+		assert.Equal(t, privKey.PublicKey().ToBytes(), recovered.ToBytes())
+
+		// another message recovers another key
+		other, err := sig.RecoverPublicKey(DomainTransaction, []byte("other"))
+		if err == nil {
+			assert.NotEqual(t, privKey.PublicKey().Address(), other.Address())
+		}
+	}
+}
+
+func TestEd25519SignVerify(t *testing.T) {
+	privKey, err := GenerateKey(KeyTypeEd25519)
+	assert.Nil(t, err)
+	assert.Equal(t, KeyTypeEd25519, privKey.Type())
+	msg := []byte("Hello World!")
+
+	sig, err := privKey.Sign(DomainTransaction, msg)
+	assert.Nil(t, err)
+	assert.Equal(t, KeyTypeEd25519, sig.Type())
+	assert.True(t, sig.Verify(privKey.PublicKey(), DomainTransaction, msg))
+	assert.False(t, sig.Verify(privKey.PublicKey(), DomainBlockHeader, msg))
+
+	// Ed25519 keys cannot be recovered
+	_, err = sig.RecoverPublicKey(DomainTransaction, msg)
+	assert.NotNil(t, err)
+
+	decoded, err := SignatureFromBytes(KeyTypeEd25519, sig.ToBytes())
+	assert.Nil(t, err)
+	assert.Equal(t, sig, decoded)
+}
+
+func TestSignatureSchemesDoNotMix(t *testing.T) {
+	p256 := GeneratePrivateKey()
+	ed, err := GenerateKey(KeyTypeEd25519)
+	assert.Nil(t, err)
+	msg := []byte("Hello World!")
+
+	sig, err := p256.Sign(DomainTransaction, msg)
+	assert.Nil(t, err)
+	assert.False(t, sig.Verify(ed.PublicKey(), DomainTransaction, msg))
+
+	sig, err = ed.Sign(DomainTransaction, msg)
+	assert.Nil(t, err)
+	assert.False(t, sig.Verify(p256.PublicKey(), DomainTransaction, msg))
+}
+
+func TestKeySerialization(t *testing.T) {
+	for _, keyType := range []KeyType{KeyTypeP256, KeyTypeEd25519} {
+		privKey, err := GenerateKey(keyType)
+		assert.Nil(t, err)
+
+		data := privKey.ToBytes()
+		assert.Equal(t, byte(keyType), data[0])
+		decoded, err := PrivateKeyFromBytes(data)
+		assert.Nil(t, err)
+		assert.Equal(t, privKey.PublicKey().ToBytes(), decoded.PublicKey().ToBytes())
 
-	assert.False(t, sig.Verify(otherPub, otherMessage))
+		pubData := privKey.PublicKey().ToBytes()
+		assert.Equal(t, byte(keyType), pubData[0])
+		assert.Len(t, pubData, 1+keyType.PublicKeySize())
+		pubKey, err := PublicKeyFromBytes(pubData)
+		assert.Nil(t, err)
+		assert.Equal(t, privKey.PublicKey().Address(), pubKey.Address())
+	}
 
+	_, err := PublicKeyFromBytes([]byte{0x7f, 0x01})
+	assert.NotNil(t, err)
+	_, err = PrivateKeyFromBytes(append([]byte{byte(KeyTypeP256)}, make([]byte, 32)...))
+	assert.NotNil(t, err)
 }
@@ -0,0 +1,220 @@
+/***************************************************************
+ * Arquivo: keystore.go
+ * Descrição: Armazenamento de chaves privadas cifradas com senha.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: A chave é derivada da senha com scrypt e a chave
+ * privada é cifrada com AES-256-GCM. O arquivo é um JSON
+ * versionado.
+ ***************************************************************/
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	KeystoreVersion = 1
+
+	keystoreKDF    = "scrypt"
+	keystoreCipher = "aes-256-gcm"
+	keystoreKeyLen = 32
+	keystoreSalt   = 32
+	// keystores come from disk, bound the memory they can make us use
+	maxScryptN = 1 << 20
+)
+
+// ScryptParams are the cost parameters of the key derivation. They are
+// stored in the keystore file, so a file can always be opened whatever the
+// parameters used to write it.
+type ScryptParams struct {
+	N int `json:"n"`
+	R int `json:"r"`
+	P int `json:"p"`
+}
+
+var (
+	// StandardScrypt takes around a second and 256MiB of memory.
+	StandardScrypt = ScryptParams{N: 1 << 18, R: 8, P: 1}
+	// LightScrypt is meant for tests and throwaway keys.
+	LightScrypt = ScryptParams{N: 1 << 12, R: 8, P: 1}
+)
+
+// keystoreFile is the JSON layout of a keystore file. The address is stored
+// in clear to find a key without the passphrase, and authenticated as the
+// additional data of the cipher.
+type keystoreFile struct {
+	Version int         `json:"version"`
+	Address string      `json:"address"`
+	KeyType string      `json:"keyType"`
+	Crypto  keystoreKey `json:"crypto"`
+}
+
+type keystoreKey struct {
+	KDF        string       `json:"kdf"`
+	KDFParams  ScryptParams `json:"kdfparams"`
+	Salt       string       `json:"salt"`
+	Cipher     string       `json:"cipher"`
+	Nonce      string       `json:"nonce"`
+	Ciphertext string       `json:"ciphertext"`
+}
+
+// EncryptKey returns the keystore JSON of key, encrypted with passphrase.
+func EncryptKey(key PrivateKey, passphrase string, params ScryptParams) ([]byte, error) {
+	if key.Type() == 0 {
+		return nil, fmt.Errorf("private key is empty")
+	}
+
+	salt := make([]byte, keystoreSalt)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	aead, err := keystoreAEAD(passphrase, salt, params)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	address := key.PublicKey().Address()
+	ciphertext := aead.Seal(nil, nonce, key.ToBytes(), address[:])
+
+	return json.MarshalIndent(keystoreFile{
+		Version: KeystoreVersion,
+		Address: address.String(),
+		KeyType: key.Type().String(),
+		Crypto: keystoreKey{
+			KDF:        keystoreKDF,
+			KDFParams:  params,
+			Salt:       hex.EncodeToString(salt),
+			Cipher:     keystoreCipher,
+			Nonce:      hex.EncodeToString(nonce),
+			Ciphertext: hex.EncodeToString(ciphertext),
+		},
+	}, "", "  ")
+}
+
+// DecryptKey opens a keystore JSON written by EncryptKey. A wrong
+// passphrase and a tampered file give the same error.
+func DecryptKey(data []byte, passphrase string) (PrivateKey, error) {
+	var file keystoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return PrivateKey{}, fmt.Errorf("invalid keystore: %s", err)
+	}
+	if file.Version != KeystoreVersion {
+		return PrivateKey{}, fmt.Errorf("unsupported keystore version (%d)", file.Version)
+	}
+	if file.Crypto.KDF != keystoreKDF || file.Crypto.Cipher != keystoreCipher {
+		return PrivateKey{}, fmt.Errorf("unsupported keystore kdf (%s) or cipher (%s)", file.Crypto.KDF, file.Crypto.Cipher)
+	}
+
+	if params := file.Crypto.KDFParams; params.N > maxScryptN || params.R > 32 || params.P > 16 {
+		return PrivateKey{}, fmt.Errorf("keystore scrypt parameters are too costly")
+	}
+
+	address, err := hex.DecodeString(file.Address)
+	if err != nil || len(address) != 20 {
+		return PrivateKey{}, fmt.Errorf("invalid keystore address %q", file.Address)
+	}
+	salt, err := hex.DecodeString(file.Crypto.Salt)
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("invalid keystore salt: %s", err)
+	}
+	nonce, err := hex.DecodeString(file.Crypto.Nonce)
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("invalid keystore nonce: %s", err)
+	}
+	ciphertext, err := hex.DecodeString(file.Crypto.Ciphertext)
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("invalid keystore ciphertext: %s", err)
+	}
+
+	aead, err := keystoreAEAD(passphrase, salt, file.Crypto.KDFParams)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return PrivateKey{}, fmt.Errorf("invalid keystore nonce size (%d)", len(nonce))
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, address)
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("could not decrypt keystore: wrong passphrase or corrupted file")
+	}
+
+	key, err := PrivateKeyFromBytes(plaintext)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	if addr := key.PublicKey().Address(); addr.String() != file.Address {
+		return PrivateKey{}, fmt.Errorf("keystore key does not match the address %s", file.Address)
+	}
+	return key, nil
+}
+
+// WriteKeyFile encrypts key into a new file at path, readable only by its
+// owner. An existing file is never overwritten.
+func WriteKeyFile(path string, key PrivateKey, passphrase string, params ScryptParams) error {
+	data, err := EncryptKey(key, passphrase, params)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// ReadKeyFile opens a keystore file written by WriteKeyFile.
+func ReadKeyFile(path string, passphrase string) (PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	key, err := DecryptKey(data, passphrase)
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("%s: %s", path, err)
+	}
+	return key, nil
+}
+
+func keystoreAEAD(passphrase string, salt []byte, params ScryptParams) (cipher.AEAD, error) {
+	derived, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, keystoreKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scrypt parameters: %s", err)
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
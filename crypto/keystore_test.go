@@ -0,0 +1,66 @@
+package crypto
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	for _, keyType := range []KeyType{KeyTypeP256, KeyTypeEd25519} {
+		key, err := GenerateKey(keyType)
+		assert.Nil(t, err)
+
+		data, err := EncryptKey(key, "secret", LightScrypt)
+		assert.Nil(t, err)
+
+		decrypted, err := DecryptKey(data, "secret")
+		assert.Nil(t, err)
+		assert.Equal(t, key.ToBytes(), decrypted.ToBytes())
+
+		_, err = DecryptKey(data, "wrong")
+		assert.NotNil(t, err)
+	}
+}
+
+func TestKeystoreRejectsTampering(t *testing.T) {
+	key := GeneratePrivateKey()
+	data, err := EncryptKey(key, "secret", LightScrypt)
+	assert.Nil(t, err)
+
+	var file map[string]interface{}
+	assert.Nil(t, json.Unmarshal(data, &file))
+
+	// the address is authenticated by the cipher
+	file["address"] = GeneratePrivateKey().PublicKey().Address().String()
+	tampered, err := json.Marshal(file)
+	assert.Nil(t, err)
+	_, err = DecryptKey(tampered, "secret")
+	assert.NotNil(t, err)
+
+	file["version"] = KeystoreVersion + 1
+	tampered, err = json.Marshal(file)
+	assert.Nil(t, err)
+	_, err = DecryptKey(tampered, "secret")
+	assert.NotNil(t, err)
+}
+
+func TestKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "validator.json")
+	key := GeneratePrivateKey()
+
+	assert.Nil(t, WriteKeyFile(path, key, "secret", LightScrypt))
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// an existing key is never overwritten
+	assert.NotNil(t, WriteKeyFile(path, GeneratePrivateKey(), "secret", LightScrypt))
+
+	loaded, err := ReadKeyFile(path, "secret")
+	assert.Nil(t, err)
+	assert.Equal(t, key.PublicKey().Address(), loaded.PublicKey().Address())
+}
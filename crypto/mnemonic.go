@@ -0,0 +1,150 @@
+/***************************************************************
+ * Arquivo: mnemonic.go
+ * Descrição: Frases mnemônicas (BIP-39) e derivação da semente.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: Usa a lista de palavras em inglês da especificação
+ * BIP-39, então as frases são compatíveis com outras carteiras.
+ ***************************************************************/
+
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+//go:embed bip39_english.txt
+var englishWords string
+
+var (
+	wordList  = strings.Split(strings.TrimSpace(englishWords), "\n")
+	wordIndex = indexWords(wordList)
+)
+
+func indexWords(words []string) map[string]int {
+	index := make(map[string]int, len(words))
+	for i, w := range words {
+		index[w] = i
+	}
+	return index
+}
+
+const (
+	seedIterations = 2048
+	seedSize       = 64
+)
+
+// NewEntropy returns random entropy for a mnemonic of bits bits, a multiple
+// of 32 between 128 (12 words) and 256 (24 words).
+func NewEntropy(bits int) ([]byte, error) {
+	if err := checkEntropyBits(bits); err != nil {
+		return nil, err
+	}
+	entropy := make([]byte, bits/8)
+	if _, err := io.ReadFull(rand.Reader, entropy); err != nil {
+		return nil, err
+	}
+	return entropy, nil
+}
+
+// GenerateMnemonic returns a new random mnemonic of bits bits of entropy.
+func GenerateMnemonic(bits int) (string, error) {
+	entropy, err := NewEntropy(bits)
+	if err != nil {
+		return "", err
+	}
+	return NewMnemonic(entropy)
+}
+
+// NewMnemonic encodes entropy as words of 11 bits each, the entropy being
+// followed by the first len(entropy)*8/32 bits of its SHA-256 as checksum.
+func NewMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if err := checkEntropyBits(bits); err != nil {
+		return "", err
+	}
+
+	checksumBits := bits / 32
+	hash := sha256.Sum256(entropy)
+	v := new(big.Int).SetBytes(entropy)
+	v.Lsh(v, uint(checksumBits))
+	v.Or(v, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	count := (bits + checksumBits) / 11
+	words := make([]string, count)
+	mask := big.NewInt(2047)
+	for i := count - 1; i >= 0; i-- {
+		words[i] = wordList[new(big.Int).And(v, mask).Int64()]
+		v.Rsh(v, 11)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy decodes a mnemonic back to its entropy, checking the
+// words and the checksum.
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words)%3 != 0 || len(words) < 12 || len(words) > 24 {
+		return nil, fmt.Errorf("invalid mnemonic length (%d words)", len(words))
+	}
+
+	v := new(big.Int)
+	for _, w := range words {
+		i, ok := wordIndex[w]
+		if !ok {
+			return nil, fmt.Errorf("invalid mnemonic word %q", w)
+		}
+		v.Lsh(v, 11)
+		v.Or(v, big.NewInt(int64(i)))
+	}
+
+	checksumBits := len(words) * 11 / 33
+	checksum := new(big.Int).And(v, big.NewInt(1<<checksumBits-1)).Int64()
+	v.Rsh(v, uint(checksumBits))
+	entropy := v.FillBytes(make([]byte, checksumBits*4))
+
+	hash := sha256.Sum256(entropy)
+	if int64(hash[0]>>(8-checksumBits)) != checksum {
+		return nil, fmt.Errorf("invalid mnemonic checksum")
+	}
+	return entropy, nil
+}
+
+// ValidateMnemonic tells whether mnemonic has known words and a valid
+// checksum.
+func ValidateMnemonic(mnemonic string) bool {
+	_, err := MnemonicToEntropy(mnemonic)
+	return err == nil
+}
+
+// NewSeed returns the 64 byte seed of a valid mnemonic, protected by an
+// optional passphrase: PBKDF2-HMAC-SHA512 of the mnemonic with the salt
+// "mnemonic" + passphrase, both NFKD normalized.
+func NewSeed(mnemonic string, passphrase string) ([]byte, error) {
+	if !ValidateMnemonic(mnemonic) {
+		return nil, fmt.Errorf("invalid mnemonic")
+	}
+
+	password := norm.NFKD.String(strings.Join(strings.Fields(mnemonic), " "))
+	salt := norm.NFKD.String("mnemonic" + passphrase)
+	return pbkdf2.Key([]byte(password), []byte(salt), seedIterations, seedSize, sha512.New), nil
+}
+
+func checkEntropyBits(bits int) error {
+	if bits%32 != 0 || bits < 128 || bits > 256 {
+		return fmt.Errorf("invalid entropy size (%d bits), must be a multiple of 32 between 128 and 256", bits)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+/***************************************************************
+ * Arquivo: p256.go
+ * Descrição: Assinaturas ECDSA na curva P-256.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: As assinaturas usam nonces determinísticos
+ * (RFC 6979), S normalizado para a metade inferior da ordem e um
+ * id de recuperação que permite obter a chave pública.
+ ***************************************************************/
+
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+const (
+	// SignatureSize is the size of r||s, enough to verify a P-256
+	// signature against a known key.
+	SignatureSize = 64
+	// RecoverableSignatureSize is the size of r||s||v, which also allows
+	// recovering the public key.
+	RecoverableSignatureSize = 65
+
+	// noRecoveryID marks a signature decoded from r||s alone
+	noRecoveryID = 0xff
+
+	p256PublicKeySize = 33
+)
+
+func generateP256Key() (PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	return PrivateKey{Key: key}, nil
+}
+
+func p256KeyFromScalar(data []byte) (PrivateKey, error) {
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(data)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return PrivateKey{}, fmt.Errorf("invalid p256 private key")
+	}
+
+	privKey := new(ecdsa.PrivateKey)
+	privKey.PublicKey.Curve = curve
+	privKey.D = d
+	privKey.PublicKey.X, privKey.PublicKey.Y = curve.ScalarBaseMult(data)
+	return PrivateKey{Key: privKey}, nil
+}
+
+func marshalP256PublicKey(k *ecdsa.PublicKey) []byte {
+	return elliptic.MarshalCompressed(k.Curve, k.X, k.Y)
+}
+
+func unmarshalP256PublicKey(data []byte) (PublicKey, error) {
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), data)
+	if x == nil {
+		return PublicKey{}, fmt.Errorf("invalid public key data")
+	}
+	return PublicKey{Key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+}
+
+// signP256 signs a 32 byte hash with a deterministic RFC 6979 nonce. S is
+// normalized to the lower half of the curve order.
+func signP256(key *ecdsa.PrivateKey, hash types.Hash) (*Signature, error) {
+	curve := key.Curve
+	n := curve.Params().N
+	e := bits2int(hash[:], n)
+	nonces := newNonceGenerator(n, key.D, hash[:])
+
+	for {
+		nonce := nonces.next()
+		x, y := curve.ScalarBaseMult(nonce.FillBytes(make([]byte, 32)))
+		r := new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		// the recovery id tells which of the points with x coordinate r
+		// was used: bit 0 is the parity of y, bit 1 is set when x >= n
+		v := byte(y.Bit(0))
+		if x.Cmp(n) >= 0 {
+			v |= 2
+		}
+
+		s, err := blindedS(n, key.D, nonce, r, e)
+		if err != nil {
+			return nil, err
+		}
+		if s.Sign() == 0 {
+			continue
+		}
+
+		// negating s matches the negated point, whose y has the other parity
+		if s.Cmp(halfOrder(n)) > 0 {
+			s.Sub(n, s)
+			v ^= 1
+		}
+		return &Signature{R: r, S: s, V: v}, nil
+	}
+}
+
+// blindedS computes s = nonce^-1 (e + r d) mod n. The big.Int arithmetic is
+// not constant time, so the secret scalars only enter it multiplied by a
+// random factor b, and padded with n to a fixed width:
+//
+//	s = (nonce b)^-1 b (b e + r (d b)) b^-1 mod n
+func blindedS(n, d, nonce, r, e *big.Int) (*big.Int, error) {
+	b, err := rand.Int(rand.Reader, new(big.Int).Sub(n, big.NewInt(1)))
+	if err != nil {
+		return nil, err
+	}
+	b.Add(b, big.NewInt(1))
+
+	// nonce^-1 = (nonce b)^-1 b, where nonce b is uniformly random
+	kInv := new(big.Int).Add(nonce, n)
+	kInv.Mul(kInv, b)
+	kInv.Mod(kInv, n)
+	kInv.ModInverse(kInv, n)
+	kInv.Mul(kInv, b)
+	kInv.Mod(kInv, n)
+
+	db := new(big.Int).Add(d, n)
+	db.Mul(db, b)
+	db.Mod(db, n)
+
+	s := new(big.Int).Mul(r, db)
+	s.Add(s, new(big.Int).Mul(e, b))
+	s.Mod(s, n)
+	s.Mul(s, kInv)
+	s.Mod(s, n)
+	s.Mul(s, new(big.Int).ModInverse(b, n))
+	s.Mod(s, n)
+	return s, nil
+}
+
+func halfOrder(n *big.Int) *big.Int {
+	return new(big.Int).Rsh(n, 1)
+}
+
+// verifyP256 rejects signatures with a high S, as signP256 never produces
+// them and accepting both forms would make every signature malleable.
+func verifyP256(key *ecdsa.PublicKey, sig Signature, hash types.Hash) bool {
+	if sig.R == nil || sig.S == nil {
+		return false
+	}
+	if sig.S.Cmp(halfOrder(key.Curve.Params().N)) > 0 {
+		return false
+	}
+	return ecdsa.Verify(key, hash[:], sig.R, sig.S)
+}
+
+func p256SignatureBytes(sig Signature) []byte {
+	size := RecoverableSignatureSize
+	if sig.V == noRecoveryID {
+		size = SignatureSize
+	}
+
+	b := make([]byte, size)
+	sig.R.FillBytes(b[:32])
+	sig.S.FillBytes(b[32:64])
+	if size == RecoverableSignatureSize {
+		b[64] = sig.V
+	}
+	return b
+}
+
+func p256SignatureFromBytes(data []byte) (*Signature, error) {
+	sig := &Signature{V: noRecoveryID}
+	switch len(data) {
+	case RecoverableSignatureSize:
+		if data[64] > 3 {
+			return nil, fmt.Errorf("invalid recovery id (%d)", data[64])
+		}
+		sig.V = data[64]
+	case SignatureSize:
+	default:
+		return nil, fmt.Errorf("invalid signature size (%d)", len(data))
+	}
+
+	sig.R = new(big.Int).SetBytes(data[:32])
+	sig.S = new(big.Int).SetBytes(data[32:64])
+	return sig, nil
+}
+
+// recoverP256 computes the public key as r^-1 (s R - e G) where R is the
+// point picked by the recovery id.
+func recoverP256(sig Signature, hash types.Hash) (PublicKey, error) {
+	if sig.R == nil || sig.S == nil {
+		return PublicKey{}, fmt.Errorf("signature is empty")
+	}
+	if sig.V > 3 {
+		return PublicKey{}, fmt.Errorf("signature has no recovery id")
+	}
+
+	curve := elliptic.P256()
+	params := curve.Params()
+	n := params.N
+	if sig.R.Sign() <= 0 || sig.R.Cmp(n) >= 0 || sig.S.Sign() <= 0 || sig.S.Cmp(halfOrder(n)) > 0 {
+		return PublicKey{}, fmt.Errorf("signature values out of range")
+	}
+
+	// x coordinate of R, r itself or r + n when it overflowed the order
+	rx := new(big.Int).Set(sig.R)
+	if sig.V&2 != 0 {
+		rx.Add(rx, n)
+	}
+	if rx.Cmp(params.P) >= 0 {
+		return PublicKey{}, fmt.Errorf("invalid recovery id (%d)", sig.V)
+	}
+
+	// y^2 = x^3 - 3x + b
+	ySquared := new(big.Int).Exp(rx, big.NewInt(3), params.P)
+	ySquared.Sub(ySquared, new(big.Int).Mul(rx, big.NewInt(3)))
+	ySquared.Add(ySquared, params.B)
+	ySquared.Mod(ySquared, params.P)
+	ry := new(big.Int).ModSqrt(ySquared, params.P)
+	if ry == nil {
+		return PublicKey{}, fmt.Errorf("signature has no point for r")
+	}
+	if ry.Bit(0) != uint(sig.V&1) {
+		ry.Sub(params.P, ry)
+	}
+
+	rInv := new(big.Int).ModInverse(sig.R, n)
+	e := bits2int(hash[:], n)
+	// u1 = -e r^-1, u2 = s r^-1
+	u1 := new(big.Int).Neg(e)
+	u1.Mul(u1, rInv)
+	u1.Mod(u1, n)
+	u2 := new(big.Int).Mul(sig.S, rInv)
+	u2.Mod(u2, n)
+
+	x1, y1 := curve.ScalarBaseMult(u1.Bytes())
+	x2, y2 := curve.ScalarMult(rx, ry, u2.Bytes())
+	qx, qy := curve.Add(x1, y1, x2, y2)
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return PublicKey{}, fmt.Errorf("recovered the point at infinity")
+	}
+
+	key := PublicKey{Key: &ecdsa.PublicKey{Curve: curve, X: qx, Y: qy}}
+	if !sig.VerifyHash(key, hash) {
+		return PublicKey{}, fmt.Errorf("signature does not verify with the recovered key")
+	}
+	return key, nil
+}
@@ -0,0 +1,99 @@
+/***************************************************************
+ * Arquivo: rfc6979.go
+ * Descrição: Geração determinística do nonce ECDSA (RFC 6979).
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: O nonce é derivado da chave privada e do hash
+ * assinado com HMAC-SHA256, então a mesma mensagem gera sempre a
+ * mesma assinatura e nenhuma fonte de aleatoriedade é necessária.
+ ***************************************************************/
+
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"math/big"
+)
+
+// nonceGenerator yields the candidate nonces of RFC 6979 section 3.2 for a
+// private key and a hash, with HMAC-SHA256.
+type nonceGenerator struct {
+	q    *big.Int
+	k, v []byte
+}
+
+func newNonceGenerator(q, x *big.Int, hash []byte) *nonceGenerator {
+	rolen := (q.BitLen() + 7) / 8
+	bx := append(int2octets(x, rolen), bits2octets(hash, q, rolen)...)
+
+	g := &nonceGenerator{
+		q: q,
+		k: make([]byte, sha256.Size),
+		v: make([]byte, sha256.Size),
+	}
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+
+	// steps d to g
+	g.k = g.mac(g.v, []byte{0x00}, bx)
+	g.v = g.mac(g.v)
+	g.k = g.mac(g.v, []byte{0x01}, bx)
+	g.v = g.mac(g.v)
+	return g
+}
+
+// next returns the next nonce in [1, q-1]. It is called again when the
+// nonce leads to an invalid signature.
+func (g *nonceGenerator) next() *big.Int {
+	rolen := (g.q.BitLen() + 7) / 8
+	for {
+		var t []byte
+		for len(t) < rolen {
+			g.v = g.mac(g.v)
+			t = append(t, g.v...)
+		}
+
+		k := bits2int(t, g.q)
+		// the state moves on either way, so a rejected nonce is never
+		// returned twice
+		g.k = g.mac(g.v, []byte{0x00})
+		g.v = g.mac(g.v)
+		if k.Sign() > 0 && k.Cmp(g.q) < 0 {
+			return k
+		}
+	}
+}
+
+func (g *nonceGenerator) mac(parts ...[]byte) []byte {
+	m := hmac.New(sha256.New, g.k)
+	for _, p := range parts {
+		m.Write(p)
+	}
+	return m.Sum(nil)
+}
+
+// bits2int keeps the leftmost bits of b, as many as q has.
+func bits2int(b []byte, q *big.Int) *big.Int {
+	v := new(big.Int).SetBytes(b)
+	if excess := len(b)*8 - q.BitLen(); excess > 0 {
+		v.Rsh(v, uint(excess))
+	}
+	return v
+}
+
+func bits2octets(b []byte, q *big.Int, rolen int) []byte {
+	z := bits2int(b, q)
+	if z.Cmp(q) >= 0 {
+		z.Sub(z, q)
+	}
+	return int2octets(z, rolen)
+}
+
+func int2octets(v *big.Int, rolen int) []byte {
+	out := make([]byte, rolen)
+	return v.FillBytes(out)
+}
@@ -11,31 +11,29 @@
 package main
 
 import (
-	"bytes"
-	"crypto/ecdsa"
-	"encoding/gob"
+	"flag"
 	"log"
-	"math/big"
 	"math/rand"
+	"os"
 	"strconv"
 	"time"
 
 	"github.com/JoaoRafa19/crypto-go/core"
 	"github.com/JoaoRafa19/crypto-go/crypto"
 	"github.com/JoaoRafa19/crypto-go/network"
-	"github.com/JoaoRafa19/crypto-go/types"
 	"github.com/sirupsen/logrus"
 )
 
-func init() {
-	gob.Register(&big.Int{})
-	gob.Register(&ecdsa.PublicKey{})
-	gob.Register(&crypto.PublicKey{})
-	gob.Register(&crypto.Signature{})
-	gob.Register(&types.Hash{})
-}
-
 func main() {
+	keystore := flag.String("keystore", "validator.json", "keystore file of the validator key, created when missing")
+	flag.Parse()
+	// the passphrase is read from the environment to keep it out of the
+	// process list
+	passphrase := os.Getenv("KEYSTORE_PASSPHRASE")
+	if err := ensureKeystore(*keystore, passphrase); err != nil {
+		log.Fatal(err)
+	}
+
 	trLocal := network.NewLocalTransport("LOCAL")
 	trRemote := network.NewLocalTransport("REMOTE") // 24.123.123
 
@@ -51,14 +49,13 @@ func main() {
 			time.Sleep(time.Second * 2)
 		}
 	}()
-	privKey := crypto.GeneratePrivateKey()
-
 	opts := network.ServerOpts{
 		Transports: []network.Transport{
 			trLocal,
 		},
-		PrivateKey: &privKey,
-		ID:         "LOCAL",
+		KeystoreFile:       *keystore,
+		KeystorePassphrase: passphrase,
+		ID:                 "LOCAL",
 	}
 
 	s, err := network.NewServer(opts)
@@ -68,19 +65,23 @@ func main() {
 	s.Start()
 }
 
+// ensureKeystore writes a new validator key to path when there is none, so
+// the node keeps its identity across restarts.
+func ensureKeystore(path, passphrase string) error {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return err
+	}
+	return crypto.WriteKeyFile(path, crypto.GeneratePrivateKey(), passphrase, crypto.StandardScrypt)
+}
+
 func sendTransaction(tr network.Transport, to network.NetAddr) error {
 	privKey := crypto.GeneratePrivateKey()
 
 	data := []byte(strconv.FormatInt(int64(rand.Intn(10000000000000)), 10))
 	tx := core.NewTransaction(data)
 	tx.Sign(privKey)
-	buf := &bytes.Buffer{}
-
-	if err := tx.Encode(core.NewGobEncoder(buf)); err != nil {
-		return err
-	}
 
-	msg := network.NewMessage(network.MessageTypeTx, buf.Bytes())
+	msg := network.NewMessage(network.MessageTypeTx, core.MarshalTransaction(tx))
 	return tr.SendMessage(to, msg.Bytes())
 
 }
@@ -0,0 +1,722 @@
+/***************************************************************
+ * Arquivo: bft.go
+ * Descrição: Consenso tolerante a falhas bizantinas com rodadas de
+ *            proposta, prevote e precommit.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: Segue o Tendermint. Um bloco é confirmado com os
+ * precommits de mais de dois terços dos validadores, que formam o
+ * certificado guardado com o bloco. Rodadas sem acordo expiram e o
+ * próximo validador propõe.
+ ***************************************************************/
+
+package network
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/JoaoRafa19/crypto-go/core"
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+const (
+	defaultTimeoutPropose = 3 * time.Second
+	defaultTimeoutVote    = time.Second
+	defaultTimeoutDelta   = 500 * time.Millisecond
+	defaultTimeoutCommit  = time.Second
+
+	// maxConsensusEvents bounds the messages and timeouts waiting for the
+	// consensus, more are dropped
+	maxConsensusEvents = 4096
+	// maxFutureMessages bounds the messages kept for the next heights
+	maxFutureMessages = 1024
+)
+
+// roundEngine is a consensus engine that agrees on every block through
+// rounds of messages between the validators, instead of producing blocks on
+// the validator ticker.
+type roundEngine interface {
+	core.Engine
+	run(s *Server)
+	processMessage(from NetAddr, msg any) error
+}
+
+type BFTOpts struct {
+	// TimeoutPropose is how long the validators wait for the proposal of a
+	// round before prevoting for no block.
+	TimeoutPropose time.Duration
+	// TimeoutVote is how long the validators wait for agreement once more
+	// than two thirds of them voted in a step.
+	TimeoutVote time.Duration
+	// TimeoutDelta is added to the timeouts at every round, so the rounds
+	// get long enough for a slow network.
+	TimeoutDelta time.Duration
+	// TimeoutCommit is the pause after a commit before the next height
+	// starts, so the transactions of the next block can arrive.
+	TimeoutCommit time.Duration
+}
+
+type bftStep byte
+
+const (
+	stepNewHeight bftStep = iota
+	stepPropose
+	stepPrevote
+	stepPrecommit
+)
+
+// BFT is a byzantine fault tolerant consensus engine for the validators of
+// the genesis block and those they vote in. Each height runs rounds in which
+// the proposer of the round, picked in turn, proposes a block, and the
+// validators prevote and then precommit it. A block is committed with the
+// precommits of more than two thirds of the validators in one round, which
+// keeps the chain safe with less than a third of faulty validators. The
+// precommits are kept in the block as its certificate, so any node can
+// check that a block it receives is final.
+//
+// A BFT keeps the state of the rounds of one node, every server needs its
+// own.
+type BFT struct {
+	BFTOpts
+	server *Server
+	events chan any
+	// tip is signaled when the chain gets a new tip
+	tip chan struct{}
+
+	// lock guards height, round and validators, which Prepare reads
+	lock       sync.Mutex
+	height     uint32
+	round      uint32
+	validators []types.Address
+
+	// the state below is only used by the consensus loop
+	step       bftStep
+	proposals  map[uint32]*core.Proposal
+	checked    map[types.Hash]error
+	prevotes   map[uint32]*voteSet
+	precommits map[uint32]*voteSet
+	// the block this node precommitted, which it only prevotes from then
+	// on, and the last block that got a quorum of prevotes
+	lockedRound int32
+	lockedBlock *core.Block
+	validRound  int32
+	validBlock  *core.Block
+	// rules of the round that only apply once
+	prevoteWait   bool
+	precommitWait bool
+	polka         bool
+	future        []any
+}
+
+// bftTimeout fires when a step of a round took too long.
+type bftTimeout struct {
+	step   bftStep
+	height uint32
+	round  uint32
+}
+
+func NewBFT(opts BFTOpts) *BFT {
+	if opts.TimeoutPropose == 0 {
+		opts.TimeoutPropose = defaultTimeoutPropose
+	}
+	if opts.TimeoutVote == 0 {
+		opts.TimeoutVote = defaultTimeoutVote
+	}
+	if opts.TimeoutDelta == 0 {
+		opts.TimeoutDelta = defaultTimeoutDelta
+	}
+	if opts.TimeoutCommit == 0 {
+		opts.TimeoutCommit = defaultTimeoutCommit
+	}
+
+	return &BFT{
+		BFTOpts: opts,
+		events:  make(chan any, maxConsensusEvents),
+		tip:     make(chan struct{}, 1),
+	}
+}
+
+// Prepare checks that validator is the proposer of the current round.
+func (e *BFT) Prepare(chain *core.BlockChain, header *core.Header, validator types.Address) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if header.Height != e.height || e.server == nil {
+		return fmt.Errorf("%w: block (%d) is not being agreed on", core.ErrNotProposer, header.Height)
+	}
+	if proposer := e.proposer(e.round); proposer != validator {
+		return fmt.Errorf("%w: %s proposes the block (%d) in round (%d)", core.ErrNotProposer, proposer, e.height, e.round)
+	}
+	return nil
+}
+
+func (e *BFT) Seal(chain *core.BlockChain, b *core.Block, key crypto.PrivateKey) error {
+	return b.Sign(key)
+}
+
+func (e *BFT) VerifyHeader(chain *core.BlockChain, header, parent *core.Header) error {
+	return nil
+}
+
+// VerifySeal checks that the block was produced by a validator and carries
+// the precommits of more than two thirds of the validators.
+func (e *BFT) VerifySeal(state core.EngineState, b *core.Block) error {
+	if b.Height == 0 {
+		return nil
+	}
+	if b.Validator.IsZero() || !state.IsValidator(b.Validator.Address()) {
+		return fmt.Errorf("block (%s) was not produced by a validator", b.Hash(core.BlockHasher{}))
+	}
+	if b.Certificate == nil {
+		return fmt.Errorf("block (%s) has no commit certificate", b.Hash(core.BlockHasher{}))
+	}
+	return b.Certificate.Verify(b, state.Validators())
+}
+
+func (e *BFT) Finalize(state core.EngineState, b *core.Block) error {
+	return nil
+}
+
+// processMessage hands a proposal or a vote to the consensus loop.
+func (e *BFT) processMessage(from NetAddr, msg any) error {
+	select {
+	case e.events <- msg:
+		return nil
+	default:
+		return fmt.Errorf("consensus is busy, dropped %T from %s", msg, from)
+	}
+}
+
+// run is the consensus loop of the server. Every message, timeout and new
+// tip is handled here, one at a time.
+func (e *BFT) run(s *Server) {
+	e.lock.Lock()
+	e.server = s
+	e.lock.Unlock()
+
+	s.chain.Subscribe(func(core.ChainEvent) {
+		select {
+		case e.tip <- struct{}{}:
+		default:
+		}
+	})
+	e.enterHeight()
+
+	for {
+		select {
+		case ev := <-e.events:
+			e.handle(ev)
+		case <-e.tip:
+			e.enterHeight()
+		case <-s.QuitChan:
+			return
+		}
+	}
+}
+
+func (e *BFT) handle(ev any) {
+	var err error
+	switch ev := ev.(type) {
+	case *core.Proposal:
+		err = e.onProposal(ev)
+	case *core.Vote:
+		err = e.onVote(ev)
+	case bftTimeout:
+		e.onTimeout(ev)
+	}
+	if err != nil {
+		e.server.Logger.Log("msg", "invalid consensus message", "error", err)
+		return
+	}
+	e.advance()
+}
+
+// enterHeight starts agreeing on the block on top of the tip, once the
+// commit pause is over.
+func (e *BFT) enterHeight() {
+	height := e.server.chain.Height() + 1
+	if height <= e.height {
+		return
+	}
+
+	e.lock.Lock()
+	e.height = height
+	e.round = 0
+	e.validators = e.server.chain.State().Validators()
+	e.lock.Unlock()
+
+	e.step = stepNewHeight
+	e.proposals = make(map[uint32]*core.Proposal)
+	e.checked = make(map[types.Hash]error)
+	e.prevotes = make(map[uint32]*voteSet)
+	e.precommits = make(map[uint32]*voteSet)
+	e.lockedRound, e.lockedBlock = -1, nil
+	e.validRound, e.validBlock = -1, nil
+	e.resetRound()
+
+	e.schedule(stepNewHeight, 0, e.TimeoutCommit)
+
+	// the messages that arrived early are handled now
+	future := e.future
+	e.future = nil
+	for _, msg := range future {
+		e.handle(msg)
+	}
+}
+
+func (e *BFT) startRound(round uint32) {
+	e.lock.Lock()
+	e.round = round
+	e.lock.Unlock()
+
+	e.step = stepPropose
+	e.resetRound()
+
+	if e.isMember() && e.proposer(round) == e.self() {
+		if err := e.propose(); err != nil {
+			e.server.Logger.Log("msg", "cannot propose", "height", e.height, "round", round, "error", err)
+		}
+	}
+	e.schedule(stepPropose, round, e.TimeoutPropose)
+}
+
+func (e *BFT) resetRound() {
+	e.prevoteWait = false
+	e.precommitWait = false
+	e.polka = false
+}
+
+// propose puts the last block that got a quorum of prevotes to the vote
+// again, or a new block.
+func (e *BFT) propose() error {
+	p := &core.Proposal{Round: e.round, POLRound: e.validRound, Block: e.validBlock}
+	if p.Block == nil {
+		block, err := e.server.buildBlock()
+		if err != nil {
+			return err
+		}
+		p.Block = block
+	}
+	if err := p.Sign(*e.server.PrivateKey); err != nil {
+		return err
+	}
+
+	if err := e.onProposal(p); err != nil {
+		return err
+	}
+	msg := NewMessage(MessageTypeProposal, core.MarshalProposal(p))
+	go e.server.broadcast(msg.Bytes())
+	return nil
+}
+
+func (e *BFT) onProposal(p *core.Proposal) error {
+	if e.deferred(p.Block.Height, p) {
+		return nil
+	}
+	if _, ok := e.proposals[p.Round]; ok {
+		return nil
+	}
+
+	if proposer := e.proposer(p.Round); p.Validator.Address() != proposer {
+		return fmt.Errorf("proposal for block (%d) round (%d) from %s, expected %s", e.height, p.Round, p.Validator.Address(), proposer)
+	}
+	if err := p.Verify(); err != nil {
+		return err
+	}
+
+	e.proposals[p.Round] = p
+	return nil
+}
+
+func (e *BFT) onVote(v *core.Vote) error {
+	if e.deferred(v.Height, v) {
+		return nil
+	}
+
+	addr := v.Validator.Address()
+	if !e.isValidator(addr) {
+		return fmt.Errorf("%s from %s, which is not a validator", v.Type, addr)
+	}
+	if err := v.Verify(); err != nil {
+		return err
+	}
+
+	sets := e.prevotes
+	if v.Type == core.VotePrecommit {
+		sets = e.precommits
+	}
+	set, ok := sets[v.Round]
+	if !ok {
+		set = newVoteSet()
+		sets[v.Round] = set
+	}
+	if !set.add(v) {
+		return fmt.Errorf("%s voted twice in round (%d) of block (%d)", addr, v.Round, v.Height)
+	}
+	return nil
+}
+
+// deferred keeps the messages for the next heights, and drops those for past
+// ones. It tells whether the message is not for the current height.
+func (e *BFT) deferred(height uint32, msg any) bool {
+	if height == e.height {
+		return false
+	}
+	if height > e.height && len(e.future) < maxFutureMessages {
+		e.future = append(e.future, msg)
+	}
+	return true
+}
+
+func (e *BFT) onTimeout(t bftTimeout) {
+	if t.height != e.height || t.round != e.round {
+		return
+	}
+
+	switch {
+	case t.step == stepNewHeight && e.step == stepNewHeight:
+		e.startRound(0)
+	case t.step == stepPropose && e.step == stepPropose:
+		e.vote(core.VotePrevote, types.Hash{})
+		e.step = stepPrevote
+	case t.step == stepPrevote && e.step == stepPrevote:
+		e.vote(core.VotePrecommit, types.Hash{})
+		e.step = stepPrecommit
+	case t.step == stepPrecommit:
+		e.startRound(e.round + 1)
+	}
+}
+
+// advance applies the rules of the consensus until none applies anymore.
+func (e *BFT) advance() {
+	for e.step != stepNewHeight && e.apply() {
+	}
+}
+
+// apply applies the first rule that matches the messages of the current
+// height, and tells whether one did.
+func (e *BFT) apply() bool {
+	round := e.round
+	proposal := e.proposals[round]
+	prevotes := e.votes(e.prevotes, round)
+	precommits := e.votes(e.precommits, round)
+	n := len(e.validators)
+
+	// a block with the precommits of a quorum in any round is committed
+	for r, set := range e.precommits {
+		hash, ok := set.quorum(n)
+		if !ok || hash.IsZero() {
+			continue
+		}
+		if b := e.proposedBlock(hash); b != nil {
+			e.commit(b, r)
+			return true
+		}
+	}
+
+	// more than a third of the validators already moved to a later round
+	for r := range e.votedRounds() {
+		if r > round && e.roundVoters(r)*3 > n {
+			e.startRound(r)
+			return true
+		}
+	}
+
+	if e.step == stepPropose && proposal != nil {
+		hash := proposal.Block.Hash(core.BlockHasher{})
+		valid := e.check(proposal.Block) == nil
+		switch {
+		case proposal.POLRound < 0:
+			e.prevote(hash, valid && (e.lockedRound < 0 || e.isLocked(hash)))
+			return true
+		case e.polkaFor(proposal.POLRound, hash):
+			e.prevote(hash, valid && (e.lockedRound <= proposal.POLRound || e.isLocked(hash)))
+			return true
+		}
+	}
+
+	if e.step == stepPrevote && !e.prevoteWait && core.HasQuorum(prevotes.total(), n) {
+		e.prevoteWait = true
+		e.schedule(stepPrevote, round, e.TimeoutVote)
+		return true
+	}
+
+	if e.step >= stepPrevote && !e.polka && proposal != nil {
+		hash := proposal.Block.Hash(core.BlockHasher{})
+		if e.polkaFor(int32(round), hash) && e.check(proposal.Block) == nil {
+			e.polka = true
+			if e.step == stepPrevote {
+				e.lockedRound, e.lockedBlock = int32(round), proposal.Block
+				e.vote(core.VotePrecommit, hash)
+				e.step = stepPrecommit
+			}
+			e.validRound, e.validBlock = int32(round), proposal.Block
+			return true
+		}
+	}
+
+	if e.step == stepPrevote {
+		if hash, ok := prevotes.quorum(n); ok && hash.IsZero() {
+			e.vote(core.VotePrecommit, types.Hash{})
+			e.step = stepPrecommit
+			return true
+		}
+	}
+
+	if !e.precommitWait && core.HasQuorum(precommits.total(), n) {
+		e.precommitWait = true
+		e.schedule(stepPrecommit, round, e.TimeoutVote)
+		return true
+	}
+
+	return false
+}
+
+// prevote prevotes the block of hash when ok, for no block otherwise.
+func (e *BFT) prevote(hash types.Hash, ok bool) {
+	if !ok {
+		hash = types.Hash{}
+	}
+	e.vote(core.VotePrevote, hash)
+	e.step = stepPrevote
+}
+
+// vote casts the vote of this node, when it is a validator.
+func (e *BFT) vote(t core.VoteType, hash types.Hash) {
+	if !e.isMember() {
+		return
+	}
+
+	v := &core.Vote{Type: t, Height: e.height, Round: e.round, BlockHash: hash}
+	if err := v.Sign(*e.server.PrivateKey); err != nil {
+		e.server.Logger.Log("msg", "cannot sign vote", "error", err)
+		return
+	}
+	if err := e.onVote(v); err != nil {
+		e.server.Logger.Log("msg", "cannot count vote", "error", err)
+		return
+	}
+
+	msg := NewMessage(MessageTypeVote, core.MarshalVote(v))
+	go e.server.broadcast(msg.Bytes())
+}
+
+// commit adds the block with the certificate of the precommits of round to
+// the chain and moves to the next height.
+func (e *BFT) commit(b *core.Block, round uint32) {
+	committed := *b
+	committed.Certificate = core.NewCommitCertificate(b, round, e.precommits[round].list())
+
+	if err := e.server.chain.AddBlock(&committed); err != nil {
+		e.server.Logger.Log("msg", "cannot commit block", "height", e.height, "error", err)
+	} else {
+		e.server.Logger.Log("msg", "committed block", "height", e.height, "round", round, "hash", committed.Hash(core.BlockHasher{}))
+		go e.server.broadcastBlock(&committed)
+	}
+
+	// the block may have been committed through another node already
+	if e.server.chain.Height() >= e.height {
+		e.enterHeight()
+		return
+	}
+	// the block was rejected here, the node waits for the chain to get the
+	// committed block from its peers
+	e.step = stepNewHeight
+}
+
+// check validates a proposed block on top of the tip, everything but the
+// certificate it does not have yet.
+func (e *BFT) check(b *core.Block) error {
+	hash := b.Hash(core.BlockHasher{})
+	if err, ok := e.checked[hash]; ok {
+		return err
+	}
+
+	err := e.checkBlock(b)
+	e.checked[hash] = err
+	if err != nil {
+		e.server.Logger.Log("msg", "invalid proposed block", "hash", hash, "error", err)
+	}
+	return err
+}
+
+func (e *BFT) checkBlock(b *core.Block) error {
+	chain := e.server.chain
+	if b.Height != e.height {
+		return fmt.Errorf("block height (%d) is not the agreed height (%d)", b.Height, e.height)
+	}
+	if err := chain.Validator.ValidateBlock(b); err != nil {
+		return err
+	}
+	if b.Validator.IsZero() || !e.isValidator(b.Validator.Address()) {
+		return fmt.Errorf("block (%s) was not produced by a validator", b.Hash(core.BlockHasher{}))
+	}
+
+	for i := range b.Transactions {
+		txHash := b.Transactions[i].Hash(core.TxHasher{})
+		if _, _, err := chain.GetTransaction(txHash); err == nil {
+			return fmt.Errorf("transaction (%s) is already in the chain", txHash)
+		}
+	}
+
+	state := chain.State()
+	for i := range b.Transactions {
+		if err := state.ApplyTransaction(&b.Transactions[i], b.Height, b.Validator.Address()); err != nil {
+			return err
+		}
+	}
+	if err := state.Finalize(e, b); err != nil {
+		return err
+	}
+	if root := state.Root(); root != b.StateRoot {
+		return fmt.Errorf("block (%s) has state root (%s), expected (%s)", b.Hash(core.BlockHasher{}), b.StateRoot, root)
+	}
+	return nil
+}
+
+// schedule fires the timeout of step in round of the current height, longer
+// at every round.
+func (e *BFT) schedule(step bftStep, round uint32, timeout time.Duration) {
+	if step != stepNewHeight {
+		timeout += time.Duration(round) * e.TimeoutDelta
+	}
+	t := bftTimeout{step: step, height: e.height, round: round}
+	quit := e.server.QuitChan
+	time.AfterFunc(timeout, func() {
+		select {
+		case e.events <- t:
+		case <-quit:
+		}
+	})
+}
+
+// proposer picks the validators in turn, by height and round.
+func (e *BFT) proposer(round uint32) types.Address {
+	if len(e.validators) == 0 {
+		return types.Address{}
+	}
+	return e.validators[(int(e.height)+int(round))%len(e.validators)]
+}
+
+func (e *BFT) self() types.Address {
+	return e.server.PrivateKey.PublicKey().Address()
+}
+
+func (e *BFT) isMember() bool {
+	return e.server.PrivateKey != nil && e.isValidator(e.self())
+}
+
+func (e *BFT) isValidator(addr types.Address) bool {
+	for _, v := range e.validators {
+		if v == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *BFT) isLocked(hash types.Hash) bool {
+	return e.lockedBlock != nil && e.lockedBlock.Hash(core.BlockHasher{}) == hash
+}
+
+// polkaFor tells whether a quorum prevoted the block of hash in round.
+func (e *BFT) polkaFor(round int32, hash types.Hash) bool {
+	if round < 0 {
+		return false
+	}
+	h, ok := e.votes(e.prevotes, uint32(round)).quorum(len(e.validators))
+	return ok && h == hash
+}
+
+// proposedBlock returns the block of hash proposed in any round.
+func (e *BFT) proposedBlock(hash types.Hash) *core.Block {
+	for _, p := range e.proposals {
+		if p.Block.Hash(core.BlockHasher{}) == hash {
+			return p.Block
+		}
+	}
+	return nil
+}
+
+func (e *BFT) votes(sets map[uint32]*voteSet, round uint32) *voteSet {
+	if set, ok := sets[round]; ok {
+		return set
+	}
+	return newVoteSet()
+}
+
+func (e *BFT) votedRounds() map[uint32]bool {
+	rounds := make(map[uint32]bool)
+	for r := range e.prevotes {
+		rounds[r] = true
+	}
+	for r := range e.precommits {
+		rounds[r] = true
+	}
+	return rounds
+}
+
+// roundVoters counts the validators that voted in round.
+func (e *BFT) roundVoters(round uint32) int {
+	voters := make(map[types.Address]bool)
+	for addr := range e.votes(e.prevotes, round).byValidator {
+		voters[addr] = true
+	}
+	for addr := range e.votes(e.precommits, round).byValidator {
+		voters[addr] = true
+	}
+	return len(voters)
+}
+
+// voteSet holds the votes of one type in one round, a single vote per
+// validator.
+type voteSet struct {
+	byValidator map[types.Address]*core.Vote
+	count       map[types.Hash]int
+}
+
+func newVoteSet() *voteSet {
+	return &voteSet{
+		byValidator: make(map[types.Address]*core.Vote),
+		count:       make(map[types.Hash]int),
+	}
+}
+
+// add counts the vote, false when its validator already voted. A second
+// vote for another block is an equivocation and is not counted.
+func (vs *voteSet) add(v *core.Vote) bool {
+	addr := v.Validator.Address()
+	if _, ok := vs.byValidator[addr]; ok {
+		return false
+	}
+	vs.byValidator[addr] = v
+	vs.count[v.BlockHash]++
+	return true
+}
+
+func (vs *voteSet) total() int {
+	return len(vs.byValidator)
+}
+
+// quorum returns the hash voted by more than two thirds of the validators.
+func (vs *voteSet) quorum(validators int) (types.Hash, bool) {
+	for hash, count := range vs.count {
+		if core.HasQuorum(count, validators) {
+			return hash, true
+		}
+	}
+	return types.Hash{}, false
+}
+
+func (vs *voteSet) list() []*core.Vote {
+	votes := make([]*core.Vote, 0, len(vs.byValidator))
+	for _, v := range vs.byValidator {
+		votes = append(votes, v)
+	}
+	return votes
+}
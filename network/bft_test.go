@@ -0,0 +1,227 @@
+package network
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/JoaoRafa19/crypto-go/core"
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// bftNetwork is a set of validators, each with its own local transport
+// connected to all the others.
+type bftNetwork struct {
+	keys       []crypto.PrivateKey
+	validators []types.Address
+	transports []Transport
+}
+
+func newBFTNetwork(n int) *bftNetwork {
+	net := &bftNetwork{keys: make([]crypto.PrivateKey, n)}
+	for i := range net.keys {
+		net.keys[i] = crypto.GeneratePrivateKey()
+	}
+	// sorted by address, the order in which they propose
+	sort.Slice(net.keys, func(i, j int) bool {
+		a, b := net.keys[i].PublicKey().Address(), net.keys[j].PublicKey().Address()
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+
+	for i, key := range net.keys {
+		net.validators = append(net.validators, key.PublicKey().Address())
+		net.transports = append(net.transports, NewLocalTransport(NetAddr(fmt.Sprintf("V%d", i))))
+	}
+	for _, a := range net.transports {
+		for _, b := range net.transports {
+			if a != b {
+				a.Connect(b)
+			}
+		}
+	}
+	return net
+}
+
+// start runs an honest validator for every key but those of the faulty
+// indexes.
+func (net *bftNetwork) start(t *testing.T, faulty ...int) []*Server {
+	skip := make(map[int]bool)
+	for _, i := range faulty {
+		skip[i] = true
+	}
+
+	servers := []*Server{}
+	for i := range net.keys {
+		if skip[i] {
+			continue
+		}
+		servers = append(servers, newTestServer(t, ServerOpts{
+			ID:                fmt.Sprintf("V%d", i),
+			Transports:        []Transport{net.transports[i]},
+			PrivateKey:        &net.keys[i],
+			BlockTime:         time.Hour,
+			GenesisValidators: net.validators,
+			Engine:            newTestBFT(),
+		}))
+	}
+	return servers
+}
+
+func newTestBFT() *BFT {
+	return NewBFT(BFTOpts{
+		TimeoutPropose: 150 * time.Millisecond,
+		TimeoutVote:    50 * time.Millisecond,
+		TimeoutDelta:   50 * time.Millisecond,
+		TimeoutCommit:  10 * time.Millisecond,
+	})
+}
+
+// assertCommitted waits for every server to reach height and checks that
+// they all committed the same blocks, each with a valid certificate.
+func assertCommitted(t *testing.T, servers []*Server, validators []types.Address, height uint32) {
+	assert.Eventually(t, func() bool {
+		for _, s := range servers {
+			if s.chain.Height() < height {
+				return false
+			}
+		}
+		return true
+	}, 10*time.Second, 10*time.Millisecond)
+
+	for h := uint32(1); h <= height; h++ {
+		b, err := servers[0].chain.GetBlock(h)
+		assert.Nil(t, err)
+		assert.NotNil(t, b.Certificate)
+		assert.Nil(t, b.Certificate.Verify(b, validators))
+
+		for _, s := range servers[1:] {
+			other, err := s.chain.GetBlock(h)
+			assert.Nil(t, err)
+			assert.Equal(t, b.Hash(core.BlockHasher{}), other.Hash(core.BlockHasher{}))
+		}
+	}
+}
+
+func TestBFTCommitsBlocks(t *testing.T) {
+	net := newBFTNetwork(4)
+	servers := net.start(t)
+
+	// a node outside the validator set follows the committed blocks
+	trF := NewLocalTransport("F")
+	for _, tr := range net.transports {
+		tr.Connect(trF)
+		trF.Connect(tr)
+	}
+	follower := newTestServer(t, ServerOpts{
+		Transports:        []Transport{trF},
+		GenesisValidators: net.validators,
+		Engine:            newTestBFT(),
+	})
+
+	assertCommitted(t, append(servers, follower), net.validators, 4)
+}
+
+func TestBFTToleratesCrashedValidator(t *testing.T) {
+	net := newBFTNetwork(4)
+	servers := net.start(t, 2)
+
+	// the rounds of the crashed proposer time out and the next validator
+	// proposes
+	assertCommitted(t, servers, net.validators, 4)
+	changed := false
+	for h := uint32(1); h <= 4; h++ {
+		b, err := servers[0].chain.GetBlock(h)
+		assert.Nil(t, err)
+		assert.NotEqual(t, net.validators[2], b.Validator.Address())
+		changed = changed || b.Certificate.Round > 0
+	}
+	assert.True(t, changed)
+}
+
+func TestBFTToleratesEquivocatingValidator(t *testing.T) {
+	net := newBFTNetwork(4)
+	servers := net.start(t, 3)
+
+	// the faulty validator votes for made up blocks and proposes invalid
+	// blocks in every round
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		key := net.keys[3]
+		tr := net.transports[3]
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+
+		for n := 0; ; n++ {
+			select {
+			case <-ticker.C:
+			case <-quit:
+				return
+			}
+			height := servers[0].chain.Height() + 1
+			for round := uint32(0); round < 4; round++ {
+				for _, vt := range []core.VoteType{core.VotePrevote, core.VotePrecommit} {
+					v := &core.Vote{Type: vt, Height: height, Round: round, BlockHash: types.Hash(sha256.Sum256([]byte(fmt.Sprint(n, round))))}
+					assert.Nil(t, v.Sign(key))
+					tr.Broadcast(NewMessage(MessageTypeVote, core.MarshalVote(v)).Bytes())
+				}
+
+				tip, err := servers[0].chain.GetHeader(height - 1)
+				assert.Nil(t, err)
+				b, err := core.NewBlockFromHeader(tip, nil)
+				assert.Nil(t, err)
+				b.StateRoot = types.Hash(sha256.Sum256([]byte("invalid")))
+				assert.Nil(t, b.Sign(key))
+				p := &core.Proposal{Round: round, POLRound: -1, Block: b}
+				assert.Nil(t, p.Sign(key))
+				tr.Broadcast(NewMessage(MessageTypeProposal, core.MarshalProposal(p)).Bytes())
+			}
+		}
+	}()
+
+	assertCommitted(t, servers, net.validators, 4)
+	for h := uint32(1); h <= 4; h++ {
+		b, err := servers[0].chain.GetBlock(h)
+		assert.Nil(t, err)
+		assert.NotEqual(t, net.validators[3], b.Validator.Address())
+	}
+}
+
+func TestBFTHaltsWithoutQuorum(t *testing.T) {
+	net := newBFTNetwork(4)
+	servers := net.start(t, 2, 3)
+
+	// two of four validators are not more than two thirds, nothing can be
+	// committed, and blocks without certificate are not accepted
+	time.Sleep(500 * time.Millisecond)
+	for _, s := range servers {
+		assert.Equal(t, uint32(0), s.chain.Height())
+		assert.NotNil(t, s.CreateNewBlock())
+	}
+}
+
+func TestBFTRejectsBlocksWithoutCertificate(t *testing.T) {
+	net := newBFTNetwork(1)
+	s, err := NewServer(ServerOpts{BlockTime: time.Hour, GenesisValidators: net.validators, Engine: newTestBFT()})
+	assert.Nil(t, err)
+	defer close(s.QuitChan)
+
+	tip, err := s.chain.GetHeader(0)
+	assert.Nil(t, err)
+	b, err := core.NewBlockFromHeader(tip, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, b.Sign(net.keys[0]))
+	assert.NotNil(t, s.processBlock(b))
+
+	// a single validator is a quorum of its own
+	v := &core.Vote{Type: core.VotePrecommit, Height: 1, BlockHash: b.Hash(core.BlockHasher{})}
+	assert.Nil(t, v.Sign(net.keys[0]))
+	b.Certificate = core.NewCommitCertificate(b, 0, []*core.Vote{v})
+	assert.Nil(t, s.processBlock(b))
+	assert.Equal(t, uint32(1), s.chain.Height())
+}
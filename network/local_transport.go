@@ -36,10 +36,15 @@ func (t *LocalTransport) Consume() <-chan RPC {
 
 }
 func (t *LocalTransport) Connect(tr Transport) error {
+	peer, ok := tr.(*LocalTransport)
+	if !ok {
+		return fmt.Errorf("%s cannot connect to a %T", t.addr, tr)
+	}
+
 	t.Lock.Lock()
 	defer t.Lock.Unlock()
 
-	t.Peers[tr.Addr()] = tr.(*LocalTransport)
+	t.Peers[tr.Addr()] = peer
 
 	return nil
 }
@@ -66,7 +71,14 @@ func (t *LocalTransport) Addr() NetAddr {
 }
 
 func (t *LocalTransport) Broadcast(payload []byte) error {
+	t.Lock.RLock()
+	peers := make([]*LocalTransport, 0, len(t.Peers))
 	for _, peer := range t.Peers {
+		peers = append(peers, peer)
+	}
+	t.Lock.RUnlock()
+
+	for _, peer := range peers {
 		if err := t.SendMessage(peer.Addr(), payload); err != nil {
 			return err
 		}
@@ -0,0 +1,102 @@
+/***************************************************************
+ * Arquivo: orphans.go
+ * Descrição: Blocos recebidos antes do bloco pai.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações:
+ ***************************************************************/
+
+package network
+
+import (
+	"sync"
+
+	"github.com/JoaoRafa19/crypto-go/core"
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+const maxOrphanBlocks = 256
+
+// orphanPool keeps blocks whose parent is still unknown, indexed by the
+// parent hash. When full, the oldest orphan is dropped.
+type orphanPool struct {
+	lock     sync.Mutex
+	max      int
+	byParent map[types.Hash][]*core.Block
+	order    []*core.Block
+}
+
+func newOrphanPool(max int) *orphanPool {
+	return &orphanPool{
+		max:      max,
+		byParent: make(map[types.Hash][]*core.Block),
+	}
+}
+
+func (p *orphanPool) add(b *core.Block) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	hash := b.Hash(core.BlockHasher{})
+	for _, o := range p.byParent[b.PrevBlockHash] {
+		if o.Hash(core.BlockHasher{}) == hash {
+			return
+		}
+	}
+
+	if len(p.order) >= p.max {
+		p.remove(p.order[0])
+	}
+
+	p.byParent[b.PrevBlockHash] = append(p.byParent[b.PrevBlockHash], b)
+	p.order = append(p.order, b)
+}
+
+// take removes and returns the orphans waiting for the given parent.
+func (p *orphanPool) take(parent types.Hash) []*core.Block {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	children := p.byParent[parent]
+	delete(p.byParent, parent)
+
+	for _, b := range children {
+		for i, o := range p.order {
+			if o == b {
+				p.order = append(p.order[:i], p.order[i+1:]...)
+				break
+			}
+		}
+	}
+	return children
+}
+
+func (p *orphanPool) len() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.order)
+}
+
+func (p *orphanPool) remove(b *core.Block) {
+	siblings := p.byParent[b.PrevBlockHash]
+	for i, o := range siblings {
+		if o == b {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(p.byParent, b.PrevBlockHash)
+	} else {
+		p.byParent[b.PrevBlockHash] = siblings
+	}
+
+	for i, o := range p.order {
+		if o == b {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+}
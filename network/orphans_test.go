@@ -0,0 +1,54 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/JoaoRafa19/crypto-go/core"
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrphanPool(t *testing.T) {
+	p := newOrphanPool(2)
+	parent := types.Hash{1}
+
+	a := orphanBlock(parent, 1)
+	b := orphanBlock(parent, 2)
+	c := orphanBlock(types.Hash{2}, 3)
+
+	p.add(a)
+	p.add(a)
+	p.add(b)
+	assert.Equal(t, 2, p.len())
+
+	// the pool is full, the oldest orphan goes away
+	p.add(c)
+	assert.Equal(t, 2, p.len())
+	assert.Equal(t, []*core.Block{b}, p.take(parent))
+	assert.Equal(t, 1, p.len())
+	assert.Empty(t, p.take(parent))
+}
+
+func TestProcessMessage_OrphanBlock(t *testing.T) {
+	server, err := NewServer(ServerOpts{})
+	assert.Nil(t, err)
+
+	first := nextBlock(t, server)
+	second, err := core.NewBlockFromHeader(first.Header, nil)
+	assert.Nil(t, err)
+	key := crypto.GeneratePrivateKey()
+	assert.Nil(t, second.Sign(key))
+
+	assert.Nil(t, server.ProcessMessage(&DecodedMessage{Data: second}))
+	assert.Equal(t, uint32(0), server.chain.Height())
+
+	assert.Nil(t, server.ProcessMessage(&DecodedMessage{Data: first}))
+	assert.Equal(t, uint32(2), server.chain.Height())
+	assert.Equal(t, 0, server.orphans.len())
+}
+
+func orphanBlock(parent types.Hash, ts uint64) *core.Block {
+	b, _ := core.NewBlock(&core.Header{PrevBlockHash: parent, Timestamp: ts}, nil)
+	return b
+}
@@ -11,8 +11,7 @@
 package network
 
 import (
-	"bytes"
-	"encoding/gob"
+	"encoding/binary"
 	"fmt"
 	"io"
 
@@ -23,8 +22,13 @@ import (
 type MessageType byte
 
 const (
-	MessageTypeTx MessageType = 0x0
-	MessageTypeBlock
+	MessageTypeTx        MessageType = 0x0
+	MessageTypeBlock     MessageType = 0x1
+	MessageTypeStatus    MessageType = 0x2
+	MessageTypeGetBlocks MessageType = 0x3
+	MessageTypeBlocks    MessageType = 0x4
+	MessageTypeProposal  MessageType = 0x5
+	MessageTypeVote      MessageType = 0x6
 )
 
 type Message struct {
@@ -39,10 +43,31 @@ func NewMessage(t MessageType, data []byte) *Message {
 	}
 }
 
+// Bytes returns the canonical encoding of the message:
+// codec version | Header u8 | len(Data) u32 | Data.
 func (msg *Message) Bytes() []byte {
-	buf := &bytes.Buffer{}
-	gob.NewEncoder(buf).Encode(msg)
-	return buf.Bytes()
+	buf := make([]byte, 6+len(msg.Data))
+	buf[0] = core.CodecVersion
+	buf[1] = byte(msg.Header)
+	binary.BigEndian.PutUint32(buf[2:6], uint32(len(msg.Data)))
+	copy(buf[6:], msg.Data)
+	return buf
+}
+
+func MessageFromBytes(data []byte) (*Message, error) {
+	if len(data) < 6 {
+		return nil, fmt.Errorf("message too short (%d bytes)", len(data))
+	}
+	if data[0] != core.CodecVersion {
+		return nil, fmt.Errorf("unsupported codec version (%d)", data[0])
+	}
+
+	size := binary.BigEndian.Uint32(data[2:6])
+	if uint64(size) != uint64(len(data)-6) {
+		return nil, fmt.Errorf("message declares %d data bytes, has %d", size, len(data)-6)
+	}
+
+	return NewMessage(MessageType(data[1]), data[6:]), nil
 }
 
 type RPC struct {
@@ -58,8 +83,13 @@ type RPCDecodeFunc func(RPC) (*DecodedMessage, error)
 
 func DefaultRPCDecodeFunc(rpc RPC) (*DecodedMessage, error) {
 
-	msg := Message{}
-	if err := gob.NewDecoder(rpc.Payload).Decode(&msg); err != nil {
+	payload, err := io.ReadAll(rpc.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message from %s:%s", rpc.From, err)
+	}
+
+	msg, err := MessageFromBytes(payload)
+	if err != nil {
 		return nil, fmt.Errorf("failed to decode message from %s:%s", rpc.From, err)
 	}
 	logrus.WithFields(logrus.Fields{
@@ -69,11 +99,47 @@ func DefaultRPCDecodeFunc(rpc RPC) (*DecodedMessage, error) {
 	
 	switch msg.Header {
 	case MessageTypeTx:
-		tx := new(core.Transaction)
-		if err := tx.Decode(core.NewGobDecoder(bytes.NewReader(msg.Data))); err != nil {
+		tx, err := core.UnmarshalTransaction(msg.Data)
+		if err != nil {
 			return nil, err
 		}
 		return &DecodedMessage{From: rpc.From, Data: tx}, nil
+	case MessageTypeBlock:
+		b, err := core.UnmarshalBlock(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		return &DecodedMessage{From: rpc.From, Data: b}, nil
+	case MessageTypeStatus:
+		status, err := StatusMessageFromBytes(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		return &DecodedMessage{From: rpc.From, Data: status}, nil
+	case MessageTypeGetBlocks:
+		getBlocks, err := GetBlocksMessageFromBytes(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		return &DecodedMessage{From: rpc.From, Data: getBlocks}, nil
+	case MessageTypeBlocks:
+		blocks, err := BlocksMessageFromBytes(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		return &DecodedMessage{From: rpc.From, Data: blocks}, nil
+	case MessageTypeProposal:
+		proposal, err := core.UnmarshalProposal(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		return &DecodedMessage{From: rpc.From, Data: proposal}, nil
+	case MessageTypeVote:
+		vote, err := core.UnmarshalVote(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		return &DecodedMessage{From: rpc.From, Data: vote}, nil
 	default:
 		return nil, fmt.Errorf("invalid message header %d", msg.Header)
 	}
@@ -0,0 +1,38 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/JoaoRafa19/crypto-go/core"
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageBytes(t *testing.T) {
+	msg := NewMessage(MessageTypeTx, []byte("payload"))
+
+	assert.Equal(t, append([]byte{core.CodecVersion, 0x0, 0, 0, 0, 7}, []byte("payload")...), msg.Bytes())
+
+	decoded, err := MessageFromBytes(msg.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, msg, decoded)
+
+	_, err = MessageFromBytes(msg.Bytes()[:8])
+	assert.NotNil(t, err)
+}
+
+func TestDefaultRPCDecodeFuncTransaction(t *testing.T) {
+	tx := core.NewTransaction([]byte("foo"))
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+
+	msg := NewMessage(MessageTypeTx, core.MarshalTransaction(tx))
+	decoded, err := DefaultRPCDecodeFunc(RPC{From: "A", Payload: bytes.NewReader(msg.Bytes())})
+	assert.Nil(t, err)
+	assert.Equal(t, NetAddr("A"), decoded.From)
+
+	decodedTx, ok := decoded.Data.(*core.Transaction)
+	assert.True(t, ok)
+	assert.Nil(t, decodedTx.Verify())
+	assert.Equal(t, tx.Hash(core.TxHasher{}), decodedTx.Hash(core.TxHasher{}))
+}
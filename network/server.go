@@ -11,7 +11,7 @@
 package network
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -24,6 +24,15 @@ import (
 
 var defaultBlockTime = time.Duration(time.Second * 5)
 
+const (
+	defaultMaxBlockTxs  = 1024
+	defaultMaxBlockSize = 1024 * 1024
+)
+
+// genesisTimestamp is fixed so every node, and every restart of a node,
+// agrees on the same genesis block.
+const genesisTimestamp uint64 = 1704067200000000000
+
 type ServerOpts struct {
 	ID     string
 	Logger log.Logger
@@ -34,7 +43,33 @@ type ServerOpts struct {
 	RPCProcessor  RPCProcessor
 	Transports    []Transport
 	PrivateKey    *crypto.PrivateKey
-	BlockTime     time.Duration
+	// KeystoreFile, when PrivateKey is nil, is a keystore file holding
+	// the validator key, decrypted with KeystorePassphrase.
+	KeystoreFile       string
+	KeystorePassphrase string
+	BlockTime          time.Duration
+	// Storage persists the blocks of the chain. When nil the chain
+	// lives only in memory.
+	Storage core.Storage
+	// MaxBlockTxs and MaxBlockSize bound the blocks created by a
+	// validator, the size being the encoded size of the transactions.
+	MaxBlockTxs  int
+	MaxBlockSize int
+	// MemPoolOpts limits the pending transactions kept by the node.
+	MemPoolOpts TxPoolOpts
+	// GenesisAlloc are the balances minted by the genesis block. Every
+	// node of a network must use the same allocation.
+	GenesisAlloc map[types.Address]uint64
+	// GenesisValidators makes the chain a proof-of-authority chain: only
+	// these validators, and those they later vote in, produce blocks, each
+	// in turn. When empty any node with a key may produce blocks.
+	GenesisValidators []types.Address
+	// Engine is the consensus algorithm of the chain, proof of authority
+	// when nil. Every node of a network must use the same engine.
+	Engine core.Engine
+	// ChainID identifies the network. Transactions signed for another
+	// chain are rejected.
+	ChainID uint32
 }
 
 type Server struct {
@@ -43,7 +78,12 @@ type Server struct {
 	IsValidator bool
 	RpcCh       chan RPC
 	chain       *core.BlockChain
-	QuitChan    chan struct{}
+	orphans     *orphanPool
+	syncer      *syncManager
+	// consensus runs the rounds of an engine that agrees on blocks through
+	// messages, nil when blocks are produced on the validator ticker
+	consensus roundEngine
+	QuitChan  chan struct{}
 }
 
 func NewServer(opts ServerOpts) (*Server, error) {
@@ -58,21 +98,48 @@ func NewServer(opts ServerOpts) (*Server, error) {
 		opts.Logger = log.NewLogfmtLogger(os.Stderr)
 		opts.Logger = log.With(opts.Logger, "ID", opts.ID)
 	}
-	chain, err := core.NewBlockChain(genesisBlock())
+	if opts.MaxBlockTxs == 0 {
+		opts.MaxBlockTxs = defaultMaxBlockTxs
+	}
+	if opts.MaxBlockSize == 0 {
+		opts.MaxBlockSize = defaultMaxBlockSize
+	}
+	if opts.Storage == nil {
+		opts.Storage = core.NewMemStore()
+	}
+	if opts.Engine == nil {
+		opts.Engine = core.ProofOfAuthority{}
+	}
+	if opts.PrivateKey == nil && opts.KeystoreFile != "" {
+		key, err := crypto.ReadKeyFile(opts.KeystoreFile, opts.KeystorePassphrase)
+		if err != nil {
+			return nil, err
+		}
+		opts.PrivateKey = &key
+	}
+	genesis, err := genesisBlock(opts.GenesisAlloc, opts.GenesisValidators)
 	if err != nil {
 		return nil, err
 	}
+	chain, err := core.NewBlockChainWithEngine(opts.Storage, genesis, opts.Engine)
+	if err != nil {
+		return nil, err
+	}
+	chain.SetChainID(opts.ChainID)
 
 	s := &Server{
 		ServerOpts:  opts,
-		MemPool:     NewTxPool(),
+		MemPool:     NewTxPoolWithOpts(opts.MemPoolOpts),
 		IsValidator: opts.PrivateKey != nil,
 		RpcCh:       make(chan RPC),
 		QuitChan:    make(chan struct{}),
 		chain:       chain,
+		orphans:     newOrphanPool(maxOrphanBlocks),
 	}
 
 	s.ServerOpts = opts
+	s.syncer = newSyncManager(s)
+	chain.Subscribe(s.onChainEvent)
 
 	// if RPCProcessor is not provided, use the server as the
 	// default RPC processor
@@ -81,7 +148,12 @@ func NewServer(opts ServerOpts) (*Server, error) {
 	}
 
 	if s.IsValidator {
-		go s.ValidatorLoop()
+		if engine, ok := opts.Engine.(roundEngine); ok {
+			s.consensus = engine
+			go engine.run(s)
+		} else {
+			go s.ValidatorLoop()
+		}
 	}
 	return s, nil
 }
@@ -89,6 +161,11 @@ func NewServer(opts ServerOpts) (*Server, error) {
 func (s *Server) Start() {
 	s.initTransports()
 
+	go s.syncer.loop(defaultStatusInterval)
+	if err := s.broadcastStatus(); err != nil {
+		s.Logger.Log("error", err)
+	}
+
 free:
 	for {
 		select {
@@ -116,9 +193,18 @@ func (s *Server) ValidatorLoop() {
 	ticker := time.NewTicker(s.BlockTime)
 	s.Logger.Log("msg", "Server starting validate", "block time: ", s.BlockTime)
 
+	defer ticker.Stop()
+
 	for {
-		<-ticker.C
-		s.CreateNewBlock()
+		select {
+		case <-ticker.C:
+			err := s.CreateNewBlock()
+			if err != nil && !errors.Is(err, core.ErrNotProposer) {
+				s.Logger.Log("error", err)
+			}
+		case <-s.QuitChan:
+			return
+		}
 	}
 }
 
@@ -127,6 +213,20 @@ func (s *Server) ProcessMessage(message *DecodedMessage) error {
 	switch msg := message.Data.(type) {
 	case *core.Transaction:
 		return s.processTransaction(msg)
+	case *core.Block:
+		return s.processBlock(msg)
+	case *StatusMessage:
+		return s.syncer.onStatus(message.From, msg)
+	case *GetBlocksMessage:
+		return s.processGetBlocks(message.From, msg)
+	case *BlocksMessage:
+		return s.syncer.onBlocks(message.From, msg)
+	case *core.Proposal, *core.Vote:
+		// nodes outside the consensus only follow the committed blocks
+		if s.consensus == nil {
+			return nil
+		}
+		return s.consensus.processMessage(message.From, msg)
 	default:
 		return fmt.Errorf("unknown message type: %T", msg)
 	}
@@ -148,11 +248,22 @@ func (s *Server) processTransaction(tx *core.Transaction) error {
 		return nil
 	}
 
+	if tx.Multisig != nil {
+		return s.stageTransaction(tx)
+	}
+
 	if err := tx.Verify(); err != nil {
 		return err
 	}
 
+	if err := s.checkReplay(tx); err != nil {
+		return err
+	}
+
 	tx.SetFirstSeen(time.Now().UnixNano())
+	if err := s.MemPool.Add(tx); err != nil {
+		return err
+	}
 
 	s.Logger.Log(
 		"msg", "add transaction to mempool",
@@ -162,17 +273,173 @@ func (s *Server) processTransaction(tx *core.Transaction) error {
 
 	go s.broadcastTx(tx)
 
-	return s.MemPool.Add(tx)
+	return nil
 }
 
-func (s *Server) broadcastTx(tx *core.Transaction) error {
-	buf := &bytes.Buffer{}
+// stageTransaction handles a multisig transaction, which may still lack
+// approvals. The pool merges its approvals with those of the copies it
+// received before, and the merged transaction is relayed so the approvals
+// of every signer end up together.
+func (s *Server) stageTransaction(tx *core.Transaction) error {
+	if err := s.checkReplay(tx); err != nil {
+		return err
+	}
 
-	if err := tx.Encode(core.NewGobEncoder(buf)); err != nil {
+	tx.SetFirstSeen(time.Now().UnixNano())
+	merged, err := s.MemPool.Stage(tx)
+	if err != nil || merged == nil {
 		return err
 	}
 
-	msg := NewMessage(MessageTypeTx, buf.Bytes())
+	s.Logger.Log(
+		"msg", "stage multisig transaction",
+		"hash", tx.Hash(core.TxHasher{}),
+		"approvals", len(merged.Approvals),
+		"threshold", merged.Multisig.Threshold,
+	)
+
+	go s.broadcastTx(merged)
+
+	return nil
+}
+
+// checkReplay rejects transactions signed for another chain and those that
+// the chain already contains or can never contain.
+func (s *Server) checkReplay(tx *core.Transaction) error {
+	hash := tx.Hash(core.TxHasher{})
+
+	if tx.ChainID != s.ChainID {
+		return fmt.Errorf("transaction (%s) is for chain (%d), not (%d)", hash, tx.ChainID, s.ChainID)
+	}
+
+	switch tx.Type {
+	case core.TxTypeMint:
+		return fmt.Errorf("mint transaction (%s) is only allowed in the genesis block", hash)
+	case core.TxTypeTransfer, core.TxTypeAddValidator, core.TxTypeRemoveValidator, core.TxTypeRegisterMultisig:
+		sender, _ := tx.Sender()
+		if nonce := s.chain.GetAccount(sender).Nonce; tx.Nonce < nonce {
+			return fmt.Errorf("transaction (%s) nonce (%d) was already used, account nonce is (%d)", hash, tx.Nonce, nonce)
+		}
+	}
+
+	if _, loc, err := s.chain.GetTransaction(hash); err == nil {
+		return fmt.Errorf("transaction (%s) was already included in block (%s)", hash, loc.BlockHash)
+	}
+	return nil
+}
+
+// processBlock adds a block received from a peer to the chain and, if it is
+// new to this node, relays it to the other peers. Blocks can arrive before
+// their parent, those are kept aside until the parent is added.
+func (s *Server) processBlock(b *core.Block) error {
+	hash := b.Hash(core.BlockHasher{})
+
+	if s.chain.HasBlockHash(hash) {
+		return nil
+	}
+
+	if !s.chain.HasBlockHash(b.PrevBlockHash) {
+		s.orphans.add(b)
+		return nil
+	}
+
+	if err := s.chain.AddBlock(b); err != nil {
+		return err
+	}
+
+	s.Logger.Log(
+		"msg", "received new block",
+		"hash", hash,
+		"height", b.Height,
+	)
+
+	go s.broadcastBlock(b)
+
+	for _, child := range s.orphans.take(hash) {
+		if err := s.processBlock(child); err != nil {
+			s.Logger.Log("error", err)
+		}
+	}
+
+	return nil
+}
+
+// processGetBlocks answers a peer with the canonical blocks it asked for.
+func (s *Server) processGetBlocks(from NetAddr, msg *GetBlocksMessage) error {
+	count := msg.Count
+	if count > maxGetBlocksBatchSize {
+		count = maxGetBlocksBatchSize
+	}
+
+	reply := &BlocksMessage{Blocks: []*core.Block{}}
+	if count > 0 && msg.From <= s.chain.Height() {
+		err := s.chain.Store.Range(msg.From, msg.From+count-1, func(b *core.Block) bool {
+			reply.Blocks = append(reply.Blocks, b)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.sendMessage(from, NewMessage(MessageTypeBlocks, reply.Bytes()))
+}
+
+func (s *Server) status() (*StatusMessage, error) {
+	genesis, err := s.chain.GetHeader(0)
+	if err != nil {
+		return nil, err
+	}
+	tip, err := s.chain.GetHeader(s.chain.Height())
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatusMessage{
+		GenesisHash: core.BlockHasher{}.Hash(genesis),
+		TipHash:     core.BlockHasher{}.Hash(tip),
+		Height:      tip.Height,
+	}, nil
+}
+
+func (s *Server) sendStatus(to NetAddr) error {
+	status, err := s.status()
+	if err != nil {
+		return err
+	}
+	return s.sendMessage(to, NewMessage(MessageTypeStatus, status.Bytes()))
+}
+
+func (s *Server) broadcastStatus() error {
+	status, err := s.status()
+	if err != nil {
+		return err
+	}
+	return s.broadcast(NewMessage(MessageTypeStatus, status.Bytes()).Bytes())
+}
+
+// sendMessage delivers a message to a single peer through the first
+// transport that knows it.
+func (s *Server) sendMessage(to NetAddr, msg *Message) error {
+	var err error
+	for _, tr := range s.Transports {
+		if err = tr.SendMessage(to, msg.Bytes()); err == nil {
+			return nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("no transport to reach %s", to)
+	}
+	return err
+}
+
+func (s *Server) broadcastBlock(b *core.Block) error {
+	msg := NewMessage(MessageTypeBlock, core.MarshalBlock(b))
+	return s.broadcast(msg.Bytes())
+}
+
+func (s *Server) broadcastTx(tx *core.Transaction) error {
+	msg := NewMessage(MessageTypeTx, core.MarshalTransaction(tx))
 	return s.broadcast(msg.Bytes())
 }
 
@@ -186,36 +453,135 @@ func (s *Server) initTransports() {
 		}(tr)
 	}
 }
+
+// CreateNewBlock produces a block on top of the tip with the pending
+// transactions, following the consensus engine, and broadcasts it.
 func (s *Server) CreateNewBlock() error {
-	currentHeader, err := s.chain.GetHeader(s.chain.Height())
+	block, err := s.buildBlock()
 	if err != nil {
 		return err
 	}
 
+	if err := s.chain.AddBlock(block); err != nil {
+		return err
+	}
+
+	go s.broadcastBlock(block)
+
+	return nil
+}
+
+// buildBlock prepares, fills and seals the next block with the consensus
+// engine, without adding it to the chain.
+func (s *Server) buildBlock() (*core.Block, error) {
+	currentHeader, err := s.chain.GetHeader(s.chain.Height())
+	if err != nil {
+		return nil, err
+	}
+
 	block, err := core.NewBlockFromHeader(currentHeader, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := s.Engine.Prepare(s.chain, block.Header, s.PrivateKey.PublicKey().Address()); err != nil {
+		return nil, err
 	}
 
-	if err := block.Sign(*s.PrivateKey); err != nil {
-		return err
+	txx, state := s.selectTransactions(block.Height)
+	if block.DataHash, err = core.CalculateDataHash(txx); err != nil {
+		return nil, err
 	}
+	block.Transactions = txx
+	// the engine may reward the producer when finalizing
+	block.Validator = s.PrivateKey.PublicKey()
 
-	if err := s.chain.AddBlock(block); err != nil {
-		return err
+	if err := state.Finalize(s.Engine, block); err != nil {
+		return nil, err
 	}
+	block.StateRoot = state.Root()
 
-	return nil
+	if err := s.Engine.Seal(s.chain, block, *s.PrivateKey); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// selectTransactions picks the pending transactions for the next block, the
+// highest fee first, within the block limits, and returns them along with
+// the state they lead to. The pool is walked until nothing else applies, so a
+// transfer waiting for an earlier nonce of the same sender still makes it
+// into the block. Transactions that do not fit or cannot be applied yet stay
+// in the pool for the next round.
+func (s *Server) selectTransactions(height uint32) ([]core.Transaction, *core.State) {
+	var (
+		txx       []core.Transaction
+		size      int
+		state     = s.chain.State()
+		validator = s.PrivateKey.PublicKey().Address()
+		pending   = s.MemPool.Transactions()
+	)
+
+	for progress := true; progress; {
+		progress = false
+		retry := pending[:0]
+		for _, tx := range pending {
+			if len(txx) >= s.MaxBlockTxs {
+				return txx, state
+			}
+
+			txSize := len(core.MarshalTransaction(tx))
+			if size+txSize > s.MaxBlockSize {
+				continue
+			}
+			if err := state.ApplyTransaction(tx, height, validator); err != nil {
+				retry = append(retry, tx)
+				continue
+			}
+
+			size += txSize
+			txx = append(txx, *tx)
+			progress = true
+		}
+		pending = retry
+	}
+
+	return txx, state
 }
 
-func genesisBlock() *core.Block {
-	header := &core.Header{
-		Version:   1,
-		DataHash:  types.Hash{},
-		Timestamp: uint64(time.Now().UnixNano()),
-		Height:    0,
+// onChainEvent keeps the mempool in line with the canonical chain: the
+// transactions included in new blocks leave the pool and those of reverted
+// blocks go back to it.
+func (s *Server) onChainEvent(ev core.ChainEvent) {
+	included := make(map[types.Hash]bool)
+	for _, b := range ev.Applied {
+		for i := range b.Transactions {
+			hash := b.Transactions[i].Hash(core.TxHasher{})
+			included[hash] = true
+			s.MemPool.Remove(hash)
+		}
+	}
+
+	now := time.Now().UnixNano()
+	for _, b := range ev.Reverted {
+		for i := range b.Transactions {
+			tx := b.Transactions[i]
+			if included[tx.Hash(core.TxHasher{})] {
+				continue
+			}
+			tx.SetFirstSeen(now)
+			if err := s.MemPool.Add(&tx); err != nil {
+				s.Logger.Log("error", err)
+			}
+		}
 	}
 
-	b, _ := core.NewBlock(header, nil)
-	return b
+	// transfers from the same senders with a nonce that was used by
+	// another transaction can no longer be included
+	s.MemPool.RemoveStale(func(addr types.Address) uint64 {
+		return s.chain.GetAccount(addr).Nonce
+	})
+}
+
+func genesisBlock(alloc map[types.Address]uint64, validators []types.Address) (*core.Block, error) {
+	return core.NewAuthorityGenesisBlock(genesisTimestamp, alloc, validators)
 }
@@ -1,10 +1,14 @@
 package network
 
 import (
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/JoaoRafa19/crypto-go/core"
 	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/go-kit/log"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,3 +29,404 @@ func TestProcessMessage_ValidTransaction(t *testing.T) {
 	assert.Equal(t, 1, server.MemPool.Len())
 	assert.True(t, server.MemPool.Contains(tx.Hash(core.TxHasher{})))
 }
+
+func TestProcessMessage_Block(t *testing.T) {
+	server, err := NewServer(ServerOpts{})
+	assert.Nil(t, err)
+
+	b := nextBlock(t, server)
+	msg := &DecodedMessage{From: "testAddr", Data: b}
+
+	assert.Nil(t, server.ProcessMessage(msg))
+	assert.Equal(t, uint32(1), server.chain.Height())
+
+	// a block the node already has is ignored
+	assert.Nil(t, server.ProcessMessage(msg))
+	assert.Equal(t, uint32(1), server.chain.Height())
+
+	invalid := nextBlock(t, server)
+	invalid.Signature = nil
+	assert.NotNil(t, server.ProcessMessage(&DecodedMessage{From: "testAddr", Data: invalid}))
+}
+
+func TestBlockPropagation(t *testing.T) {
+	trA := NewLocalTransport("A")
+	trB := NewLocalTransport("B")
+	trC := NewLocalTransport("C")
+
+	trA.Connect(trB)
+	trB.Connect(trA)
+	trB.Connect(trC)
+	trC.Connect(trB)
+
+	privKey := crypto.GeneratePrivateKey()
+	validator := newTestServer(t, ServerOpts{ID: "A", Transports: []Transport{trA}, PrivateKey: &privKey, BlockTime: time.Hour})
+	relay := newTestServer(t, ServerOpts{ID: "B", Transports: []Transport{trB}})
+	follower := newTestServer(t, ServerOpts{ID: "C", Transports: []Transport{trC}})
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, validator.CreateNewBlock())
+	}
+
+	assert.Eventually(t, func() bool {
+		return relay.chain.Height() == 3 && follower.chain.Height() == 3
+	}, 2*time.Second, 10*time.Millisecond)
+
+	tip, err := validator.chain.GetHeader(3)
+	assert.Nil(t, err)
+	followerTip, err := follower.chain.GetHeader(3)
+	assert.Nil(t, err)
+	assert.Equal(t, core.BlockHasher{}.Hash(tip), core.BlockHasher{}.Hash(followerTip))
+}
+
+func TestCreateNewBlockIncludesMempool(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	server, err := NewServer(ServerOpts{PrivateKey: &privKey, BlockTime: time.Hour, MaxBlockTxs: 2})
+	assert.Nil(t, err)
+	defer close(server.QuitChan)
+
+	txx := make([]*core.Transaction, 3)
+	for i := range txx {
+		txx[i] = core.NewTransaction([]byte{byte(i)})
+		assert.Nil(t, txx[i].Sign(crypto.GeneratePrivateKey()))
+		assert.Nil(t, server.ProcessMessage(&DecodedMessage{From: "testAddr", Data: txx[i]}))
+	}
+
+	assert.Nil(t, server.CreateNewBlock())
+	b, err := server.chain.GetBlock(1)
+	assert.Nil(t, err)
+	assert.Len(t, b.Transactions, 2)
+	assert.Equal(t, txx[0].Data, b.Transactions[0].Data)
+	assert.Equal(t, txx[1].Data, b.Transactions[1].Data)
+
+	// the leftover goes into the next block
+	assert.Equal(t, 1, server.MemPool.Len())
+	assert.True(t, server.MemPool.Contains(txx[2].Hash(core.TxHasher{})))
+
+	assert.Nil(t, server.CreateNewBlock())
+	b, err = server.chain.GetBlock(2)
+	assert.Nil(t, err)
+	assert.Len(t, b.Transactions, 1)
+	assert.Zero(t, server.MemPool.Len())
+}
+
+func TestCreateNewBlockMaxSize(t *testing.T) {
+	tx := core.NewTransaction([]byte("foo"))
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+
+	privKey := crypto.GeneratePrivateKey()
+	server, err := NewServer(ServerOpts{PrivateKey: &privKey, BlockTime: time.Hour, MaxBlockSize: len(core.MarshalTransaction(tx))})
+	assert.Nil(t, err)
+	defer close(server.QuitChan)
+
+	other := core.NewTransaction([]byte("bar"))
+	assert.Nil(t, other.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, server.ProcessMessage(&DecodedMessage{From: "testAddr", Data: tx}))
+	assert.Nil(t, server.ProcessMessage(&DecodedMessage{From: "testAddr", Data: other}))
+
+	assert.Nil(t, server.CreateNewBlock())
+	b, err := server.chain.GetBlock(1)
+	assert.Nil(t, err)
+	assert.Len(t, b.Transactions, 1)
+	assert.Equal(t, 1, server.MemPool.Len())
+}
+
+func TestReceivedBlockClearsMempool(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	validator, err := NewServer(ServerOpts{PrivateKey: &privKey, BlockTime: time.Hour})
+	assert.Nil(t, err)
+	defer close(validator.QuitChan)
+	follower, err := NewServer(ServerOpts{})
+	assert.Nil(t, err)
+
+	tx := core.NewTransaction([]byte("foo"))
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, validator.ProcessMessage(&DecodedMessage{From: "testAddr", Data: tx}))
+	assert.Nil(t, follower.ProcessMessage(&DecodedMessage{From: "testAddr", Data: tx}))
+
+	assert.Nil(t, validator.CreateNewBlock())
+	b, err := validator.chain.GetBlock(1)
+	assert.Nil(t, err)
+
+	assert.Nil(t, follower.ProcessMessage(&DecodedMessage{From: "validator", Data: b}))
+	assert.Zero(t, follower.MemPool.Len())
+}
+
+func TestReorgReturnsTransactionsToMempool(t *testing.T) {
+	server, err := NewServer(ServerOpts{})
+	assert.Nil(t, err)
+
+	genesis, err := server.chain.GetHeader(0)
+	assert.Nil(t, err)
+
+	tx := core.NewTransaction([]byte("foo"))
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+	withTx, err := core.NewBlockFromHeader(genesis, []core.Transaction{*tx})
+	assert.Nil(t, err)
+	assert.Nil(t, withTx.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, server.ProcessMessage(&DecodedMessage{From: "A", Data: withTx}))
+	assert.Zero(t, server.MemPool.Len())
+
+	// a longer branch without the transaction replaces the block
+	side, err := core.NewBlockFromHeader(genesis, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, side.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, server.ProcessMessage(&DecodedMessage{From: "B", Data: side}))
+	next, err := core.NewBlockFromHeader(side.Header, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, next.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, server.ProcessMessage(&DecodedMessage{From: "B", Data: next}))
+
+	assert.Equal(t, uint32(2), server.chain.Height())
+	assert.True(t, server.MemPool.Contains(tx.Hash(core.TxHasher{})))
+}
+
+func TestCreateNewBlockAppliesTransfers(t *testing.T) {
+	alice := crypto.GeneratePrivateKey()
+	bob := crypto.GeneratePrivateKey().PublicKey().Address()
+	privKey := crypto.GeneratePrivateKey()
+	server, err := NewServer(ServerOpts{
+		PrivateKey:   &privKey,
+		BlockTime:    time.Hour,
+		GenesisAlloc: map[types.Address]uint64{alice.PublicKey().Address(): 100},
+	})
+	assert.Nil(t, err)
+	defer close(server.QuitChan)
+
+	transfer := core.NewTransferTransaction(bob, 30, 0)
+	assert.Nil(t, transfer.Sign(alice))
+	gap := core.NewTransferTransaction(bob, 30, 2)
+	assert.Nil(t, gap.Sign(alice))
+	assert.Nil(t, server.ProcessMessage(&DecodedMessage{From: "testAddr", Data: transfer}))
+	assert.Nil(t, server.ProcessMessage(&DecodedMessage{From: "testAddr", Data: gap}))
+
+	assert.Nil(t, server.CreateNewBlock())
+	assert.Equal(t, core.Account{Balance: 70, Nonce: 1}, server.chain.GetAccount(alice.PublicKey().Address()))
+	assert.Equal(t, uint64(30), server.chain.GetAccount(bob).Balance)
+
+	// the transfer with a future nonce waits in the pool
+	assert.Equal(t, 1, server.MemPool.Len())
+	assert.True(t, server.MemPool.Contains(gap.Hash(core.TxHasher{})))
+}
+
+func TestCreateNewBlockCollectsFees(t *testing.T) {
+	alice := crypto.GeneratePrivateKey()
+	carol := crypto.GeneratePrivateKey()
+	bob := crypto.GeneratePrivateKey().PublicKey().Address()
+	privKey := crypto.GeneratePrivateKey()
+	server, err := NewServer(ServerOpts{
+		PrivateKey: &privKey,
+		BlockTime:  time.Hour,
+		GenesisAlloc: map[types.Address]uint64{
+			alice.PublicKey().Address(): 100,
+			carol.PublicKey().Address(): 100,
+		},
+	})
+	assert.Nil(t, err)
+	defer close(server.QuitChan)
+
+	transfer := func(key crypto.PrivateKey, nonce, fee uint64) *core.Transaction {
+		tx := core.NewTransferTransaction(bob, 10, nonce)
+		tx.Fee = fee
+		assert.Nil(t, tx.Sign(key))
+		assert.Nil(t, server.ProcessMessage(&DecodedMessage{From: "testAddr", Data: tx}))
+		return tx
+	}
+
+	// the second transfer of alice pays more than the first one but must
+	// follow it, carol pays the most and goes first
+	transfer(alice, 0, 1)
+	transfer(alice, 1, 5)
+	first := transfer(carol, 0, 10)
+
+	assert.Nil(t, server.CreateNewBlock())
+	block, err := server.chain.GetBlock(1)
+	assert.Nil(t, err)
+	assert.Len(t, block.Transactions, 3)
+	assert.Equal(t, first.Hash(core.TxHasher{}), block.Transactions[0].Hash(core.TxHasher{}))
+
+	assert.Equal(t, core.Account{Balance: 74, Nonce: 2}, server.chain.GetAccount(alice.PublicKey().Address()))
+	assert.Equal(t, core.Account{Balance: 80, Nonce: 1}, server.chain.GetAccount(carol.PublicKey().Address()))
+	assert.Equal(t, uint64(16), server.chain.GetAccount(privKey.PublicKey().Address()).Balance)
+	assert.Zero(t, server.MemPool.Len())
+}
+
+func TestProcessTransactionReplayProtection(t *testing.T) {
+	alice := crypto.GeneratePrivateKey()
+	bob := crypto.GeneratePrivateKey().PublicKey().Address()
+	privKey := crypto.GeneratePrivateKey()
+	server, err := NewServer(ServerOpts{
+		ChainID:      7,
+		PrivateKey:   &privKey,
+		BlockTime:    time.Hour,
+		GenesisAlloc: map[types.Address]uint64{alice.PublicKey().Address(): 100},
+	})
+	assert.Nil(t, err)
+	defer close(server.QuitChan)
+
+	process := func(tx *core.Transaction) error {
+		return server.ProcessMessage(&DecodedMessage{From: "testAddr", Data: tx})
+	}
+
+	foreign := core.NewTransaction([]byte("foo"))
+	assert.Nil(t, foreign.Sign(alice))
+	assert.NotNil(t, process(foreign))
+
+	transfer := core.NewTransferTransaction(bob, 10, 0)
+	transfer.ChainID = 7
+	assert.Nil(t, transfer.Sign(alice))
+	assert.Nil(t, process(transfer))
+
+	data := core.NewTransaction([]byte("foo"))
+	data.ChainID = 7
+	assert.Nil(t, data.Sign(alice))
+	assert.Nil(t, process(data))
+
+	assert.Nil(t, server.CreateNewBlock())
+	assert.Zero(t, server.MemPool.Len())
+
+	// both transactions are in the chain now, replaying them fails
+	assert.NotNil(t, process(transfer))
+	assert.NotNil(t, process(data))
+
+	stale := core.NewTransferTransaction(bob, 20, 0)
+	stale.ChainID = 7
+	assert.Nil(t, stale.Sign(alice))
+	assert.NotNil(t, process(stale))
+	assert.Zero(t, server.MemPool.Len())
+}
+
+func TestServerKeyFromKeystore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "validator.json")
+	key := crypto.GeneratePrivateKey()
+	assert.Nil(t, crypto.WriteKeyFile(path, key, "secret", crypto.LightScrypt))
+
+	server, err := NewServer(ServerOpts{KeystoreFile: path, KeystorePassphrase: "secret"})
+	assert.Nil(t, err)
+	defer close(server.QuitChan)
+	assert.True(t, server.IsValidator)
+	assert.Equal(t, key.PublicKey().Address(), server.PrivateKey.PublicKey().Address())
+
+	_, err = NewServer(ServerOpts{KeystoreFile: path, KeystorePassphrase: "wrong"})
+	assert.NotNil(t, err)
+}
+
+func TestAuthorityValidatorsTakeTurns(t *testing.T) {
+	keys := []crypto.PrivateKey{crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey()}
+	validators := []types.Address{keys[0].PublicKey().Address(), keys[1].PublicKey().Address()}
+
+	servers := make([]*Server, len(keys))
+	for i := range keys {
+		server, err := NewServer(ServerOpts{PrivateKey: &keys[i], BlockTime: time.Hour, GenesisValidators: validators})
+		assert.Nil(t, err)
+		defer close(server.QuitChan)
+		servers[i] = server
+	}
+
+	for height := uint32(1); height <= 4; height++ {
+		proposer, ok := servers[0].chain.NextProposer()
+		assert.True(t, ok)
+
+		turn := 0
+		if validators[1] == proposer {
+			turn = 1
+		}
+		assert.ErrorIs(t, servers[1-turn].CreateNewBlock(), core.ErrNotProposer)
+
+		assert.Nil(t, servers[turn].CreateNewBlock())
+		b, err := servers[turn].chain.GetBlock(height)
+		assert.Nil(t, err)
+		assert.Nil(t, servers[1-turn].processBlock(b))
+	}
+	assert.Equal(t, uint32(4), servers[0].chain.Height())
+	assert.Equal(t, uint32(4), servers[1].chain.Height())
+
+	// a node outside the set cannot produce blocks for the chain
+	outsider := crypto.GeneratePrivateKey()
+	server, err := NewServer(ServerOpts{PrivateKey: &outsider, BlockTime: time.Hour, GenesisValidators: validators})
+	assert.Nil(t, err)
+	defer close(server.QuitChan)
+	assert.NotNil(t, server.CreateNewBlock())
+}
+
+// rewardEngine pays a reward to the producer of every block.
+type rewardEngine struct {
+	core.ProofOfAuthority
+}
+
+func (rewardEngine) Finalize(state core.EngineState, b *core.Block) error {
+	if b.Height == 0 {
+		return nil
+	}
+	return state.Credit(b.Validator.Address(), 5)
+}
+
+func TestServerUsesEngine(t *testing.T) {
+	key := crypto.GeneratePrivateKey()
+	server, err := NewServer(ServerOpts{PrivateKey: &key, BlockTime: time.Hour, Engine: rewardEngine{}})
+	assert.Nil(t, err)
+	defer close(server.QuitChan)
+
+	assert.Nil(t, server.CreateNewBlock())
+	assert.Nil(t, server.CreateNewBlock())
+	assert.Equal(t, uint64(10), server.chain.GetAccount(key.PublicKey().Address()).Balance)
+
+	// a node with the default engine rejects the rewards
+	other, err := NewServer(ServerOpts{BlockTime: time.Hour})
+	assert.Nil(t, err)
+	defer close(other.QuitChan)
+	b, err := server.chain.GetBlock(1)
+	assert.Nil(t, err)
+	assert.NotNil(t, other.processBlock(b))
+	assert.Equal(t, uint32(0), other.chain.Height())
+}
+
+func TestProofOfWorkServersMine(t *testing.T) {
+	engine := core.NewProofOfWork(core.ProofOfWorkOpts{MinDifficulty: 16, Workers: 2})
+	keys := []crypto.PrivateKey{crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey()}
+
+	servers := make([]*Server, len(keys))
+	for i := range keys {
+		server, err := NewServer(ServerOpts{PrivateKey: &keys[i], BlockTime: time.Hour, Engine: engine})
+		assert.Nil(t, err)
+		defer close(server.QuitChan)
+		servers[i] = server
+	}
+
+	// any node may mine the next block
+	for height := uint32(1); height <= 4; height++ {
+		miner := servers[height%2]
+		assert.Nil(t, miner.CreateNewBlock())
+		b, err := miner.chain.GetBlock(height)
+		assert.Nil(t, err)
+		assert.True(t, core.CheckProofOfWork(b.Header))
+		assert.Nil(t, servers[1-height%2].processBlock(b))
+	}
+	assert.Equal(t, uint32(4), servers[0].chain.Height())
+	assert.Equal(t, uint32(4), servers[1].chain.Height())
+}
+
+// newTestServer creates and starts a server that is stopped when the test
+// ends.
+func newTestServer(t *testing.T, opts ServerOpts) *Server {
+	if opts.Logger == nil {
+		opts.Logger = log.NewNopLogger()
+	}
+
+	s, err := NewServer(opts)
+	assert.Nil(t, err)
+
+	go s.Start()
+	t.Cleanup(func() { close(s.QuitChan) })
+	return s
+}
+
+func nextBlock(t *testing.T, s *Server) *core.Block {
+	header, err := s.chain.GetHeader(s.chain.Height())
+	assert.Nil(t, err)
+
+	b, err := core.NewBlockFromHeader(header, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+	return b
+}
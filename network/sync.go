@@ -0,0 +1,284 @@
+/***************************************************************
+ * Arquivo: sync.go
+ * Descrição: Sincronização da cadeia com os peers.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações:
+ ***************************************************************/
+
+package network
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/JoaoRafa19/crypto-go/core"
+)
+
+const (
+	defaultSyncBatchSize  uint32 = 64
+	defaultSyncTimeout           = time.Second * 5
+	defaultStatusInterval        = time.Second * 10
+	maxSyncFailures              = 3
+	maxGetBlocksBatchSize uint32 = 256
+)
+
+type syncPeer struct {
+	height   uint32
+	failures int
+	banned   bool
+	// walkBack moves the next request below our height when the peer is
+	// on a branch we do not know yet
+	walkBack uint32
+}
+
+type syncRequest struct {
+	peer     NetAddr
+	from     uint32
+	deadline time.Time
+}
+
+// syncManager keeps track of the height announced by every peer and
+// downloads missing blocks, one batch at a time, from the highest one.
+// Peers that time out are penalized and peers that send invalid blocks or
+// lie about their height are banned from syncing.
+type syncManager struct {
+	server *Server
+
+	batchSize uint32
+	timeout   time.Duration
+
+	lock   sync.Mutex
+	peers  map[NetAddr]*syncPeer
+	active *syncRequest
+}
+
+func newSyncManager(s *Server) *syncManager {
+	return &syncManager{
+		server:    s,
+		batchSize: defaultSyncBatchSize,
+		timeout:   defaultSyncTimeout,
+		peers:     make(map[NetAddr]*syncPeer),
+	}
+}
+
+// onStatus records the height of a peer. A peer seen for the first time
+// gets our status back, so both sides can compare heights.
+func (m *syncManager) onStatus(from NetAddr, status *StatusMessage) error {
+	genesis, err := m.server.chain.GetHeader(0)
+	if err != nil {
+		return err
+	}
+	if status.GenesisHash != (core.BlockHasher{}).Hash(genesis) {
+		return fmt.Errorf("peer %s follows another genesis (%s)", from, status.GenesisHash)
+	}
+
+	m.lock.Lock()
+	peer, known := m.peers[from]
+	if !known {
+		peer = &syncPeer{}
+		m.peers[from] = peer
+	}
+	peer.height = status.Height
+	m.lock.Unlock()
+
+	if !known {
+		if err := m.server.sendStatus(from); err != nil {
+			return err
+		}
+	}
+
+	m.requestNext()
+	return nil
+}
+
+// onBlocks applies a batch received for the pending request. Blocks that
+// arrive without being asked for are ignored. A batch that does not start at
+// the requested height gets the peer banned, one that brings nothing new
+// gets it penalized, so a stale peer is not asked the same again and again.
+func (m *syncManager) onBlocks(from NetAddr, msg *BlocksMessage) error {
+	m.lock.Lock()
+	req := m.active
+	if req == nil || req.peer != from {
+		m.lock.Unlock()
+		return nil
+	}
+	m.active = nil
+	m.lock.Unlock()
+
+	defer m.requestNext()
+
+	if len(msg.Blocks) == 0 {
+		m.ban(from)
+		return fmt.Errorf("peer %s announced blocks from height (%d) but sent none", from, req.from)
+	}
+	if height := msg.Blocks[0].Height; height != req.from {
+		m.ban(from)
+		return fmt.Errorf("peer %s sent blocks from height (%d), requested (%d)", from, height, req.from)
+	}
+
+	progress := false
+	for i, b := range msg.Blocks {
+		hash := b.Hash(core.BlockHasher{})
+		if m.server.chain.HasBlockHash(hash) {
+			continue
+		}
+
+		if !m.server.chain.HasBlockHash(b.PrevBlockHash) {
+			if i == 0 && req.from > 1 {
+				// the peer is on a branch that forked below the
+				// requested height, ask for older blocks
+				m.walkBack(from)
+				return nil
+			}
+			m.ban(from)
+			return fmt.Errorf("peer %s sent a block (%s) that does not link to the chain", from, hash)
+		}
+
+		if err := m.server.chain.AddBlock(b); err != nil {
+			m.ban(from)
+			return fmt.Errorf("peer %s sent an invalid block (%s): %s", from, hash, err)
+		}
+		progress = true
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !progress {
+		m.penalize(from)
+		return fmt.Errorf("peer %s sent no new block from height (%d)", from, req.from)
+	}
+	if peer, ok := m.peers[from]; ok {
+		peer.failures = 0
+		peer.walkBack = 0
+	}
+	return nil
+}
+
+// requestNext asks the highest eligible peer for the next batch, unless a
+// request is already pending.
+func (m *syncManager) requestNext() {
+	height := m.server.chain.Height()
+
+	m.lock.Lock()
+	if m.active != nil {
+		m.lock.Unlock()
+		return
+	}
+
+	var (
+		best     NetAddr
+		bestPeer *syncPeer
+	)
+	for addr, peer := range m.peers {
+		if peer.banned || peer.height <= height {
+			continue
+		}
+		if bestPeer == nil || peer.height > bestPeer.height {
+			best, bestPeer = addr, peer
+		}
+	}
+
+	if bestPeer == nil {
+		m.lock.Unlock()
+		return
+	}
+
+	from := height + 1
+	if bestPeer.walkBack >= height {
+		from = 1
+	} else {
+		from -= bestPeer.walkBack
+	}
+
+	m.active = &syncRequest{
+		peer:     best,
+		from:     from,
+		deadline: time.Now().Add(m.timeout),
+	}
+	m.lock.Unlock()
+
+	msg := &GetBlocksMessage{From: from, Count: m.batchSize}
+	if err := m.server.sendMessage(best, NewMessage(MessageTypeGetBlocks, msg.Bytes())); err != nil {
+		m.server.Logger.Log("msg", "sync request failed", "peer", best, "error", err)
+		m.lock.Lock()
+		m.active = nil
+		m.penalize(best)
+		m.lock.Unlock()
+	}
+}
+
+// checkTimeout penalizes the peer of a request that was not answered in
+// time and moves on to the next one.
+func (m *syncManager) checkTimeout(now time.Time) {
+	m.lock.Lock()
+	req := m.active
+	if req == nil || now.Before(req.deadline) {
+		m.lock.Unlock()
+		return
+	}
+
+	m.active = nil
+	m.penalize(req.peer)
+	m.lock.Unlock()
+
+	m.server.Logger.Log("msg", "sync request timed out", "peer", req.peer, "from", req.from)
+	m.requestNext()
+}
+
+func (m *syncManager) walkBack(addr NetAddr) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if peer, ok := m.peers[addr]; ok {
+		peer.walkBack += m.batchSize
+	}
+}
+
+func (m *syncManager) ban(addr NetAddr) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if peer, ok := m.peers[addr]; ok {
+		peer.banned = true
+	}
+	m.server.Logger.Log("msg", "peer banned from sync", "peer", addr)
+}
+
+// penalize must be called with the lock held.
+func (m *syncManager) penalize(addr NetAddr) {
+	peer, ok := m.peers[addr]
+	if !ok {
+		return
+	}
+
+	peer.failures++
+	if peer.failures >= maxSyncFailures {
+		peer.banned = true
+	}
+}
+
+// loop announces our status periodically and watches pending requests.
+func (m *syncManager) loop(statusInterval time.Duration) {
+	ticker := time.NewTicker(m.timeout / 5)
+	status := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	defer status.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			m.checkTimeout(now)
+		case <-status.C:
+			if err := m.server.broadcastStatus(); err != nil {
+				m.server.Logger.Log("error", err)
+			}
+		case <-m.server.QuitChan:
+			return
+		}
+	}
+}
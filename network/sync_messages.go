@@ -0,0 +1,129 @@
+/***************************************************************
+ * Arquivo: sync_messages.go
+ * Descrição: Mensagens do protocolo de sincronização da cadeia.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações:
+ ***************************************************************/
+
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/JoaoRafa19/crypto-go/core"
+	"github.com/JoaoRafa19/crypto-go/types"
+)
+
+// StatusMessage announces the chain a node is following.
+type StatusMessage struct {
+	GenesisHash types.Hash
+	TipHash     types.Hash
+	Height      uint32
+}
+
+// Bytes encodes the status as GenesisHash [32] | TipHash [32] | Height u32.
+func (m *StatusMessage) Bytes() []byte {
+	buf := make([]byte, 68)
+	copy(buf[0:32], m.GenesisHash[:])
+	copy(buf[32:64], m.TipHash[:])
+	binary.BigEndian.PutUint32(buf[64:68], m.Height)
+	return buf
+}
+
+func StatusMessageFromBytes(data []byte) (*StatusMessage, error) {
+	if len(data) != 68 {
+		return nil, fmt.Errorf("invalid status message size (%d)", len(data))
+	}
+
+	return &StatusMessage{
+		GenesisHash: types.HashFromBytes(data[0:32]),
+		TipHash:     types.HashFromBytes(data[32:64]),
+		Height:      binary.BigEndian.Uint32(data[64:68]),
+	}, nil
+}
+
+// GetBlocksMessage asks a peer for up to Count canonical blocks starting at
+// height From.
+type GetBlocksMessage struct {
+	From  uint32
+	Count uint32
+}
+
+// Bytes encodes the request as From u32 | Count u32.
+func (m *GetBlocksMessage) Bytes() []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint32(buf[0:4], m.From)
+	binary.BigEndian.PutUint32(buf[4:8], m.Count)
+	return buf
+}
+
+func GetBlocksMessageFromBytes(data []byte) (*GetBlocksMessage, error) {
+	if len(data) != 8 {
+		return nil, fmt.Errorf("invalid get blocks message size (%d)", len(data))
+	}
+
+	return &GetBlocksMessage{
+		From:  binary.BigEndian.Uint32(data[0:4]),
+		Count: binary.BigEndian.Uint32(data[4:8]),
+	}, nil
+}
+
+// BlocksMessage answers a GetBlocksMessage with blocks in height order.
+type BlocksMessage struct {
+	Blocks []*core.Block
+}
+
+// Bytes encodes the blocks as count u32 followed by every block in its
+// canonical encoding, each prefixed with its length (u32).
+func (m *BlocksMessage) Bytes() []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, uint32(len(m.Blocks)))
+
+	for _, b := range m.Blocks {
+		data := core.MarshalBlock(b)
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint32(size, uint32(len(data)))
+		buf = append(buf, size...)
+		buf = append(buf, data...)
+	}
+	return buf
+}
+
+func BlocksMessageFromBytes(data []byte) (*BlocksMessage, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("invalid blocks message size (%d)", len(data))
+	}
+
+	count := binary.BigEndian.Uint32(data[0:4])
+	data = data[4:]
+	if uint64(count)*4 > uint64(len(data)) {
+		return nil, fmt.Errorf("blocks message declares %d blocks in %d bytes", count, len(data))
+	}
+
+	msg := &BlocksMessage{Blocks: make([]*core.Block, 0, count)}
+	for i := uint32(0); i < count; i++ {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("blocks message truncated at block %d", i)
+		}
+		size := binary.BigEndian.Uint32(data[0:4])
+		if uint64(size) > uint64(len(data)-4) {
+			return nil, fmt.Errorf("blocks message truncated at block %d", i)
+		}
+
+		b, err := core.UnmarshalBlock(data[4 : 4+size])
+		if err != nil {
+			return nil, err
+		}
+		msg.Blocks = append(msg.Blocks, b)
+		data = data[4+size:]
+	}
+
+	if len(data) != 0 {
+		return nil, fmt.Errorf("%d unexpected trailing bytes in blocks message", len(data))
+	}
+	return msg, nil
+}
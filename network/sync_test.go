@@ -0,0 +1,219 @@
+package network
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/JoaoRafa19/crypto-go/core"
+	"github.com/JoaoRafa19/crypto-go/types"
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncMessagesBytes(t *testing.T) {
+	status := &StatusMessage{GenesisHash: genesisHash(t), Height: 42}
+	decodedStatus, err := StatusMessageFromBytes(status.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, status, decodedStatus)
+
+	getBlocks := &GetBlocksMessage{From: 3, Count: 10}
+	decodedGetBlocks, err := GetBlocksMessageFromBytes(getBlocks.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, getBlocks, decodedGetBlocks)
+
+	server, err := NewServer(ServerOpts{Logger: log.NewNopLogger()})
+	assert.Nil(t, err)
+	blocks := &BlocksMessage{Blocks: []*core.Block{nextBlock(t, server), nextBlock(t, server)}}
+	decodedBlocks, err := BlocksMessageFromBytes(blocks.Bytes())
+	assert.Nil(t, err)
+	assert.Len(t, decodedBlocks.Blocks, 2)
+	assert.Equal(t, blocks.Blocks[1].Hash(core.BlockHasher{}), decodedBlocks.Blocks[1].Hash(core.BlockHasher{}))
+
+	_, err = BlocksMessageFromBytes(blocks.Bytes()[:20])
+	assert.NotNil(t, err)
+}
+
+func TestSyncLateJoiner(t *testing.T) {
+	trA := NewLocalTransport("A")
+	trB := NewLocalTransport("B")
+
+	privKey := crypto.GeneratePrivateKey()
+	validator := newTestServer(t, ServerOpts{ID: "A", Transports: []Transport{trA}, PrivateKey: &privKey, BlockTime: time.Hour})
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, validator.CreateNewBlock())
+	}
+
+	trA.Connect(trB)
+	trB.Connect(trA)
+
+	joiner := newSyncTestServer(t, ServerOpts{ID: "B", Transports: []Transport{trB}}, 3, time.Second)
+	go joiner.Start()
+
+	assert.Eventually(t, func() bool {
+		return joiner.chain.Height() == 10
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestSyncBansPeerThatTimesOut(t *testing.T) {
+	trA := NewLocalTransport("A")
+	trB := NewLocalTransport("B")
+	trLiar := NewLocalTransport("LIAR")
+
+	privKey := crypto.GeneratePrivateKey()
+	honest := newTestServer(t, ServerOpts{ID: "A", Transports: []Transport{trA}, PrivateKey: &privKey, BlockTime: time.Hour})
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, honest.CreateNewBlock())
+	}
+
+	trB.Connect(trLiar)
+	trLiar.Connect(trB)
+	joiner := newSyncTestServer(t, ServerOpts{ID: "B", Transports: []Transport{trB}}, 64, 50*time.Millisecond)
+	go joiner.Start()
+
+	// the liar claims a much higher chain and never answers
+	lie := &StatusMessage{GenesisHash: genesisHash(t), Height: 500}
+	assert.Nil(t, trLiar.SendMessage("B", NewMessage(MessageTypeStatus, lie.Bytes()).Bytes()))
+
+	assert.Eventually(t, func() bool {
+		return banned(joiner, "LIAR")
+	}, 2*time.Second, 10*time.Millisecond)
+
+	trA.Connect(trB)
+	trB.Connect(trA)
+	assert.Nil(t, honest.sendStatus("B"))
+
+	assert.Eventually(t, func() bool {
+		return joiner.chain.Height() == 5
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestSyncBansPeerSendingInvalidBlocks(t *testing.T) {
+	trB := NewLocalTransport("B")
+	trLiar := NewLocalTransport("LIAR")
+	trB.Connect(trLiar)
+	trLiar.Connect(trB)
+
+	joiner := newSyncTestServer(t, ServerOpts{ID: "B", Transports: []Transport{trB}}, 64, time.Second)
+	go joiner.Start()
+
+	lie := &StatusMessage{GenesisHash: genesisHash(t), Height: 1}
+	assert.Nil(t, trLiar.SendMessage("B", NewMessage(MessageTypeStatus, lie.Bytes()).Bytes()))
+
+	// answer the first block request with a block that has a bad signature
+	go func() {
+		for rpc := range trLiar.Consume() {
+			payload, _ := io.ReadAll(rpc.Payload)
+			msg, err := MessageFromBytes(payload)
+			if err != nil || msg.Header != MessageTypeGetBlocks {
+				continue
+			}
+
+			b := nextBlock(t, joiner)
+			b.Signature = &crypto.Signature{R: b.Signature.S, S: b.Signature.R}
+			reply := &BlocksMessage{Blocks: []*core.Block{b}}
+			trLiar.SendMessage("B", NewMessage(MessageTypeBlocks, reply.Bytes()).Bytes())
+			return
+		}
+	}()
+
+	assert.Eventually(t, func() bool {
+		return banned(joiner, "LIAR")
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint32(0), joiner.chain.Height())
+}
+
+func TestSyncPenalizesStalePeer(t *testing.T) {
+	joiner := newSyncTestServer(t, ServerOpts{ID: "B"}, 64, time.Second)
+	b := nextBlock(t, joiner)
+	assert.Nil(t, joiner.chain.AddBlock(b))
+
+	m := joiner.syncer
+	m.lock.Lock()
+	m.peers["STALE"] = &syncPeer{height: 1}
+	m.lock.Unlock()
+
+	// the peer keeps answering with a block we already have
+	for i := 0; i < maxSyncFailures; i++ {
+		assert.False(t, banned(joiner, "STALE"))
+		m.lock.Lock()
+		m.active = &syncRequest{peer: "STALE", from: 1, deadline: time.Now().Add(time.Second)}
+		m.lock.Unlock()
+		assert.NotNil(t, m.onBlocks("STALE", &BlocksMessage{Blocks: []*core.Block{b}}))
+	}
+	assert.True(t, banned(joiner, "STALE"))
+
+	// a batch from another height than requested is a lie
+	m.lock.Lock()
+	m.peers["LIAR"] = &syncPeer{height: 1}
+	m.active = &syncRequest{peer: "LIAR", from: 2, deadline: time.Now().Add(time.Second)}
+	m.lock.Unlock()
+	assert.NotNil(t, m.onBlocks("LIAR", &BlocksMessage{Blocks: []*core.Block{b}}))
+	assert.True(t, banned(joiner, "LIAR"))
+}
+
+func TestProcessGetBlocks(t *testing.T) {
+	trA := NewLocalTransport("A")
+	trB := NewLocalTransport("B")
+	trA.Connect(trB)
+
+	privKey := crypto.GeneratePrivateKey()
+	server, err := NewServer(ServerOpts{Logger: log.NewNopLogger(), Transports: []Transport{trA}, PrivateKey: &privKey, BlockTime: time.Hour})
+	assert.Nil(t, err)
+	defer close(server.QuitChan)
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, server.CreateNewBlock())
+	}
+	drain(trB)
+
+	assert.Nil(t, server.ProcessMessage(&DecodedMessage{From: "B", Data: &GetBlocksMessage{From: 2, Count: 10}}))
+
+	rpc := <-trB.Consume()
+	decoded, err := DefaultRPCDecodeFunc(rpc)
+	assert.Nil(t, err)
+
+	blocks := decoded.Data.(*BlocksMessage).Blocks
+	assert.Len(t, blocks, 3)
+	assert.Equal(t, uint32(2), blocks[0].Height)
+	assert.Equal(t, uint32(4), blocks[2].Height)
+}
+
+func newSyncTestServer(t *testing.T, opts ServerOpts, batchSize uint32, timeout time.Duration) *Server {
+	opts.Logger = log.NewNopLogger()
+
+	s, err := NewServer(opts)
+	assert.Nil(t, err)
+
+	s.syncer.batchSize = batchSize
+	s.syncer.timeout = timeout
+	t.Cleanup(func() { close(s.QuitChan) })
+	return s
+}
+
+// banned tells whether the sync manager of s banned the peer.
+func banned(s *Server, addr NetAddr) bool {
+	s.syncer.lock.Lock()
+	defer s.syncer.lock.Unlock()
+
+	peer, ok := s.syncer.peers[addr]
+	return ok && peer.banned
+}
+
+func genesisHash(t *testing.T) types.Hash {
+	genesis, err := genesisBlock(nil, nil)
+	assert.Nil(t, err)
+	return genesis.Hash(core.BlockHasher{})
+}
+
+// drain discards the messages already queued on a local transport.
+func drain(tr Transport) {
+	for {
+		select {
+		case <-tr.Consume():
+		case <-time.After(50 * time.Millisecond):
+			return
+		}
+	}
+}
@@ -0,0 +1,575 @@
+/***************************************************************
+ * Arquivo: tcp_transport.go
+ * Descrição: Implementação do transporte TCP.
+ * Autor: JoaoRafa19
+ * Data de criação: 2024-2025
+ * Versão: 0.0.1
+ * Licença: MIT License
+ * Observações: Cada conexão começa com um handshake em que os
+ * dois lados enviam o endereço em que escutam; quem aceita a
+ * conexão confirma o endereço ligando de volta para ele. Depois
+ * disso cada payload trafega como um frame prefixado pelo tamanho.
+ ***************************************************************/
+
+package network
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	maxTCPFrameSize     = 32 * 1024 * 1024
+	tcpSendQueueSize    = 1024
+	tcpDialTimeout      = time.Second * 5
+	tcpHandshakeTime    = time.Second * 5
+	tcpWriteTimeout     = time.Second * 10
+	tcpMinBackoff       = time.Millisecond * 100
+	tcpMaxBackoff       = time.Second * 10
+	tcpMaxAcceptBackoff = time.Second
+	tcpConsumeChanSize  = 1024
+
+	// the first frame of a connection is a hello, tag | token | listen
+	// address, or a confirmation request, tag | token | listen address of
+	// the node asking
+	tcpHello     byte = 0x1
+	tcpConfirm   byte = 0x2
+	tcpTokenSize      = 16
+)
+
+type tcpPeer struct {
+	addr NetAddr
+	conn net.Conn
+	// initiator is the listen address of the side that dialed the
+	// connection, used to pick one of two simultaneous connections
+	initiator NetAddr
+	// token identifies a connection this node dialed, it is confirmed
+	// to the peer dialing back
+	token     string
+	sendCh    chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (p *tcpPeer) close() {
+	p.closeOnce.Do(func() {
+		p.conn.Close()
+		close(p.done)
+	})
+}
+
+// TCPTransport connects nodes across processes. Peers are identified by the
+// address they listen on, so RPC.From can be used to reply with SendMessage.
+// The address a dialing node claims is confirmed by dialing back to it, so a
+// node cannot take the place of another one. Connections dialed with Connect
+// or Dial are re-established with an exponential backoff when they drop.
+type TCPTransport struct {
+	addr     NetAddr
+	listener net.Listener
+
+	lock    sync.RWMutex
+	peers   map[NetAddr]*tcpPeer
+	dialing map[NetAddr]bool
+	// tokens maps the token of every connection this node dialed, or is
+	// dialing, to the address it dialed
+	tokens    map[string]NetAddr
+	consumeCh chan RPC
+	quitCh    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewTCPTransport starts listening on addr. Use port 0 to let the system
+// pick a port, Addr then returns the actual address.
+func NewTCPTransport(addr NetAddr) (*TCPTransport, error) {
+	ln, err := net.Listen("tcp", string(addr))
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TCPTransport{
+		addr:      NetAddr(ln.Addr().String()),
+		listener:  ln,
+		peers:     make(map[NetAddr]*tcpPeer),
+		dialing:   make(map[NetAddr]bool),
+		tokens:    make(map[string]NetAddr),
+		consumeCh: make(chan RPC, tcpConsumeChanSize),
+		quitCh:    make(chan struct{}),
+	}
+
+	t.wg.Add(1)
+	go t.acceptLoop()
+
+	return t, nil
+}
+
+func (t *TCPTransport) Consume() <-chan RPC {
+	return t.consumeCh
+}
+
+func (t *TCPTransport) Addr() NetAddr {
+	return t.addr
+}
+
+// Connect dials the address of the given peer, which can be any Transport
+// reachable over TCP.
+func (t *TCPTransport) Connect(tr Transport) error {
+	return t.Dial(tr.Addr())
+}
+
+// Dial connects to the node listening on addr and keeps the connection
+// alive until the transport is closed. The first attempt is synchronous so
+// the caller learns whether the peer is reachable.
+func (t *TCPTransport) Dial(addr NetAddr) error {
+	if addr == t.addr {
+		return fmt.Errorf("%s cannot connect to itself", t.addr)
+	}
+
+	t.lock.Lock()
+	if t.dialing[addr] {
+		t.lock.Unlock()
+		return nil
+	}
+	t.dialing[addr] = true
+	t.lock.Unlock()
+
+	p, err := t.dial(addr)
+	if err != nil {
+		t.lock.Lock()
+		delete(t.dialing, addr)
+		t.lock.Unlock()
+		return err
+	}
+
+	t.wg.Add(1)
+	go t.maintain(addr, p)
+	return nil
+}
+
+func (t *TCPTransport) SendMessage(to NetAddr, payload []byte) error {
+	t.lock.RLock()
+	p, ok := t.peers[to]
+	t.lock.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%s could not send message to %s", t.addr, to)
+	}
+
+	select {
+	case p.sendCh <- payload:
+		return nil
+	case <-p.done:
+		return fmt.Errorf("%s lost the connection to %s", t.addr, to)
+	default:
+		return fmt.Errorf("%s send queue to %s is full", t.addr, to)
+	}
+}
+
+func (t *TCPTransport) Broadcast(payload []byte) error {
+	t.lock.RLock()
+	peers := make([]NetAddr, 0, len(t.peers))
+	for addr := range t.peers {
+		peers = append(peers, addr)
+	}
+	t.lock.RUnlock()
+
+	var firstErr error
+	for _, addr := range peers {
+		if err := t.SendMessage(addr, payload); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Peers returns the addresses of the connected peers.
+func (t *TCPTransport) Peers() []NetAddr {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	peers := make([]NetAddr, 0, len(t.peers))
+	for addr := range t.peers {
+		peers = append(peers, addr)
+	}
+	return peers
+}
+
+// Close stops listening, drops every connection and waits for the
+// transport goroutines to finish.
+func (t *TCPTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.quitCh)
+		err = t.listener.Close()
+
+		t.lock.Lock()
+		for _, p := range t.peers {
+			p.close()
+		}
+		t.lock.Unlock()
+
+		t.wg.Wait()
+	})
+	return err
+}
+
+func (t *TCPTransport) acceptLoop() {
+	defer t.wg.Done()
+	backoff := tcpMinBackoff
+
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			// errors such as running out of file descriptors last a while,
+			// so retrying at once would only spin
+			select {
+			case <-time.After(backoff):
+			case <-t.quitCh:
+				return
+			}
+			backoff *= 2
+			if backoff > tcpMaxAcceptBackoff {
+				backoff = tcpMaxAcceptBackoff
+			}
+			continue
+		}
+		backoff = tcpMinBackoff
+
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			if _, err := t.handshake(conn, ""); err != nil {
+				conn.Close()
+			}
+		}()
+	}
+}
+
+// maintain re-dials addr whenever its connection drops.
+func (t *TCPTransport) maintain(addr NetAddr, p *tcpPeer) {
+	defer t.wg.Done()
+	backoff := tcpMinBackoff
+
+	for {
+		if p != nil {
+			select {
+			case <-p.done:
+			case <-t.quitCh:
+				return
+			}
+		}
+
+		// another connection to the same node may be up already. The dropped
+		// peer itself may still be registered until drop removes it.
+		t.lock.RLock()
+		existing := t.peers[addr]
+		t.lock.RUnlock()
+		if existing != nil && existing != p {
+			p = existing
+			continue
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-t.quitCh:
+			return
+		}
+
+		var err error
+		if p, err = t.dial(addr); err != nil {
+			p = nil
+			backoff *= 2
+			if backoff > tcpMaxBackoff {
+				backoff = tcpMaxBackoff
+			}
+			continue
+		}
+		backoff = tcpMinBackoff
+	}
+}
+
+func (t *TCPTransport) dial(addr NetAddr) (*tcpPeer, error) {
+	conn, err := net.DialTimeout("tcp", string(addr), tcpDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := t.handshake(conn, addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// handshake exchanges listen addresses and registers the peer. The node
+// that dialed, to the address given as dialed, sends its hello first; the
+// node that accepted answers with its own and confirms the claimed address
+// before registering the peer. When both nodes dial each other at the same
+// time, both keep the connection dialed by the node with the smaller
+// address.
+func (t *TCPTransport) handshake(conn net.Conn, dialed NetAddr) (*tcpPeer, error) {
+	outbound := dialed != ""
+	conn.SetDeadline(time.Now().Add(tcpHandshakeTime))
+
+	token := make([]byte, tcpTokenSize)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	hello := append([]byte{tcpHello}, token...)
+	hello = append(hello, t.addr...)
+
+	if outbound {
+		t.lock.Lock()
+		t.tokens[string(token)] = dialed
+		t.lock.Unlock()
+		registered := false
+		defer func() {
+			if !registered {
+				t.forgetToken(string(token))
+			}
+		}()
+
+		if err := writeTCPFrame(conn, hello); err != nil {
+			return nil, err
+		}
+		remote, err := readHello(conn)
+		if err != nil {
+			return nil, err
+		}
+		if remote.addr != dialed {
+			return nil, fmt.Errorf("%s dialed %s but reached %s", t.addr, dialed, remote.addr)
+		}
+		conn.SetDeadline(time.Time{})
+
+		p, err := t.register(conn, remote.addr, t.addr, string(token))
+		registered = err == nil
+		return p, err
+	}
+
+	frame, err := readTCPFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(frame) > 0 && frame[0] == tcpConfirm {
+		return nil, t.answerConfirm(conn, frame)
+	}
+	remote, err := parseHello(frame)
+	if err != nil {
+		return nil, err
+	}
+	if remote.addr == t.addr {
+		return nil, fmt.Errorf("%s refused a connection to itself", t.addr)
+	}
+	if err := writeTCPFrame(conn, hello); err != nil {
+		return nil, err
+	}
+	if err := t.confirm(remote.addr, remote.token); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return t.register(conn, remote.addr, remote.addr, "")
+}
+
+// register makes the connection the one to the peer at addr, dialed by the
+// node listening on initiator.
+func (t *TCPTransport) register(conn net.Conn, addr, initiator NetAddr, token string) (*tcpPeer, error) {
+	p := &tcpPeer{
+		addr:      addr,
+		conn:      conn,
+		initiator: initiator,
+		token:     token,
+		sendCh:    make(chan []byte, tcpSendQueueSize),
+		done:      make(chan struct{}),
+	}
+
+	t.lock.Lock()
+	select {
+	case <-t.quitCh:
+		t.lock.Unlock()
+		return nil, fmt.Errorf("%s is closed", t.addr)
+	default:
+	}
+
+	if existing, ok := t.peers[addr]; ok {
+		if existing.initiator <= initiator {
+			t.lock.Unlock()
+			return nil, fmt.Errorf("%s is already connected to %s", t.addr, addr)
+		}
+		existing.close()
+	}
+	t.peers[addr] = p
+	t.lock.Unlock()
+
+	t.wg.Add(2)
+	go t.readLoop(p)
+	go t.writeLoop(p)
+
+	return p, nil
+}
+
+// confirm dials back to the address a node claimed in its hello and asks
+// whether it dialed this node with token. Only the node really listening
+// there knows the token, so no other node can take its address.
+func (t *TCPTransport) confirm(addr NetAddr, token []byte) error {
+	conn, err := net.DialTimeout("tcp", string(addr), tcpDialTimeout)
+	if err != nil {
+		return fmt.Errorf("%s could not confirm %s: %s", t.addr, addr, err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(tcpHandshakeTime))
+	req := append([]byte{tcpConfirm}, token...)
+	if err := writeTCPFrame(conn, append(req, t.addr...)); err != nil {
+		return err
+	}
+	reply, err := readTCPFrame(conn)
+	if err != nil {
+		return err
+	}
+	if len(reply) != 1 || reply[0] != 1 {
+		return fmt.Errorf("%s did not dial %s", addr, t.addr)
+	}
+	return nil
+}
+
+// answerConfirm tells the node dialing back whether this node dialed it
+// with the token of the request.
+func (t *TCPTransport) answerConfirm(conn net.Conn, req []byte) error {
+	remote, err := parseHello(req)
+	if err != nil {
+		return err
+	}
+
+	t.lock.RLock()
+	dialed, ok := t.tokens[string(remote.token)]
+	t.lock.RUnlock()
+
+	reply := []byte{0}
+	if ok && dialed == remote.addr {
+		reply[0] = 1
+	}
+	if err := writeTCPFrame(conn, reply); err != nil {
+		return err
+	}
+	// the connection only served the confirmation
+	return fmt.Errorf("%s answered a confirmation from %s", t.addr, remote.addr)
+}
+
+func (t *TCPTransport) forgetToken(token string) {
+	t.lock.Lock()
+	delete(t.tokens, token)
+	t.lock.Unlock()
+}
+
+// tcpHandshake is the content of a hello or of a confirmation request.
+type tcpHandshake struct {
+	token []byte
+	addr  NetAddr
+}
+
+func readHello(r io.Reader) (*tcpHandshake, error) {
+	frame, err := readTCPFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(frame) == 0 || frame[0] != tcpHello {
+		return nil, fmt.Errorf("handshake is not a hello")
+	}
+	return parseHello(frame)
+}
+
+func parseHello(frame []byte) (*tcpHandshake, error) {
+	if len(frame) <= 1+tcpTokenSize {
+		return nil, fmt.Errorf("handshake of (%d) bytes is too short", len(frame))
+	}
+	return &tcpHandshake{
+		token: frame[1 : 1+tcpTokenSize],
+		addr:  NetAddr(frame[1+tcpTokenSize:]),
+	}, nil
+}
+
+func (t *TCPTransport) readLoop(p *tcpPeer) {
+	defer t.wg.Done()
+	defer t.drop(p)
+
+	for {
+		payload, err := readTCPFrame(p.conn)
+		if err != nil {
+			return
+		}
+
+		select {
+		case t.consumeCh <- RPC{From: p.addr, Payload: bytes.NewReader(payload)}:
+		case <-p.done:
+			return
+		case <-t.quitCh:
+			return
+		}
+	}
+}
+
+func (t *TCPTransport) writeLoop(p *tcpPeer) {
+	defer t.wg.Done()
+	defer t.drop(p)
+
+	for {
+		select {
+		case payload := <-p.sendCh:
+			p.conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+			if err := writeTCPFrame(p.conn, payload); err != nil {
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// drop closes the connection and forgets the peer, unless it was already
+// replaced by a newer connection.
+func (t *TCPTransport) drop(p *tcpPeer) {
+	p.close()
+
+	t.lock.Lock()
+	if t.peers[p.addr] == p {
+		delete(t.peers, p.addr)
+	}
+	if p.token != "" {
+		delete(t.tokens, p.token)
+	}
+	t.lock.Unlock()
+}
+
+func writeTCPFrame(w io.Writer, payload []byte) error {
+	frame := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[4:], payload)
+	_, err := w.Write(frame)
+	return err
+}
+
+func readTCPFrame(r io.Reader) ([]byte, error) {
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(r, size); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(size)
+	if n > maxTCPFrameSize {
+		return nil, fmt.Errorf("frame size (%d) is too large", n)
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
@@ -0,0 +1,187 @@
+package network
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTCPTransportSendMessage(t *testing.T) {
+	trA := newTCPTestTransport(t, "127.0.0.1:0")
+	trB := newTCPTestTransport(t, "127.0.0.1:0")
+
+	assert.Nil(t, trA.Connect(trB))
+	waitForPeer(t, trB, trA.Addr())
+
+	assert.Nil(t, trA.SendMessage(trB.Addr(), []byte("hello")))
+	rpc := receive(t, trB)
+	assert.Equal(t, trA.Addr(), rpc.From)
+	assert.Equal(t, []byte("hello"), readPayload(t, rpc))
+
+	// the accepted side can answer on the same connection
+	assert.Nil(t, trB.SendMessage(rpc.From, []byte("world")))
+	rpc = receive(t, trA)
+	assert.Equal(t, trB.Addr(), rpc.From)
+	assert.Equal(t, []byte("world"), readPayload(t, rpc))
+
+	assert.NotNil(t, trA.SendMessage("127.0.0.1:1", []byte("nobody")))
+}
+
+func TestTCPTransportBroadcast(t *testing.T) {
+	trA := newTCPTestTransport(t, "127.0.0.1:0")
+	trB := newTCPTestTransport(t, "127.0.0.1:0")
+	trC := newTCPTestTransport(t, "127.0.0.1:0")
+
+	assert.Nil(t, trA.Connect(trB))
+	assert.Nil(t, trA.Connect(trC))
+
+	assert.Nil(t, trA.Broadcast([]byte("all")))
+	assert.Equal(t, []byte("all"), readPayload(t, receive(t, trB)))
+	assert.Equal(t, []byte("all"), readPayload(t, receive(t, trC)))
+}
+
+func TestTCPTransportSimultaneousConnect(t *testing.T) {
+	trA := newTCPTestTransport(t, "127.0.0.1:0")
+	trB := newTCPTestTransport(t, "127.0.0.1:0")
+
+	errs := make(chan error, 2)
+	go func() { errs <- trA.Connect(trB) }()
+	go func() { errs <- trB.Connect(trA) }()
+	<-errs
+	<-errs
+
+	// both sides settle on a single connection
+	assert.Eventually(t, func() bool {
+		return trA.SendMessage(trB.Addr(), []byte("ping")) == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []byte("ping"), readPayload(t, receive(t, trB)))
+	assert.Len(t, trA.Peers(), 1)
+	assert.Len(t, trB.Peers(), 1)
+}
+
+func TestTCPTransportReconnects(t *testing.T) {
+	trA := newTCPTestTransport(t, "127.0.0.1:0")
+	trB, err := NewTCPTransport("127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := trB.Addr()
+
+	assert.Nil(t, trA.Connect(trB))
+	assert.Nil(t, trB.Close())
+
+	assert.Eventually(t, func() bool {
+		return len(trA.Peers()) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// the peer comes back on the same address
+	trB = newTCPTestTransport(t, addr)
+	waitForPeer(t, trA, addr)
+
+	assert.Nil(t, trA.SendMessage(addr, []byte("again")))
+	assert.Equal(t, []byte("again"), readPayload(t, receive(t, trB)))
+}
+
+func TestTCPTransportRejectsImpostor(t *testing.T) {
+	trA := newTCPTestTransport(t, "127.0.0.1:0")
+	trB := newTCPTestTransport(t, "127.0.0.1:0")
+	assert.Nil(t, trB.Connect(trA))
+	waitForPeer(t, trA, trB.Addr())
+
+	// a third node claims the address of B, and then one nobody listens on
+	for _, claim := range []NetAddr{trB.Addr(), "127.0.0.1:1"} {
+		conn, err := net.Dial("tcp", string(trA.Addr()))
+		assert.Nil(t, err)
+		hello := append([]byte{tcpHello}, make([]byte, tcpTokenSize)...)
+		assert.Nil(t, writeTCPFrame(conn, append(hello, claim...)))
+
+		// A answers with its hello, then closes the connection once the
+		// dial back does not confirm the claim
+		_, err = readHello(conn)
+		assert.Nil(t, err)
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		_, err = readTCPFrame(conn)
+		assert.NotNil(t, err)
+		if netErr, ok := err.(net.Error); ok {
+			assert.False(t, netErr.Timeout())
+		}
+		conn.Close()
+	}
+
+	assert.Len(t, trA.Peers(), 1)
+	assert.Nil(t, trA.SendMessage(trB.Addr(), []byte("still B")))
+	assert.Equal(t, []byte("still B"), readPayload(t, receive(t, trB)))
+}
+
+func TestTCPTransportRejectsItself(t *testing.T) {
+	tr := newTCPTestTransport(t, "127.0.0.1:0")
+	assert.NotNil(t, tr.Connect(tr))
+}
+
+func TestReadTCPFrameTooLarge(t *testing.T) {
+	r, w := io.Pipe()
+	go w.Write([]byte{0xff, 0xff, 0xff, 0xff})
+
+	_, err := readTCPFrame(r)
+	assert.NotNil(t, err)
+}
+
+func TestTCPBlockPropagation(t *testing.T) {
+	trA := newTCPTestTransport(t, "127.0.0.1:0")
+	trB := newTCPTestTransport(t, "127.0.0.1:0")
+	trC := newTCPTestTransport(t, "127.0.0.1:0")
+
+	assert.Nil(t, trB.Connect(trA))
+	assert.Nil(t, trC.Connect(trB))
+	waitForPeer(t, trA, trB.Addr())
+	waitForPeer(t, trB, trC.Addr())
+
+	privKey := crypto.GeneratePrivateKey()
+	validator := newTestServer(t, ServerOpts{ID: "A", Transports: []Transport{trA}, PrivateKey: &privKey, BlockTime: time.Hour})
+	relay := newTestServer(t, ServerOpts{ID: "B", Transports: []Transport{trB}})
+	follower := newTestServer(t, ServerOpts{ID: "C", Transports: []Transport{trC}})
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, validator.CreateNewBlock())
+	}
+
+	assert.Eventually(t, func() bool {
+		return relay.chain.Height() == 3 && follower.chain.Height() == 3
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func newTCPTestTransport(t *testing.T, addr NetAddr) *TCPTransport {
+	tr, err := NewTCPTransport(addr)
+	assert.Nil(t, err)
+	t.Cleanup(func() { tr.Close() })
+	return tr
+}
+
+func waitForPeer(t *testing.T, tr *TCPTransport, addr NetAddr) {
+	assert.Eventually(t, func() bool {
+		for _, peer := range tr.Peers() {
+			if peer == addr {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func receive(t *testing.T, tr Transport) RPC {
+	select {
+	case rpc := <-tr.Consume():
+		return rpc
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a message")
+		return RPC{}
+	}
+}
+
+func readPayload(t *testing.T, rpc RPC) []byte {
+	data, err := io.ReadAll(rpc.Payload)
+	assert.Nil(t, err)
+	return data
+}
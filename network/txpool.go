@@ -11,7 +11,11 @@
 package network
 
 import (
+	"fmt"
+	"math"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/JoaoRafa19/crypto-go/core"
 	"github.com/JoaoRafa19/crypto-go/types"
@@ -45,50 +49,454 @@ func (s *TxMapSorter) Swap(i, j int) {
 	s.Transations[i], s.Transations[j] = s.Transations[j], s.Transations[i]
 }
 
-// Less
+// Less puts the transactions paying the highest fee first, the oldest
+// first among equal fees.
 func (s *TxMapSorter) Less(i, j int) bool {
-	return s.Transations[i].GetFirstSeen() < s.Transations[j].GetFirstSeen()
+	return higherPriority(s.Transations[i], s.Transations[j])
 }
 
+// higherPriority tells whether a should be mined before b.
+func higherPriority(a, b *core.Transaction) bool {
+	if a.Fee != b.Fee {
+		return a.Fee > b.Fee
+	}
+	return a.GetFirstSeen() < b.GetFirstSeen()
+}
+
+const (
+	defaultMaxPoolTxs   = 10000
+	defaultMaxPoolBytes = 32 * 1024 * 1024
+	defaultTxTTL        = time.Hour
+	defaultMaxStagedTxs = 1000
+	// a pending transfer is replaced only by one paying 10% more
+	defaultReplaceFeeBump = 10
+)
+
+// TxPoolOpts bounds the pool. Zero values fall back to the defaults.
+type TxPoolOpts struct {
+	// MaxCount and MaxBytes limit the number of transactions and the sum
+	// of their encoded sizes. When a limit is reached the transactions
+	// paying the lowest fee, the oldest among them, are evicted to make
+	// room.
+	MaxCount int
+	MaxBytes int
+	// TTL is how long a transaction may wait in the pool before it is
+	// dropped.
+	TTL time.Duration
+	// MinFeePerByte is the lowest fee accepted for each byte of the encoded
+	// transaction. Zero accepts transactions without a fee.
+	MinFeePerByte uint64
+	// ReplaceFeeBump is the percentage a transfer must add to the fee of
+	// the pending one with the same sender and nonce to replace it.
+	ReplaceFeeBump uint64
+	// MaxStaged limits the number of partially approved multisig
+	// transactions waiting for approvals. They expire after TTL too.
+	MaxStaged int
+}
+
+// TxPool holds the pending transactions. It is safe for concurrent use.
 type TxPool struct {
-	trxs map[types.Hash]*core.Transaction
+	TxPoolOpts
+
+	lock    sync.RWMutex
+	trxs    map[types.Hash]*core.Transaction
+	entries map[types.Hash]poolEntry
+	// nonces holds the pending transfer of every sender and nonce
+	nonces map[senderNonce]types.Hash
+	bytes  int
+	// staged holds the multisig transactions still lacking approvals, apart
+	// from the pool: they are never mined
+	staged map[types.Hash]stagedTx
+	now    func() time.Time
+}
+
+type stagedTx struct {
+	tx    *core.Transaction
+	added time.Time
+}
+
+type senderNonce struct {
+	sender types.Address
+	nonce  uint64
+}
+
+// transferKey returns the sender and nonce of a signed transaction of every
+// type that consumes the sender nonce.
+func transferKey(tx *core.Transaction) (senderNonce, bool) {
+	if !tx.UsesNonce() {
+		return senderNonce{}, false
+	}
+	sender, ok := tx.Sender()
+	if !ok {
+		return senderNonce{}, false
+	}
+	return senderNonce{sender: sender, nonce: tx.Nonce}, true
+}
+
+type poolEntry struct {
+	size  int
+	added time.Time
 }
 
 func NewTxPool() *TxPool {
+	return NewTxPoolWithOpts(TxPoolOpts{})
+}
+
+func NewTxPoolWithOpts(opts TxPoolOpts) *TxPool {
+	if opts.MaxCount == 0 {
+		opts.MaxCount = defaultMaxPoolTxs
+	}
+	if opts.MaxBytes == 0 {
+		opts.MaxBytes = defaultMaxPoolBytes
+	}
+	if opts.TTL == 0 {
+		opts.TTL = defaultTxTTL
+	}
+	if opts.ReplaceFeeBump == 0 {
+		opts.ReplaceFeeBump = defaultReplaceFeeBump
+	}
+	if opts.MaxStaged == 0 {
+		opts.MaxStaged = defaultMaxStagedTxs
+	}
+
 	return &TxPool{
-		trxs: make(map[types.Hash]*core.Transaction),
+		TxPoolOpts: opts,
+		trxs:       make(map[types.Hash]*core.Transaction),
+		entries:    make(map[types.Hash]poolEntry),
+		nonces:     make(map[senderNonce]types.Hash),
+		staged:     make(map[types.Hash]stagedTx),
+		now:        time.Now,
 	}
 }
 
-// Transactions returns a slice of all transactions in the pool.
+// Transactions returns the transactions in the pool that did not expire,
+// the highest fee first and the oldest first among equal fees.
 func (p *TxPool) Transactions() []*core.Transaction {
-	s := NewTxMapSorter(p.trxs)
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	now := p.now()
+	txMap := make(map[types.Hash]*core.Transaction, len(p.trxs))
+	for hash, tx := range p.trxs {
+		if !p.expired(hash, now) {
+			txMap[hash] = tx
+		}
+	}
+
+	s := NewTxMapSorter(txMap)
 	return s.Transations
 }
 
-// Add adds a transaction to the pool. The caller is responsible for checking
-// if the transaction already exists in the pool.
+// Add adds a transaction to the pool, dropping expired transactions and
+// evicting the lowest priority ones when the pool is full. A transaction
+// without FirstSeen is stamped with the current time. A transfer with the
+// same sender and nonce as a pending one replaces it only when it pays
+// enough of a fee bump. A multisig transaction lacking approvals goes
+// through Stage instead.
 func (p *TxPool) Add(tx *core.Transaction) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.prune(p.now())
+	return p.add(tx)
+}
+
+// Stage takes a multisig transaction that may still lack approvals. Its
+// approvals are checked and merged with those of the copies staged before,
+// and it waits in the staging area, apart from the pool, until they reach
+// the threshold of its policy. It then moves to the pool like with Add.
+// Stage returns the merged transaction, or nil when tx brought no new
+// approval.
+func (p *TxPool) Stage(tx *core.Transaction) (*core.Transaction, error) {
 	hash := tx.Hash(core.TxHasher{})
-	if p.Contains(hash) {
+	if tx.Multisig == nil {
+		return nil, fmt.Errorf("transaction (%s) is not a multisig transaction", hash)
+	}
+	if _, err := tx.VerifyApprovals(); err != nil {
+		return nil, fmt.Errorf("transaction (%s): %s", hash, err)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, ok := p.trxs[hash]; ok {
+		return nil, nil
+	}
+
+	now := p.now()
+	p.prune(now)
+
+	merged, added := tx, now
+	if staged, ok := p.staged[hash]; ok {
+		if merged = mergeApprovals(staged.tx, tx); merged == nil {
+			return nil, nil
+		}
+		added = staged.added
+	} else if len(p.staged) >= p.MaxStaged {
+		return nil, fmt.Errorf("transaction (%s): staging area is full", hash)
+	}
+
+	if len(merged.Approvals) < int(merged.Multisig.Threshold) {
+		p.staged[hash] = stagedTx{tx: merged, added: added}
+		return merged, nil
+	}
+
+	delete(p.staged, hash)
+	if err := p.add(merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// mergeApprovals returns a copy of staged with the approvals of tx it
+// lacks, nil when tx brings none. Both are the same transaction, so the
+// approvals of one are valid for the other.
+func mergeApprovals(staged, tx *core.Transaction) *core.Transaction {
+	merged := *staged
+	merged.Approvals = append([]core.Approval{}, staged.Approvals...)
+	for _, a := range tx.Approvals {
+		if merged.HasApproval(a.Key) {
+			continue
+		}
+		if err := merged.AddApproval(a); err != nil {
+			return nil
+		}
+	}
+
+	if len(merged.Approvals) == len(staged.Approvals) {
 		return nil
 	}
-	p.trxs[hash] = tx
-	return nil
+	return &merged
+}
+
+// bumpedFee is the fee a replacement must pay, at least one more than the
+// replaced one.
+func bumpedFee(fee, bump uint64) uint64 {
+	increase := fee * bump / 100
+	if increase == 0 {
+		increase = 1
+	}
+	if fee > math.MaxUint64-increase {
+		return math.MaxUint64
+	}
+	return fee + increase
 }
 
 // Has checks if a transaction with the given hash exists in the pool.
 func (p *TxPool) Contains(hash types.Hash) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
 	_, ok := p.trxs[hash]
 	return ok
 }
 
+// StagedLen returns the number of multisig transactions waiting for
+// approvals.
+func (p *TxPool) StagedLen() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return len(p.staged)
+}
+
 // Len returns the number of transactions currently in the pool.
 func (p *TxPool) Len() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
 	return len(p.trxs)
 }
 
+// Bytes returns the encoded size of the transactions in the pool.
+func (p *TxPool) Bytes() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.bytes
+}
+
+// Remove drops a transaction from the pool, usually because it was
+// included in a block.
+func (p *TxPool) Remove(hash types.Hash) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.remove(hash)
+	delete(p.staged, hash)
+}
+
+// RemoveStale drops the transfers whose nonce is lower than the current
+// nonce of their sender, as given by nonceOf, and returns how many were
+// dropped.
+func (p *TxPool) RemoveStale(nonceOf func(types.Address) uint64) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	dropped := 0
+	for hash, tx := range p.trxs {
+		if key, ok := transferKey(tx); ok && key.nonce < nonceOf(key.sender) {
+			p.remove(hash)
+			dropped++
+		}
+	}
+	for hash, staged := range p.staged {
+		if key, ok := transferKey(staged.tx); ok && key.nonce < nonceOf(key.sender) {
+			delete(p.staged, hash)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// Prune drops the transactions that outlived the TTL and returns how many
+// were dropped.
+func (p *TxPool) Prune() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.prune(p.now())
+}
+
 // Flush removes all transactions from the pool.
 func (p *TxPool) Flush() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
 	p.trxs = make(map[types.Hash]*core.Transaction)
+	p.entries = make(map[types.Hash]poolEntry)
+	p.nonces = make(map[senderNonce]types.Hash)
+	p.staged = make(map[types.Hash]stagedTx)
+	p.bytes = 0
+}
+
+// the helpers below must be called with the lock held
+
+func (p *TxPool) expired(hash types.Hash, now time.Time) bool {
+	return now.Sub(p.entries[hash].added) > p.TTL
+}
+
+func (p *TxPool) prune(now time.Time) int {
+	dropped := 0
+	for hash := range p.trxs {
+		if p.expired(hash, now) {
+			p.remove(hash)
+			dropped++
+		}
+	}
+	for hash, staged := range p.staged {
+		if now.Sub(staged.added) > p.TTL {
+			delete(p.staged, hash)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// add is Add once the pool is locked and pruned.
+func (p *TxPool) add(tx *core.Transaction) error {
+	hash := tx.Hash(core.TxHasher{})
+	if tx.Multisig != nil && len(tx.Approvals) < int(tx.Multisig.Threshold) {
+		return fmt.Errorf("multisig transaction (%s) lacks approvals and must be staged", hash)
+	}
+
+	size := len(core.MarshalTransaction(tx))
+	if size > p.MaxBytes {
+		return fmt.Errorf("transaction (%s) size (%d) exceeds the pool limit (%d)", hash, size, p.MaxBytes)
+	}
+	if minFee := p.MinFeePerByte * uint64(size); tx.Fee < minFee {
+		return fmt.Errorf("transaction (%s) fee (%d) is below the minimum (%d)", hash, tx.Fee, minFee)
+	}
+
+	if _, ok := p.trxs[hash]; ok {
+		return nil
+	}
+	now := p.now()
+
+	key, isTransfer := transferKey(tx)
+	replaced, replacing := p.nonces[key]
+	replacing = replacing && isTransfer
+	if replacing {
+		if minFee := bumpedFee(p.trxs[replaced].Fee, p.ReplaceFeeBump); tx.Fee < minFee {
+			return fmt.Errorf("transaction (%s) reuses the nonce (%d) of pending transaction (%s) and needs a fee of at least (%d) to replace it", hash, tx.Nonce, replaced, minFee)
+		}
+	}
+
+	if tx.GetFirstSeen() == 0 {
+		tx.SetFirstSeen(now.UnixNano())
+	}
+
+	victims, err := p.victims(tx, size, replaced, replacing)
+	if err != nil {
+		return fmt.Errorf("transaction (%s): %s", hash, err)
+	}
+	if replacing {
+		p.remove(replaced)
+	}
+	for _, victim := range victims {
+		p.remove(victim)
+	}
+
+	p.trxs[hash] = tx
+	p.entries[hash] = poolEntry{size: size, added: now}
+	p.bytes += size
+	if isTransfer {
+		p.nonces[key] = hash
+	}
+	return nil
+}
+
+// victims returns the transactions to evict so tx fits in the pool, the
+// lowest fee first and the oldest first among equal fees. The pool is full
+// for tx when only transactions paying a higher fee are left to evict. The
+// replaced transaction, if any, leaves the pool anyway and is not counted.
+func (p *TxPool) victims(tx *core.Transaction, size int, replaced types.Hash, replacing bool) ([]types.Hash, error) {
+	count, bytes := len(p.trxs), p.bytes
+	if replacing {
+		count--
+		bytes -= p.entries[replaced].size
+	}
+	if count < p.MaxCount && bytes+size <= p.MaxBytes {
+		return nil, nil
+	}
+
+	candidates := make([]types.Hash, 0, len(p.trxs))
+	for hash := range p.trxs {
+		if !replacing || hash != replaced {
+			candidates = append(candidates, hash)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := p.trxs[candidates[i]], p.trxs[candidates[j]]
+		if a.Fee != b.Fee {
+			return a.Fee < b.Fee
+		}
+		return a.GetFirstSeen() < b.GetFirstSeen()
+	})
+
+	var victims []types.Hash
+	for _, hash := range candidates {
+		if count < p.MaxCount && bytes+size <= p.MaxBytes {
+			break
+		}
+		if p.trxs[hash].Fee > tx.Fee {
+			return nil, fmt.Errorf("pool is full and the fee (%d) is too low to evict pending transactions", tx.Fee)
+		}
+		victims = append(victims, hash)
+		count--
+		bytes -= p.entries[hash].size
+	}
+	return victims, nil
+}
+
+func (p *TxPool) remove(hash types.Hash) {
+	if _, ok := p.trxs[hash]; !ok {
+		return
+	}
+	if key, ok := transferKey(p.trxs[hash]); ok && p.nonces[key] == hash {
+		delete(p.nonces, key)
+	}
+	p.bytes -= p.entries[hash].size
+	delete(p.trxs, hash)
+	delete(p.entries, hash)
 }
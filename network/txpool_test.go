@@ -3,10 +3,13 @@ package network
 import (
 	"math/rand"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/JoaoRafa19/crypto-go/core"
+	"github.com/JoaoRafa19/crypto-go/crypto"
+	"github.com/JoaoRafa19/crypto-go/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,6 +33,19 @@ func TestTxPoolAddTx(t *testing.T) {
 
 }
 
+func TestTxPoolRemove(t *testing.T) {
+	p := NewTxPool()
+	tx := core.NewTransaction([]byte("foo"))
+	other := core.NewTransaction([]byte("bar"))
+	assert.Nil(t, p.Add(tx))
+	assert.Nil(t, p.Add(other))
+
+	p.Remove(tx.Hash(core.TxHasher{}))
+	assert.Equal(t, 1, p.Len())
+	assert.False(t, p.Contains(tx.Hash(core.TxHasher{})))
+	assert.True(t, p.Contains(other.Hash(core.TxHasher{})))
+}
+
 func TestSortTransactions(t *testing.T) {
 	p := NewTxPool()
 
@@ -55,3 +71,274 @@ func TestSortTransactions(t *testing.T) {
 		assert.True(t, x < x1)
 	}
 }
+
+func TestTxPoolEvictsOldestWhenFull(t *testing.T) {
+	p := NewTxPoolWithOpts(TxPoolOpts{MaxCount: 3})
+
+	txx := make([]*core.Transaction, 4)
+	for i := range txx {
+		txx[i] = core.NewTransaction([]byte{byte(i)})
+		txx[i].SetFirstSeen(int64(i + 1))
+	}
+
+	// added out of order, eviction follows FirstSeen
+	assert.Nil(t, p.Add(txx[1]))
+	assert.Nil(t, p.Add(txx[0]))
+	assert.Nil(t, p.Add(txx[2]))
+	assert.Nil(t, p.Add(txx[3]))
+
+	assert.Equal(t, 3, p.Len())
+	assert.False(t, p.Contains(txx[0].Hash(core.TxHasher{})))
+	for _, tx := range txx[1:] {
+		assert.True(t, p.Contains(tx.Hash(core.TxHasher{})))
+	}
+}
+
+func TestTxPoolMaxBytes(t *testing.T) {
+	first := core.NewTransaction([]byte("foo"))
+	first.SetFirstSeen(1)
+	second := core.NewTransaction([]byte("bar"))
+	second.SetFirstSeen(2)
+
+	size := len(core.MarshalTransaction(first))
+	p := NewTxPoolWithOpts(TxPoolOpts{MaxBytes: size + size/2})
+
+	assert.Nil(t, p.Add(first))
+	assert.Equal(t, size, p.Bytes())
+	assert.Nil(t, p.Add(second))
+	assert.Equal(t, 1, p.Len())
+	assert.True(t, p.Contains(second.Hash(core.TxHasher{})))
+	assert.Equal(t, size, p.Bytes())
+
+	p.Remove(second.Hash(core.TxHasher{}))
+	assert.Zero(t, p.Bytes())
+
+	large := core.NewTransaction(make([]byte, 2*size))
+	assert.NotNil(t, p.Add(large))
+	assert.Zero(t, p.Len())
+}
+
+func TestTxPoolTTL(t *testing.T) {
+	p := NewTxPoolWithOpts(TxPoolOpts{TTL: time.Minute})
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	stale := core.NewTransaction([]byte("stale"))
+	assert.Nil(t, p.Add(stale))
+
+	now = now.Add(45 * time.Second)
+	fresh := core.NewTransaction([]byte("fresh"))
+	assert.Nil(t, p.Add(fresh))
+
+	now = now.Add(30 * time.Second)
+	txx := p.Transactions()
+	assert.Len(t, txx, 1)
+	assert.Equal(t, fresh.Data, txx[0].Data)
+
+	assert.Equal(t, 1, p.Prune())
+	assert.Equal(t, 1, p.Len())
+	assert.False(t, p.Contains(stale.Hash(core.TxHasher{})))
+}
+
+func TestTxPoolConcurrentAccess(t *testing.T) {
+	p := NewTxPoolWithOpts(TxPoolOpts{MaxCount: 100})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				tx := core.NewTransaction([]byte(strconv.Itoa(w*1000 + i)))
+				assert.Nil(t, p.Add(tx))
+				p.Contains(tx.Hash(core.TxHasher{}))
+				p.Transactions()
+				if i%3 == 0 {
+					p.Remove(tx.Hash(core.TxHasher{}))
+				}
+				p.Len()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, p.Len(), 100)
+	assert.Equal(t, p.Len(), len(p.Transactions()))
+}
+
+func TestTxPoolRejectsReusedNonce(t *testing.T) {
+	p := NewTxPool()
+	key := crypto.GeneratePrivateKey()
+	to := crypto.GeneratePrivateKey().PublicKey().Address()
+
+	first := core.NewTransferTransaction(to, 1, 0)
+	assert.Nil(t, first.Sign(key))
+	second := core.NewTransferTransaction(to, 2, 0)
+	assert.Nil(t, second.Sign(key))
+	next := core.NewTransferTransaction(to, 2, 1)
+	assert.Nil(t, next.Sign(key))
+
+	assert.Nil(t, p.Add(first))
+	assert.NotNil(t, p.Add(second))
+	assert.Nil(t, p.Add(next))
+
+	// once the first transfer is gone its nonce can be used again
+	p.Remove(first.Hash(core.TxHasher{}))
+	assert.Nil(t, p.Add(second))
+
+	// the account moved past nonce 0
+	assert.Equal(t, 1, p.RemoveStale(func(types.Address) uint64 { return 1 }))
+	assert.Equal(t, 1, p.Len())
+	assert.True(t, p.Contains(next.Hash(core.TxHasher{})))
+}
+
+func TestTxPoolFeePriority(t *testing.T) {
+	p := NewTxPool()
+
+	cheap := core.NewTransaction([]byte("cheap"))
+	cheap.SetFirstSeen(1)
+	rich := core.NewTransaction([]byte("rich"))
+	rich.Fee = 10
+	rich.SetFirstSeen(3)
+	late := core.NewTransaction([]byte("late"))
+	late.Fee = 10
+	late.SetFirstSeen(4)
+	mid := core.NewTransaction([]byte("mid"))
+	mid.Fee = 5
+	mid.SetFirstSeen(2)
+
+	for _, tx := range []*core.Transaction{cheap, late, mid, rich} {
+		assert.Nil(t, p.Add(tx))
+	}
+
+	txx := p.Transactions()
+	assert.Equal(t, []*core.Transaction{rich, late, mid, cheap}, txx)
+}
+
+func TestTxPoolMinFeePerByte(t *testing.T) {
+	p := NewTxPoolWithOpts(TxPoolOpts{MinFeePerByte: 2})
+
+	tx := core.NewTransaction([]byte("foo"))
+	size := uint64(len(core.MarshalTransaction(tx)))
+	tx.Fee = 2*size - 1
+	assert.NotNil(t, p.Add(tx))
+
+	tx.Fee = 2 * size
+	assert.Nil(t, p.Add(tx))
+}
+
+func TestTxPoolReplaceByFee(t *testing.T) {
+	p := NewTxPool()
+	key := crypto.GeneratePrivateKey()
+	to := crypto.GeneratePrivateKey().PublicKey().Address()
+
+	transfer := func(fee uint64) *core.Transaction {
+		tx := core.NewTransferTransaction(to, 1, 0)
+		tx.Fee = fee
+		assert.Nil(t, tx.Sign(key))
+		return tx
+	}
+
+	original := transfer(100)
+	assert.Nil(t, p.Add(original))
+
+	// below the 10% bump
+	assert.NotNil(t, p.Add(transfer(109)))
+
+	replacement := transfer(110)
+	assert.Nil(t, p.Add(replacement))
+	assert.Equal(t, 1, p.Len())
+	assert.False(t, p.Contains(original.Hash(core.TxHasher{})))
+	assert.True(t, p.Contains(replacement.Hash(core.TxHasher{})))
+}
+
+func TestTxPoolEvictsLowestFee(t *testing.T) {
+	p := NewTxPoolWithOpts(TxPoolOpts{MaxCount: 2})
+
+	low := core.NewTransaction([]byte("low"))
+	low.Fee = 1
+	high := core.NewTransaction([]byte("high"))
+	high.Fee = 3
+	assert.Nil(t, p.Add(low))
+	assert.Nil(t, p.Add(high))
+
+	// too cheap to take the place of anyone
+	free := core.NewTransaction([]byte("free"))
+	assert.NotNil(t, p.Add(free))
+
+	mid := core.NewTransaction([]byte("mid"))
+	mid.Fee = 2
+	assert.Nil(t, p.Add(mid))
+	assert.Equal(t, 2, p.Len())
+	assert.False(t, p.Contains(low.Hash(core.TxHasher{})))
+	assert.True(t, p.Contains(high.Hash(core.TxHasher{})))
+}
+
+func TestTxPoolStagesMultisig(t *testing.T) {
+	keys := []crypto.PrivateKey{crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey()}
+	policy, err := core.NewMultisigPolicy(2, keys[0].PublicKey(), keys[1].PublicKey(), keys[2].PublicKey())
+	assert.Nil(t, err)
+
+	// every signer approves its own copy of the transaction
+	approved := func(key crypto.PrivateKey) *core.Transaction {
+		tx := core.NewTransferTransaction(types.Address{0x01}, 10, 0)
+		tx.Multisig = policy
+		assert.Nil(t, tx.Approve(key))
+		return tx
+	}
+
+	p := NewTxPool()
+	first := approved(keys[0])
+	assert.NotNil(t, p.Add(first))
+
+	merged, err := p.Stage(first)
+	assert.Nil(t, err)
+	assert.NotNil(t, merged)
+	assert.Equal(t, 1, p.StagedLen())
+	assert.Zero(t, p.Len())
+
+	// the same approval again brings nothing
+	merged, err = p.Stage(approved(keys[0]))
+	assert.Nil(t, err)
+	assert.Nil(t, merged)
+
+	// a forged approval is rejected
+	forged := approved(keys[1])
+	forged.Approvals[0].Signature = first.Approvals[0].Signature
+	_, err = p.Stage(forged)
+	assert.NotNil(t, err)
+
+	merged, err = p.Stage(approved(keys[2]))
+	assert.Nil(t, err)
+	assert.Len(t, merged.Approvals, 2)
+	assert.Nil(t, merged.Verify())
+	assert.Zero(t, p.StagedLen())
+	assert.Equal(t, 1, p.Len())
+	assert.True(t, p.Contains(first.Hash(core.TxHasher{})))
+	assert.Len(t, first.Approvals, 1)
+}
+
+func TestTxPoolStagingExpires(t *testing.T) {
+	keys := []crypto.PrivateKey{crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey()}
+	policy, err := core.NewMultisigPolicy(2, keys[0].PublicKey(), keys[1].PublicKey())
+	assert.Nil(t, err)
+
+	p := NewTxPoolWithOpts(TxPoolOpts{TTL: time.Minute, MaxStaged: 1})
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	stage := func(nonce uint64) error {
+		tx := core.NewTransferTransaction(types.Address{0x01}, 10, nonce)
+		tx.Multisig = policy
+		assert.Nil(t, tx.Approve(keys[0]))
+		_, err := p.Stage(tx)
+		return err
+	}
+
+	assert.Nil(t, stage(0))
+	assert.NotNil(t, stage(1))
+
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 1, p.Prune())
+	assert.Nil(t, stage(1))
+}